@@ -19,32 +19,67 @@ import (
 
 const (
 	defaultRetries = 3
+
+	// Same credentials environment variables used by the helm cm-push plugin
+	chartMuseumUsernameEnv = "HELM_REPO_USERNAME"
+	chartMuseumPasswordEnv = "HELM_REPO_PASSWORD"
 )
 
 var (
 	skipConfirmation bool
 	retries          uint
 
-	imagePatternsFile string
+	imagePatternsFiles []string
+	mergeHints         bool
+	verifyCoverage     bool
+	relocateDisabled   bool
+
+	chartRepoURL string
+	chartVersion string
 
 	registryRule         string
 	repositoryPrefixRule string
+	pathStrategy         string
+	pathSeparator        string
+	tagStrategy          string
+	tagSuffix            string
+	referenceStrategy    string
 	forcePush            bool
+	globalRegistry       bool
+	rulesFile            string
+	pushChart            bool
 
 	output string
 
 	toArchive string
 
+	toRepoDir     string
+	repoDirURL    string
+	toChartMuseum string
+
+	toKustomize string
+	toValues    string
+
+	keepDependencies bool
+	dependencyRepo   string
+
+	targetsFilePath string
+
 	// errMissingOutPlaceHolder if out flag is missing the wildcard * placeholder
 	errMissingOutPlaceHolder = errors.New("missing '*' placeholder in --out flag")
 
 	// errBadExtension when the out flag does not use a expected file extension
 	errBadExtension = errors.New("bad extension (expected .tgz)")
+
+	// errVersionWithoutRepo when the version flag is given without a chart repository
+	errVersionWithoutRepo = errors.New("--version requires a chart repository, please set --repo")
 )
 
 func init() {
 	chartCmd := &cobra.Command{Use: "chart"}
 	chartCmd.AddCommand(newChartMoveCmd())
+	chartCmd.AddCommand(newChartMoveAllCmd())
+	chartCmd.AddCommand(newChartHintsCmd())
 	// TODO(miguel): Revisit this override since it seems required only for testing
 	chartCmd.SetOut(os.Stdout)
 
@@ -65,23 +100,50 @@ func newChartMoveCmd() *cobra.Command {
 		Use:     "move <chart>",
 		Short:   "Relocates a Helm Chart along with its associated container images",
 		Long:    "It takes the provided Helm Chart, resolves and re-pushes all the dependent images, providing as output a modified Helm Chart (and subcharts) pointing to the new location of the images.",
-		Example: "move my-chart --image-patterns my-image-hints.yaml --registry my-registry.company.com ",
+		Example: "move my-chart --image-patterns my-image-hints.yaml --registry my-registry.company.com\nmove oci://my-registry.company.com/charts/my-chart:1.2.3 --registry my-registry.company.com\nmove --repo https://charts.company.com my-chart --version 1.x --registry my-registry.company.com",
 		RunE:    moveChart,
 		Args:    validateChartArgs,
 	}
 
 	f := cmd.Flags()
 	// TODO(miguel): Change to image-hints
-	f.StringVarP(&imagePatternsFile, "image-patterns", "i", "", "file with image patterns")
+	f.StringArrayVarP(&imagePatternsFiles, "image-patterns", "i", nil, "file with image patterns, can be repeated to merge several files. Replaces the hints found in the chart unless --merge-hints is set")
+	f.BoolVar(&mergeHints, "merge-hints", false, "merge the --image-patterns files with the chart embedded hints, its artifacthub.io/images annotation and its subcharts hints")
+	f.BoolVar(&relocateDisabled, "relocate-disabled", false, "relocate the images of the components and subcharts disabled in the chart values too, so they can be enabled at install time")
+	f.BoolVar(&verifyCoverage, "verify-coverage", false, "render the chart templates and fail if the image patterns miss any of their workload images")
 	f.BoolVarP(&skipConfirmation, "yes", "y", false, "proceed without prompting for confirmation")
 
+	f.StringVar(&chartRepoURL, "repo", "", "URL of the Helm chart repository to download the chart from")
+	f.StringVar(&chartVersion, "version", "", "chart version or semver constraint to download from the chart repository, defaults to the latest")
+
 	f.StringVar(&registryRule, "registry", "", "hostname of the registry used to push the new images")
 	f.StringVar(&repositoryPrefixRule, "repo-prefix", "", "path prefix to be used when relocating the container images")
+	f.StringVar(&pathStrategy, "repo-path-strategy", "", "what of the original repository path to keep under the repo prefix: last-segment (default), full, registry or flat")
+	f.StringVar(&pathSeparator, "repo-path-separator", "", "separator joining the repository path segments of the flat strategy, - by default")
+	f.StringVar(&tagStrategy, "tag-strategy", "", "tag the images are pushed under: original (default), chart-version, suffix or digest-only")
+	f.StringVar(&tagSuffix, "tag-suffix", "", "suffix appended to the original tags by the suffix tag strategy, i.e -relocated")
+	f.StringVar(&referenceStrategy, "reference-strategy", "", "how the rewritten chart references the images: tag, digest or tag-and-digest. Defaults to digest, unless the image patterns have a tag or digest")
+	f.StringVar(&rulesFile, "rules-file", "", "YAML file of ordered rules mapping the source image repositories to their targets, the first matching rule wins. Images matching no rule follow --registry and --repo-prefix")
 	f.BoolVarP(&forcePush, "force-push", "f", false, "push the container images to destination even if they exist with a different digest")
+	f.BoolVar(&globalRegistry, "global-registry", false, "rewrite the chart global.imageRegistry, once, instead of each image registry. Requires all the images to move to the same registry and every template to read the global")
+
+	f.BoolVar(&pushChart, "push-chart", false, "push the relocated chart to the target registry and repository prefix as an OCI artifact")
 
 	f.UintVar(&retries, "retries", defaultRetries, "number of times to retry push operations")
 	f.StringVar(&output, "out", "*.relocated.tgz", "name of the resulting chart")
 
+	f.StringVar(&toRepoDir, "to-repo-dir", "", "add the relocated chart to a local Helm repository directory and update its index.yaml")
+	f.StringVar(&repoDirURL, "repo-dir-url", "", "URL the --to-repo-dir repository is served from, used for its index entries")
+	f.StringVar(&toChartMuseum, "to-chartmuseum", "", "upload the relocated chart to a ChartMuseum compatible repository URL. Credentials are read from HELM_REPO_USERNAME and HELM_REPO_PASSWORD")
+
+	f.StringVar(&toKustomize, "to-kustomize", "", "leave the chart untouched and write a Kustomize overlay directory whose kustomization.yaml relocates its images")
+	f.StringVar(&toValues, "to-values", "", "leave the chart untouched and write a values file relocating its images, to be used with helm install -f. Directories get a relocated-values.yaml")
+
+	f.BoolVar(&keepDependencies, "keep-dependencies", false, "keep the chart dependencies pointing to where the relocated subcharts are published instead of removing them")
+	f.StringVar(&dependencyRepo, "dependency-repo", "", "repository the kept dependencies point to, defaults to the chart push or publishing target. Implies --keep-dependencies")
+
+	f.StringVar(&targetsFilePath, "targets-file", "", "YAML file listing several targets, each with its own registry, repo prefix and out path, to relocate the chart to in a single run pulling the images once")
+
 	f.StringVar(&toArchive, "to-archive", "", "save the chart and all its dependencies to an intermediate archive tarball")
 	f.StringVar(&toArchive, "to-intermediate-bundle", "", "save the chart and all its dependencies to an intermediate bundle tarball")
 
@@ -93,13 +155,24 @@ func newChartMoveCmd() *cobra.Command {
 }
 
 func moveChart(cmd *cobra.Command, args []string) error {
+	mappings, err := mappingRules()
+	if err != nil {
+		return err
+	}
 	targetRewriteRules := &mover.RewriteRules{
-		Registry:         registryRule,
-		RepositoryPrefix: repositoryPrefixRule,
-		ForcePush:        forcePush,
+		Registry:            registryRule,
+		RepositoryPrefix:    repositoryPrefixRule,
+		PathStrategy:        pathStrategy,
+		PathSeparator:       pathSeparator,
+		TagStrategy:         tagStrategy,
+		TagSuffix:           tagSuffix,
+		ReferenceStrategy:   referenceStrategy,
+		ForcePush:           forcePush,
+		GlobalImageRegistry: globalRegistry,
+		Mappings:            mappings,
 	}
 
-	err := targetRewriteRules.Validate()
+	err = targetRewriteRules.Validate()
 	if err != nil {
 		return err
 	}
@@ -111,10 +184,13 @@ func moveChart(cmd *cobra.Command, args []string) error {
 
 	moveRequest := mover.ChartMoveRequest{
 		Source: mover.Source{
-			Chart:          mover.ChartSpec{},
-			ImageHintsFile: imagePatternsFile,
+			Chart:           mover.ChartSpec{},
+			ImageHintsFiles: imagePatternsFiles,
+			MergeHints:      mergeHints,
 			// Use local keychain for authentication
-			ContainersAuth: &mover.ContainersAuth{UseDefaultLocalKeychain: true},
+			ContainersAuth:   &mover.ContainersAuth{UseDefaultLocalKeychain: true},
+			VerifyCoverage:   verifyCoverage,
+			RelocateDisabled: relocateDisabled,
 		},
 		Target: mover.Target{
 			Chart:          mover.ChartSpec{},
@@ -123,18 +199,19 @@ func moveChart(cmd *cobra.Command, args []string) error {
 		},
 	}
 
-	inputChartPath := args[0]
-	if mover.IsIntermediateBundle(inputChartPath) {
-		cmd.Println("Intermediate bundle provided")
-		moveRequest.Source.Chart.IntermediateBundle = &mover.IntermediateBundle{Path: inputChartPath}
-	} else {
-		cmd.Println("Chart provided")
-		moveRequest.Source.Chart.Local = &mover.LocalChart{Path: inputChartPath}
+	if err := setChartSource(cmd, &moveRequest.Source.Chart, args[0]); err != nil {
+		return err
+	}
+	if targetsFilePath != "" {
+		return moveChartToTargets(cmd, &moveRequest, targetRewriteRules)
 	}
 	if toArchive != "" {
 		moveRequest.Target.Chart.IntermediateBundle = &mover.IntermediateBundle{Path: toArchive}
 	} else {
-		moveRequest.Target.Chart.Local = &mover.LocalChart{Path: outputPathFmt}
+		setChartTargets(cmd, &moveRequest.Target.Chart, outputPathFmt)
+		if keepDependencies || dependencyRepo != "" {
+			moveRequest.Target.Dependencies = &mover.RelocatedDependencies{Repository: dependencyRepo}
+		}
 	}
 	chartMover, err :=
 		mover.NewChartMover(&moveRequest, mover.WithRetries(retries), mover.WithLogger(cmd))
@@ -143,9 +220,13 @@ func moveChart(cmd *cobra.Command, args []string) error {
 		if errors.As(err, &loadingError) {
 			return loadingError
 		} else if errors.Is(err, mover.ErrImageHintsMissing) {
-			return fmt.Errorf("image patterns file is required. Please try again with '--image-patterns <image patterns file>' or as part of the Helm chart at [chart]/%s file", mover.EmbeddedHintsFilename)
+			return fmt.Errorf("image patterns file is required. Please try again with '--image-patterns <image patterns file>', as part of the Helm chart at [chart]/%s file or its %s annotation", mover.EmbeddedHintsFilename, mover.ArtifactHubImagesAnnotation)
 		} else if err == mover.ErrOCIRewritesMissing {
-			return fmt.Errorf("at least one rewrite rule must be given. Please try again with --registry and/or --repo-prefix")
+			return fmt.Errorf("at least one rewrite rule must be given. Please try again with --registry, --repo-prefix and/or --rules-file")
+		} else if err == mover.ErrDependencyRepositoryMissing {
+			return fmt.Errorf("keeping the chart dependencies requires a repository to point them to. Please try again with --dependency-repo, --push-chart, --to-repo-dir and --repo-dir-url or --to-chartmuseum")
+		} else if err == mover.ErrOCIChartTargetMissing {
+			return fmt.Errorf("pushing the chart requires a target registry. Please try again with --registry")
 		}
 
 		cmd.SilenceUsage = true
@@ -170,6 +251,69 @@ func moveChart(cmd *cobra.Command, args []string) error {
 	return chartMover.Move()
 }
 
+// mappingRules loads the rules of the --rules-file, if any
+func mappingRules() ([]*mover.MappingRule, error) {
+	if rulesFile == "" {
+		return nil, nil
+	}
+	return mover.LoadRulesFile(rulesFile)
+}
+
+// setChartSource sets where the chart is loaded from: a Helm repository when
+// --repo is given, an OCI registry, an intermediate bundle or a local path
+func setChartSource(cmd *cobra.Command, spec *mover.ChartSpec, inputChartPath string) error {
+	if chartVersion != "" && chartRepoURL == "" {
+		return errVersionWithoutRepo
+	}
+
+	if chartRepoURL != "" {
+		cmd.Println("Repository chart provided")
+		spec.Repository = &mover.RepositoryChart{
+			URL:     chartRepoURL,
+			Name:    inputChartPath,
+			Version: chartVersion,
+		}
+	} else if mover.IsOCIChart(inputChartPath) {
+		cmd.Println("OCI chart provided")
+		spec.OCI = &mover.OCIChart{Reference: inputChartPath}
+	} else if mover.IsIntermediateBundle(inputChartPath) {
+		cmd.Println("Intermediate bundle provided")
+		spec.IntermediateBundle = &mover.IntermediateBundle{Path: inputChartPath}
+	} else {
+		cmd.Println("Chart provided")
+		spec.Local = &mover.LocalChart{Path: inputChartPath}
+	}
+	return nil
+}
+
+// setChartTargets sets where the relocated chart goes.
+// Publishing to a Helm repository or writing a Kustomize overlay replaces the
+// local output unless --out is set explicitly
+func setChartTargets(cmd *cobra.Command, spec *mover.ChartSpec, outputPathFmt string) {
+	if pushChart {
+		spec.OCI = &mover.OCIChart{}
+	}
+	if toRepoDir != "" {
+		spec.RepositoryDir = &mover.RepositoryDir{Path: toRepoDir, URL: repoDirURL}
+	}
+	if toChartMuseum != "" {
+		spec.ChartMuseum = &mover.ChartMuseum{
+			URL:      toChartMuseum,
+			Username: os.Getenv(chartMuseumUsernameEnv),
+			Password: os.Getenv(chartMuseumPasswordEnv),
+		}
+	}
+	if toKustomize != "" {
+		spec.KustomizeOverlay = &mover.KustomizeOverlay{Path: toKustomize}
+	}
+	if toValues != "" {
+		spec.ValuesOverride = &mover.ValuesOverride{Path: toValues}
+	}
+	if (toRepoDir == "" && toChartMuseum == "" && toKustomize == "" && toValues == "") || cmd.Flags().Changed("out") {
+		spec.Local = &mover.LocalChart{Path: outputPathFmt}
+	}
+}
+
 func parseOutputFlag(out string) (string, error) {
 	if !strings.Contains(out, "*") {
 		return "", fmt.Errorf("%w: %s", errMissingOutPlaceHolder, out)
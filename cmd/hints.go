@@ -0,0 +1,222 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/pkg/mover"
+)
+
+var (
+	hintsOutput        string
+	hintsConvertOutput string
+	hintsVersion       int
+)
+
+func init() {
+	// The hints commands are reachable as relok8s hints too, next to chart
+	hintsCmd := newChartHintsCmd()
+	hintsCmd.SetOut(os.Stdout)
+
+	rootCmd.AddCommand(hintsCmd)
+}
+
+func newChartHintsCmd() *cobra.Command {
+	cmd := &cobra.Command{Use: "hints", Short: "Manages the image hints of a Helm Chart"}
+	cmd.AddCommand(newChartHintsGenerateCmd())
+	cmd.AddCommand(newChartHintsCoverageCmd())
+	cmd.AddCommand(newChartHintsLintCmd())
+	cmd.AddCommand(newChartHintsConvertCmd())
+	return cmd
+}
+
+func newChartHintsGenerateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "generate <chart>",
+		Short:   "Generates the image hints file of a Helm Chart",
+		Long:    "It scans the values of the chart and its subcharts for image maps, with registry, repository or name, tag and digest keys, and plain image strings, writing an image hints file to review before using it with chart move.",
+		Example: "generate my-chart --out my-chart.images.yaml\ngenerate --repo https://charts.company.com my-chart --version 1.x",
+		RunE:    generateHints,
+		Args:    validateChartArgs,
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&chartRepoURL, "repo", "", "URL of the Helm chart repository to download the chart from")
+	f.StringVar(&chartVersion, "version", "", "chart version or semver constraint to download from the chart repository, defaults to the latest")
+	f.StringVar(&hintsOutput, "out", mover.EmbeddedHintsFilename, "name of the resulting image hints file")
+
+	return cmd
+}
+
+func generateHints(cmd *cobra.Command, args []string) error {
+	source := mover.Source{
+		// Use local keychain for authentication
+		ContainersAuth: &mover.ContainersAuth{UseDefaultLocalKeychain: true},
+	}
+	if err := setChartSource(cmd, &source.Chart, args[0]); err != nil {
+		return err
+	}
+
+	hints, err := mover.GenerateImageHints(&source, mover.WithLogger(cmd))
+	if err != nil {
+		var loadingError *mover.ChartLoadingError
+		if errors.As(err, &loadingError) {
+			return loadingError
+		}
+		cmd.SilenceUsage = true
+		return err
+	}
+
+	if err := os.WriteFile(hintsOutput, hints, 0644); err != nil {
+		return fmt.Errorf("failed to write image hints: %w", err)
+	}
+	cmd.Println("Image hints written to", hintsOutput)
+	return nil
+}
+
+func newChartHintsCoverageCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "coverage <chart>",
+		Short:   "Reports how the image hints cover the images of the rendered chart",
+		Long:    "It renders the chart templates with the default values and compares the images of the rendered workloads with the images found by the image hints, reporting the images missing from the hints and the hints no workload uses. It fails if images are missing.",
+		Example: "coverage my-chart --image-patterns my-image-hints.yaml",
+		RunE:    reportHintsCoverage,
+		Args:    validateChartArgs,
+	}
+
+	f := cmd.Flags()
+	f.StringArrayVarP(&imagePatternsFiles, "image-patterns", "i", nil, "file with image patterns, can be repeated to merge several files. Replaces the hints found in the chart unless --merge-hints is set")
+	f.BoolVar(&mergeHints, "merge-hints", false, "merge the --image-patterns files with the chart embedded hints, its artifacthub.io/images annotation and its subcharts hints")
+	f.StringVar(&chartRepoURL, "repo", "", "URL of the Helm chart repository to download the chart from")
+	f.StringVar(&chartVersion, "version", "", "chart version or semver constraint to download from the chart repository, defaults to the latest")
+
+	return cmd
+}
+
+func reportHintsCoverage(cmd *cobra.Command, args []string) error {
+	source := mover.Source{
+		ImageHintsFiles: imagePatternsFiles,
+		MergeHints:      mergeHints,
+		// Use local keychain for authentication
+		ContainersAuth: &mover.ContainersAuth{UseDefaultLocalKeychain: true},
+	}
+	if err := setChartSource(cmd, &source.Chart, args[0]); err != nil {
+		return err
+	}
+
+	report, err := mover.ImageHintsCoverage(&source, mover.WithLogger(cmd))
+	if err != nil {
+		var loadingError *mover.ChartLoadingError
+		if errors.As(err, &loadingError) {
+			return loadingError
+		} else if errors.Is(err, mover.ErrImageHintsMissing) {
+			return fmt.Errorf("image patterns file is required. Please try again with '--image-patterns <image patterns file>', as part of the Helm chart at [chart]/%s file or its %s annotation", mover.EmbeddedHintsFilename, mover.ArtifactHubImagesAnnotation)
+		}
+		cmd.SilenceUsage = true
+		return err
+	}
+
+	report.Print(cmd)
+	if !report.Complete() {
+		cmd.SilenceUsage = true
+		return mover.ErrHintsCoverageIncomplete
+	}
+	return nil
+}
+
+func newChartHintsLintCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "lint <chart>",
+		Short:   "Checks the image hints against a Helm Chart",
+		Long:    "It checks each pattern of the image hints files, or of the chart embedded hints file if none is given, against the chart values. It reports, with their line numbers, invalid templates, missing or non string values paths and invalid images as errors, and duplicate or overlapping patterns and patterns producing the same image as warnings. It fails if errors are found.",
+		Example: "lint my-chart --image-patterns my-image-hints.yaml",
+		RunE:    lintHints,
+		Args:    validateChartArgs,
+	}
+
+	f := cmd.Flags()
+	f.StringArrayVarP(&imagePatternsFiles, "image-patterns", "i", nil, "file with image patterns, can be repeated")
+	f.StringVar(&chartRepoURL, "repo", "", "URL of the Helm chart repository to download the chart from")
+	f.StringVar(&chartVersion, "version", "", "chart version or semver constraint to download from the chart repository, defaults to the latest")
+
+	return cmd
+}
+
+func lintHints(cmd *cobra.Command, args []string) error {
+	source := mover.Source{
+		ImageHintsFiles: imagePatternsFiles,
+		// Use local keychain for authentication
+		ContainersAuth: &mover.ContainersAuth{UseDefaultLocalKeychain: true},
+	}
+	if err := setChartSource(cmd, &source.Chart, args[0]); err != nil {
+		return err
+	}
+
+	findings, err := mover.LintImageHints(&source, mover.WithLogger(cmd))
+	if err != nil {
+		var loadingError *mover.ChartLoadingError
+		if errors.As(err, &loadingError) {
+			return loadingError
+		} else if errors.Is(err, mover.ErrImageHintsMissing) {
+			return fmt.Errorf("image patterns file is required. Please try again with '--image-patterns <image patterns file>' or as part of the Helm chart at [chart]/%s file", mover.EmbeddedHintsFilename)
+		}
+		cmd.SilenceUsage = true
+		return err
+	}
+
+	mover.PrintHintFindings(findings, cmd)
+	if err := mover.HintFindingsError(findings); err != nil {
+		cmd.SilenceUsage = true
+		return err
+	}
+	cmd.Println("No image hints errors found")
+	return nil
+}
+
+func newChartHintsConvertCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "convert <image hints file>",
+		Short:   "Converts an image hints file between the legacy and the structured (v2) formats",
+		Long:    "It reads an image hints file in any format and writes it in the requested one. Hints using structured options, such as optional, condition or platforms, cannot be converted to the legacy format.",
+		Example: "convert my-image-hints.yaml --to 2 --out my-image-hints.v2.yaml",
+		RunE:    convertHints,
+		Args:    cobra.ExactArgs(1),
+	}
+
+	f := cmd.Flags()
+	f.IntVar(&hintsVersion, "to", 2, "image hints format version to convert to, 1 for the legacy list of patterns")
+	f.StringVar(&hintsConvertOutput, "out", "", "name of the resulting image hints file, defaults to the input file")
+
+	return cmd
+}
+
+func convertHints(cmd *cobra.Command, args []string) error {
+	if hintsVersion != 1 && hintsVersion != 2 {
+		return fmt.Errorf("unsupported image hints version %d, expected 1 or 2", hintsVersion)
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read the image patterns file: %w", err)
+	}
+	hints, err := mover.ConvertImageHints(data, hintsVersion)
+	if err != nil {
+		cmd.SilenceUsage = true
+		return err
+	}
+
+	out := hintsConvertOutput
+	if out == "" {
+		out = args[0]
+	}
+	if err := os.WriteFile(out, hints, 0644); err != nil {
+		return fmt.Errorf("failed to write image hints: %w", err)
+	}
+	cmd.Println("Image hints written to", out)
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/pkg/mover"
+)
+
+var _ = Describe("Hints", func() {
+	It("is available at the top level and under chart", func() {
+		for _, path := range [][]string{{"hints", "lint"}, {"chart", "hints", "lint"}} {
+			lintCmd, _, err := rootCmd.Find(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lintCmd.Name()).To(Equal("lint"))
+			Expect(lintCmd.Parent().Name()).To(Equal("hints"))
+		}
+	})
+
+	Describe("generate", func() {
+		var (
+			dir, wd string
+			out     *Buffer
+		)
+
+		BeforeEach(func() {
+			var err error
+			wd, err = os.Getwd()
+			Expect(err).ToNot(HaveOccurred())
+			dir, err = os.MkdirTemp("", "hints-test-*")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.Chdir(dir)).To(Succeed())
+			out = NewBuffer()
+			rootCmd.SetOut(out)
+			rootCmd.SetErr(out)
+		})
+
+		AfterEach(func() {
+			Expect(os.Chdir(wd)).To(Succeed())
+			os.RemoveAll(dir)
+			rootCmd.SetOut(nil)
+			rootCmd.SetErr(nil)
+		})
+
+		It("writes the chart hints file without --out", func() {
+			chartPath := filepath.Join(wd, "..", "test", "fixtures", "testchart")
+			for _, args := range [][]string{{"chart", "hints", "generate", chartPath}, {"hints", "generate", chartPath}} {
+				rootCmd.SetArgs(args)
+				Expect(rootCmd.Execute()).To(Succeed())
+				Expect(filepath.Join(dir, mover.EmbeddedHintsFilename)).To(BeAnExistingFile())
+				Expect(os.Remove(filepath.Join(dir, mover.EmbeddedHintsFilename))).To(Succeed())
+			}
+		})
+	})
+})
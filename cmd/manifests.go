@@ -0,0 +1,139 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/pkg/mover"
+)
+
+func init() {
+	manifestsCmd := &cobra.Command{Use: "manifests"}
+	manifestsCmd.AddCommand(newManifestsMoveCmd())
+	manifestsCmd.SetOut(os.Stdout)
+
+	rootCmd.AddCommand(manifestsCmd)
+}
+
+func newManifestsMoveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "move <manifest file or directory>...",
+		Short:   "Relocates the container images used in plain Kubernetes manifests",
+		Long:    "It finds the container images of the Pod templates in the given YAML manifests, pushes them to their new location and rewrites the manifests in place, preserving their formatting and comments. Directories are searched for .yaml and .yml files.",
+		Example: "move deploy/ --registry my-registry.company.com\nmove app.yaml jobs.yaml --registry my-registry.company.com --repo-prefix my-team",
+		RunE:    moveManifests,
+		Args:    cobra.MinimumNArgs(1),
+	}
+
+	f := cmd.Flags()
+	f.BoolVarP(&skipConfirmation, "yes", "y", false, "proceed without prompting for confirmation")
+	f.StringVar(&registryRule, "registry", "", "hostname of the registry used to push the new images")
+	f.StringVar(&repositoryPrefixRule, "repo-prefix", "", "path prefix to be used when relocating the container images")
+	f.StringVar(&pathStrategy, "repo-path-strategy", "", "what of the original repository path to keep under the repo prefix: last-segment (default), full, registry or flat")
+	f.StringVar(&pathSeparator, "repo-path-separator", "", "separator joining the repository path segments of the flat strategy, - by default")
+	f.StringVar(&tagStrategy, "tag-strategy", "", "tag the images are pushed under: original (default), suffix or digest-only")
+	f.StringVar(&tagSuffix, "tag-suffix", "", "suffix appended to the original tags by the suffix tag strategy, i.e -relocated")
+	f.StringVar(&referenceStrategy, "reference-strategy", "", "how the rewritten manifests reference the images: tag, digest (default) or tag-and-digest")
+	f.StringVar(&rulesFile, "rules-file", "", "YAML file of ordered rules mapping the source image repositories to their targets, the first matching rule wins. Images matching no rule follow --registry and --repo-prefix")
+	f.BoolVarP(&forcePush, "force-push", "f", false, "push the container images to destination even if they exist with a different digest")
+	f.UintVar(&retries, "retries", defaultRetries, "number of times to retry push operations")
+
+	return cmd
+}
+
+func moveManifests(cmd *cobra.Command, args []string) error {
+	mappings, err := mappingRules()
+	if err != nil {
+		return err
+	}
+	targetRewriteRules := &mover.RewriteRules{
+		Registry:          registryRule,
+		RepositoryPrefix:  repositoryPrefixRule,
+		PathStrategy:      pathStrategy,
+		PathSeparator:     pathSeparator,
+		TagStrategy:       tagStrategy,
+		TagSuffix:         tagSuffix,
+		ReferenceStrategy: referenceStrategy,
+		ForcePush:         forcePush,
+		Mappings:          mappings,
+	}
+	if err := targetRewriteRules.Validate(); err != nil {
+		return err
+	}
+
+	files, err := manifestFiles(args)
+	if err != nil {
+		return err
+	}
+
+	manifestsMover, err := mover.NewManifestsMover(&mover.ManifestsMoveRequest{
+		Files: files,
+		Rules: *targetRewriteRules,
+		// Use local keychain for authentication
+		SourceContainersAuth: &mover.ContainersAuth{UseDefaultLocalKeychain: true},
+		TargetContainersAuth: &mover.ContainersAuth{UseDefaultLocalKeychain: true},
+	}, mover.WithRetries(retries), mover.WithLogger(cmd))
+	if err != nil {
+		if err == mover.ErrOCIRewritesMissing {
+			return fmt.Errorf("at least one rewrite rule must be given. Please try again with --registry, --repo-prefix and/or --rules-file")
+		}
+		cmd.SilenceUsage = true
+		return err
+	}
+
+	manifestsMover.Print()
+
+	if !skipConfirmation {
+		cmd.Println("Would you like to proceed? (y/N)")
+		proceed, err := getConfirmation(cmd.InOrStdin())
+		if err != nil {
+			return fmt.Errorf("failed to prompt for confirmation: %w", err)
+		}
+
+		if !proceed {
+			cmd.Println("Aborting")
+			return nil
+		}
+	}
+
+	return manifestsMover.Move()
+}
+
+// manifestFiles expands the directories in paths into the YAML files they contain
+func manifestFiles(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ext := filepath.Ext(file); !d.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no manifest files found")
+	}
+	return files, nil
+}
@@ -0,0 +1,215 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/pkg/mover"
+)
+
+// chartsManifest lists the charts relocated by chart move-all, i.e
+//
+//	charts:
+//	- chart: ./mariadb
+//	  imagePatterns: mariadb.images.yaml
+//	  out: relocated/*.tgz
+//	- chart: mysql
+//	  repo: https://charts.bitnami.com/bitnami
+//	  version: 8.x
+//	- chart: oci://registry.example.com/charts/redis:17.0.0
+//
+// Relative paths are resolved from the manifest directory
+type chartsManifest struct {
+	Charts []*manifestChart `yaml:"charts"`
+}
+
+type manifestChart struct {
+	// Chart is a local path, an oci:// reference or, along with Repo, a chart name
+	Chart string `yaml:"chart"`
+	Repo  string `yaml:"repo"`
+	// Version of the repository chart, defaults to the latest
+	Version       string `yaml:"version"`
+	ImagePatterns string `yaml:"imagePatterns"`
+	// Out follows the --out format, which is also its default
+	Out string `yaml:"out"`
+}
+
+func newChartMoveAllCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "move-all <manifest>",
+		Short:   "Relocates all the Helm Charts listed in a manifest file, pushing their shared images only once",
+		Long:    "It relocates every chart listed in the manifest file as chart move does. Images are pulled and pushed once for all the charts and the result of each chart is reported at the end.",
+		Example: "move-all charts.yaml --registry my-registry.company.com",
+		RunE:    moveAllCharts,
+		Args:    cobra.ExactArgs(1),
+	}
+
+	f := cmd.Flags()
+	f.BoolVarP(&skipConfirmation, "yes", "y", false, "proceed without prompting for confirmation")
+	f.StringVar(&registryRule, "registry", "", "hostname of the registry used to push the new images")
+	f.StringVar(&repositoryPrefixRule, "repo-prefix", "", "path prefix to be used when relocating the container images")
+	f.StringVar(&pathStrategy, "repo-path-strategy", "", "what of the original repository path to keep under the repo prefix: last-segment (default), full, registry or flat")
+	f.StringVar(&pathSeparator, "repo-path-separator", "", "separator joining the repository path segments of the flat strategy, - by default")
+	f.StringVar(&tagStrategy, "tag-strategy", "", "tag the images are pushed under: original (default), chart-version, suffix or digest-only")
+	f.StringVar(&tagSuffix, "tag-suffix", "", "suffix appended to the original tags by the suffix tag strategy, i.e -relocated")
+	f.StringVar(&referenceStrategy, "reference-strategy", "", "how the rewritten chart references the images: tag, digest or tag-and-digest. Defaults to digest, unless the image patterns have a tag or digest")
+	f.StringVar(&rulesFile, "rules-file", "", "YAML file of ordered rules mapping the source image repositories to their targets, the first matching rule wins. Images matching no rule follow --registry and --repo-prefix")
+	f.BoolVarP(&forcePush, "force-push", "f", false, "push the container images to destination even if they exist with a different digest")
+	f.BoolVar(&globalRegistry, "global-registry", false, "rewrite the chart global.imageRegistry, once, instead of each image registry. Requires all the images to move to the same registry and every template to read the global")
+	f.BoolVar(&relocateDisabled, "relocate-disabled", false, "relocate the images of the components and subcharts disabled in the chart values too, so they can be enabled at install time")
+	f.BoolVar(&mergeHints, "merge-hints", false, "merge the imagePatterns files of the manifest with the chart embedded hints, its artifacthub.io/images annotation and its subcharts hints")
+	f.UintVar(&retries, "retries", defaultRetries, "number of times to retry push operations")
+	f.StringVar(&output, "out", "*.relocated.tgz", "name of the resulting charts, unless set in the manifest")
+
+	return cmd
+}
+
+func moveAllCharts(cmd *cobra.Command, args []string) error {
+	mappings, err := mappingRules()
+	if err != nil {
+		return err
+	}
+	targetRewriteRules := &mover.RewriteRules{
+		Registry:            registryRule,
+		RepositoryPrefix:    repositoryPrefixRule,
+		PathStrategy:        pathStrategy,
+		PathSeparator:       pathSeparator,
+		TagStrategy:         tagStrategy,
+		TagSuffix:           tagSuffix,
+		ReferenceStrategy:   referenceStrategy,
+		ForcePush:           forcePush,
+		GlobalImageRegistry: globalRegistry,
+		Mappings:            mappings,
+	}
+	if err := targetRewriteRules.Validate(); err != nil {
+		return err
+	}
+	if registryRule == "" && repositoryPrefixRule == "" && rulesFile == "" {
+		return fmt.Errorf("at least one rewrite rule must be given. Please try again with --registry, --repo-prefix and/or --rules-file")
+	}
+
+	requests, err := loadChartsManifest(args[0], targetRewriteRules, output)
+	if err != nil {
+		return err
+	}
+
+	batchMover, err := mover.NewBatchMover(requests, mover.WithRetries(retries), mover.WithLogger(cmd))
+	if err != nil {
+		cmd.SilenceUsage = true
+		return err
+	}
+
+	batchMover.Print()
+
+	if !skipConfirmation {
+		cmd.Println("Would you like to proceed? (y/N)")
+		proceed, err := getConfirmation(cmd.InOrStdin())
+		if err != nil {
+			return fmt.Errorf("failed to prompt for confirmation: %w", err)
+		}
+
+		if !proceed {
+			cmd.Println("Aborting")
+			return nil
+		}
+	}
+
+	results, err := batchMover.Move()
+	cmd.Println("\nResults:")
+	for _, result := range results {
+		if result.Err != nil {
+			cmd.Printf(" %s: failed: %s\n", result.Chart, result.Err)
+		} else {
+			cmd.Printf(" %s: relocated\n", result.Chart)
+		}
+	}
+	cmd.SilenceUsage = true
+	return err
+}
+
+// loadChartsManifest reads the manifest file into a move request per chart,
+// all of them sharing the same rewrite rules
+func loadChartsManifest(manifestPath string, rules *mover.RewriteRules, defaultOut string) ([]*mover.ChartMoveRequest, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read charts manifest: %w", err)
+	}
+	manifest := &chartsManifest{}
+	if err := yaml.UnmarshalStrict(data, manifest); err != nil {
+		return nil, fmt.Errorf("charts manifest is not in the correct format: %w", err)
+	}
+	if len(manifest.Charts) == 0 {
+		return nil, errors.New("charts manifest lists no charts")
+	}
+
+	dir := filepath.Dir(manifestPath)
+	requests := []*mover.ChartMoveRequest{}
+	for i, entry := range manifest.Charts {
+		req, err := manifestChartRequest(entry, dir, rules, defaultOut)
+		if err != nil {
+			return nil, fmt.Errorf("invalid charts manifest entry #%d: %w", i+1, err)
+		}
+		requests = append(requests, req)
+	}
+	return requests, nil
+}
+
+func manifestChartRequest(entry *manifestChart, dir string, rules *mover.RewriteRules, defaultOut string) (*mover.ChartMoveRequest, error) {
+	if entry.Chart == "" {
+		return nil, errors.New("missing chart")
+	}
+	if entry.Version != "" && entry.Repo == "" {
+		return nil, errors.New("version requires a chart repository, please set repo")
+	}
+
+	out := defaultOut
+	if entry.Out != "" {
+		out = relativeTo(dir, entry.Out)
+	}
+	outputPathFmt, err := parseOutputFlag(out)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &mover.ChartMoveRequest{
+		Source: mover.Source{
+			// Use local keychain for authentication
+			ContainersAuth:   &mover.ContainersAuth{UseDefaultLocalKeychain: true},
+			RelocateDisabled: relocateDisabled,
+		},
+		Target: mover.Target{
+			Chart:          mover.ChartSpec{Local: &mover.LocalChart{Path: outputPathFmt}},
+			Rules:          *rules,
+			ContainersAuth: &mover.ContainersAuth{UseDefaultLocalKeychain: true},
+		},
+	}
+	if entry.ImagePatterns != "" {
+		req.Source.ImageHintsFile = relativeTo(dir, entry.ImagePatterns)
+		req.Source.MergeHints = mergeHints
+	}
+
+	if entry.Repo != "" {
+		req.Source.Chart.Repository = &mover.RepositoryChart{URL: entry.Repo, Name: entry.Chart, Version: entry.Version}
+	} else if mover.IsOCIChart(entry.Chart) {
+		req.Source.Chart.OCI = &mover.OCIChart{Reference: entry.Chart}
+	} else {
+		req.Source.Chart.Local = &mover.LocalChart{Path: relativeTo(dir, entry.Chart)}
+	}
+	return req, nil
+}
+
+// relativeTo resolves relative paths from the given directory
+func relativeTo(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
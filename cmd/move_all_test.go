@@ -0,0 +1,81 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/pkg/mover"
+)
+
+var _ = Describe("Move all", func() {
+	Describe("loadChartsManifest", func() {
+		var dir string
+		rules := &mover.RewriteRules{Registry: "my-registry.company.com"}
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "manifest-test-*")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		writeManifest := func(contents string) string {
+			manifestPath := filepath.Join(dir, "charts.yaml")
+			Expect(os.WriteFile(manifestPath, []byte(contents), 0644)).To(Succeed())
+			return manifestPath
+		}
+
+		It("builds a move request per chart", func() {
+			manifestPath := writeManifest(`charts:
+- chart: mariadb
+  imagePatterns: mariadb.images.yaml
+  out: relocated/*.tgz
+- chart: mysql
+  repo: https://charts.bitnami.com/bitnami
+  version: 8.x
+- chart: oci://registry.example.com/charts/redis:17.0.0
+`)
+			requests, err := loadChartsManifest(manifestPath, rules, "*.relocated.tgz")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(requests).To(HaveLen(3))
+
+			Expect(requests[0].Source.Chart.Local.Path).To(Equal(filepath.Join(dir, "mariadb")))
+			Expect(requests[0].Source.ImageHintsFile).To(Equal(filepath.Join(dir, "mariadb.images.yaml")))
+			Expect(requests[0].Target.Chart.Local.Path).To(Equal(filepath.Join(dir, "relocated", "%s-%s.tgz")))
+
+			Expect(requests[1].Source.Chart.Repository).To(Equal(&mover.RepositoryChart{
+				URL: "https://charts.bitnami.com/bitnami", Name: "mysql", Version: "8.x",
+			}))
+			Expect(requests[1].Target.Chart.Local.Path).To(Equal("%s-%s.relocated.tgz"))
+
+			Expect(requests[2].Source.Chart.OCI.Reference).To(Equal("oci://registry.example.com/charts/redis:17.0.0"))
+			for _, req := range requests {
+				Expect(req.Target.Rules).To(Equal(*rules))
+			}
+		})
+
+		It("rejects manifests without charts", func() {
+			_, err := loadChartsManifest(writeManifest("charts: []\n"), rules, "*.relocated.tgz")
+			Expect(err).To(MatchError("charts manifest lists no charts"))
+		})
+
+		It("rejects unknown fields", func() {
+			_, err := loadChartsManifest(writeManifest("charts:\n- chart: mariadb\n  hints: foo.yaml\n"), rules, "*.relocated.tgz")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects outputs without placeholder", func() {
+			_, err := loadChartsManifest(writeManifest("charts:\n- chart: mariadb\n  out: mariadb.tgz\n"), rules, "*.relocated.tgz")
+			Expect(err).To(MatchError(errMissingOutPlaceHolder))
+		})
+	})
+})
@@ -0,0 +1,197 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/pkg/mover"
+)
+
+// targetsFile lists the targets chart move relocates the chart to, i.e
+//
+//	targets:
+//	- registry: eu.registry.example.com
+//	  repoPrefix: charts
+//	  out: relocated/eu/*.tgz
+//	- registry: us.registry.example.com
+//	  out: relocated/us/*.tgz
+//	  auth:
+//	    username: robot
+//	    passwordEnv: US_REGISTRY_PASSWORD
+//
+// Relative paths are resolved from the targets file directory. Targets with no
+// auth push with the local keychain
+type targetsFile struct {
+	Targets []*fileTarget `yaml:"targets"`
+}
+
+type fileTarget struct {
+	// Registry and RepoPrefix default to --registry and --repo-prefix
+	Registry   string `yaml:"registry"`
+	RepoPrefix string `yaml:"repoPrefix"`
+	// Out follows the --out format, each target needs its own
+	Out  string          `yaml:"out"`
+	Auth *fileTargetAuth `yaml:"auth"`
+}
+
+// fileTargetAuth holds the credentials of a target registry
+type fileTargetAuth struct {
+	// Server defaults to the target registry
+	Server   string `yaml:"server"`
+	Username string `yaml:"username"`
+	// Password, or PasswordEnv the environment variable holding it, so that
+	// the targets file needs no secrets
+	Password    string `yaml:"password"`
+	PasswordEnv string `yaml:"passwordEnv"`
+}
+
+// loadTargetsFile reads the targets file into a move target per entry, all of
+// them sharing the given rules but for their registry and repository prefix
+func loadTargetsFile(path string, rules *mover.RewriteRules) ([]*mover.Target, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read targets file: %w", err)
+	}
+	file := &targetsFile{}
+	if err := yaml.UnmarshalStrict(data, file); err != nil {
+		return nil, fmt.Errorf("targets file is not in the correct format: %w", err)
+	}
+	if len(file.Targets) == 0 {
+		return nil, errors.New("targets file lists no targets")
+	}
+
+	dir := filepath.Dir(path)
+	targets := []*mover.Target{}
+	for i, entry := range file.Targets {
+		target, err := fileTargetToTarget(entry, dir, rules)
+		if err != nil {
+			return nil, fmt.Errorf("invalid targets file entry #%d: %w", i+1, err)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func fileTargetToTarget(entry *fileTarget, dir string, rules *mover.RewriteRules) (*mover.Target, error) {
+	if entry.Out == "" {
+		return nil, errors.New("missing out")
+	}
+	outputPathFmt, err := parseOutputFlag(relativeTo(dir, entry.Out))
+	if err != nil {
+		return nil, err
+	}
+
+	targetRules := *rules
+	if entry.Registry != "" {
+		targetRules.Registry = entry.Registry
+	}
+	if entry.RepoPrefix != "" {
+		targetRules.RepositoryPrefix = entry.RepoPrefix
+	}
+	if targetRules.Registry == "" && targetRules.RepositoryPrefix == "" && len(targetRules.Mappings) == 0 {
+		return nil, errors.New("missing registry or repoPrefix")
+	}
+	if err := targetRules.Validate(); err != nil {
+		return nil, err
+	}
+
+	auth, err := fileTargetAuthToContainersAuth(entry.Auth, targetRules.Registry)
+	if err != nil {
+		return nil, err
+	}
+
+	target := &mover.Target{
+		Chart:          mover.ChartSpec{Local: &mover.LocalChart{Path: outputPathFmt}},
+		Rules:          targetRules,
+		ContainersAuth: auth,
+	}
+	if pushChart {
+		target.Chart.OCI = &mover.OCIChart{}
+	}
+	if keepDependencies || dependencyRepo != "" {
+		target.Dependencies = &mover.RelocatedDependencies{Repository: dependencyRepo}
+	}
+	return target, nil
+}
+
+// fileTargetAuthToContainersAuth returns the credentials of the target, the
+// local keychain if the entry sets none
+func fileTargetAuthToContainersAuth(auth *fileTargetAuth, registry string) (*mover.ContainersAuth, error) {
+	if auth == nil {
+		return &mover.ContainersAuth{UseDefaultLocalKeychain: true}, nil
+	}
+	if auth.Password != "" && auth.PasswordEnv != "" {
+		return nil, errors.New("auth sets both password and passwordEnv")
+	}
+	password := auth.Password
+	if auth.PasswordEnv != "" {
+		password = os.Getenv(auth.PasswordEnv)
+		if password == "" {
+			return nil, fmt.Errorf("auth password environment variable %s is not set", auth.PasswordEnv)
+		}
+	}
+	server := auth.Server
+	if server == "" {
+		server = registry
+	}
+	if auth.Username == "" || password == "" || server == "" {
+		return nil, errors.New("auth requires a username, a password and a server or registry")
+	}
+	return &mover.ContainersAuth{
+		Credentials: &mover.OCICredentials{Server: server, Username: auth.Username, Password: password},
+	}, nil
+}
+
+// moveChartToTargets relocates the chart of the request to each of the
+// targets of the --targets-file, reporting the result of each target
+func moveChartToTargets(cmd *cobra.Command, req *mover.ChartMoveRequest, rules *mover.RewriteRules) error {
+	if toArchive != "" || toRepoDir != "" || toChartMuseum != "" || toKustomize != "" || toValues != "" || cmd.Flags().Changed("out") {
+		return errors.New("--targets-file can only be combined with --push-chart and the dependency flags, its targets are written to their out path")
+	}
+	targets, err := loadTargetsFile(targetsFilePath, rules)
+	if err != nil {
+		return err
+	}
+	req.Targets = targets
+
+	targetsMover, err := mover.NewMultiTargetMover(req, mover.WithRetries(retries), mover.WithLogger(cmd))
+	if err != nil {
+		cmd.SilenceUsage = true
+		return err
+	}
+
+	targetsMover.Print()
+
+	if !skipConfirmation {
+		cmd.Println("Would you like to proceed? (y/N)")
+		proceed, err := getConfirmation(cmd.InOrStdin())
+		if err != nil {
+			return fmt.Errorf("failed to prompt for confirmation: %w", err)
+		}
+
+		if !proceed {
+			cmd.Println("Aborting")
+			return nil
+		}
+	}
+
+	results, err := targetsMover.Move()
+	cmd.Println("\nResults:")
+	for _, result := range results {
+		if result.Err != nil {
+			cmd.Printf(" %s: failed: %s\n", result.Target, result.Err)
+		} else {
+			cmd.Printf(" %s: relocated\n", result.Target)
+		}
+	}
+	cmd.SilenceUsage = true
+	return err
+}
@@ -0,0 +1,113 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/pkg/mover"
+)
+
+var _ = Describe("Targets file", func() {
+	Describe("loadTargetsFile", func() {
+		var dir string
+		rules := &mover.RewriteRules{RepositoryPrefix: "charts", TagStrategy: mover.TagStrategyChartVersion}
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "targets-test-*")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		writeTargets := func(contents string) string {
+			targetsPath := filepath.Join(dir, "targets.yaml")
+			Expect(os.WriteFile(targetsPath, []byte(contents), 0644)).To(Succeed())
+			return targetsPath
+		}
+
+		It("builds a target per entry", func() {
+			targetsPath := writeTargets(`targets:
+- registry: eu.registry.example.com
+  out: relocated/eu/*.tgz
+- registry: us.registry.example.com
+  repoPrefix: us-charts
+  out: relocated/us/*.tgz
+`)
+			targets, err := loadTargetsFile(targetsPath, rules)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(targets).To(HaveLen(2))
+
+			Expect(targets[0].Chart.Local.Path).To(Equal(filepath.Join(dir, "relocated", "eu", "%s-%s.tgz")))
+			Expect(targets[0].Rules.Registry).To(Equal("eu.registry.example.com"))
+			Expect(targets[0].Rules.RepositoryPrefix).To(Equal("charts"))
+			Expect(targets[0].Rules.TagStrategy).To(Equal(mover.TagStrategyChartVersion))
+
+			Expect(targets[1].Chart.Local.Path).To(Equal(filepath.Join(dir, "relocated", "us", "%s-%s.tgz")))
+			Expect(targets[1].Rules.Registry).To(Equal("us.registry.example.com"))
+			Expect(targets[1].Rules.RepositoryPrefix).To(Equal("us-charts"))
+		})
+
+		It("uses the credentials of each target", func() {
+			os.Setenv("TARGETS_TEST_PASSWORD", "secret")
+			defer os.Unsetenv("TARGETS_TEST_PASSWORD")
+			targetsPath := writeTargets(`targets:
+- registry: eu.registry.example.com
+  out: relocated/eu/*.tgz
+  auth:
+    username: robot
+    passwordEnv: TARGETS_TEST_PASSWORD
+- registry: us.registry.example.com
+  out: relocated/us/*.tgz
+  auth:
+    server: us.registry.example.com:5000
+    username: admin
+    password: pass
+- registry: local.registry.example.com
+  out: relocated/local/*.tgz
+`)
+			targets, err := loadTargetsFile(targetsPath, rules)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(targets).To(HaveLen(3))
+
+			Expect(targets[0].ContainersAuth).To(Equal(&mover.ContainersAuth{
+				Credentials: &mover.OCICredentials{Server: "eu.registry.example.com", Username: "robot", Password: "secret"},
+			}))
+			Expect(targets[1].ContainersAuth).To(Equal(&mover.ContainersAuth{
+				Credentials: &mover.OCICredentials{Server: "us.registry.example.com:5000", Username: "admin", Password: "pass"},
+			}))
+			Expect(targets[2].ContainersAuth).To(Equal(&mover.ContainersAuth{UseDefaultLocalKeychain: true}))
+		})
+
+		It("rejects incomplete credentials", func() {
+			_, err := loadTargetsFile(writeTargets("targets:\n- registry: eu.registry.example.com\n  out: relocated/*.tgz\n  auth:\n    username: robot\n"), rules)
+			Expect(err).To(MatchError("invalid targets file entry #1: auth requires a username, a password and a server or registry"))
+
+			_, err = loadTargetsFile(writeTargets("targets:\n- registry: eu.registry.example.com\n  out: relocated/*.tgz\n  auth:\n    username: robot\n    passwordEnv: TARGETS_TEST_UNSET\n"), rules)
+			Expect(err).To(MatchError("invalid targets file entry #1: auth password environment variable TARGETS_TEST_UNSET is not set"))
+		})
+
+		It("rejects files without targets", func() {
+			_, err := loadTargetsFile(writeTargets("targets: []\n"), rules)
+			Expect(err).To(MatchError("targets file lists no targets"))
+		})
+
+		It("rejects targets without output", func() {
+			_, err := loadTargetsFile(writeTargets("targets:\n- registry: eu.registry.example.com\n"), rules)
+			Expect(err).To(MatchError("invalid targets file entry #1: missing out"))
+		})
+
+		It("rejects targets without rewrite rules", func() {
+			_, err := loadTargetsFile(writeTargets("targets:\n- out: relocated/*.tgz\n"), &mover.RewriteRules{})
+			Expect(err).To(MatchError("invalid targets file entry #1: missing registry or repoPrefix"))
+		})
+	})
+})
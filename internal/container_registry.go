@@ -16,6 +16,7 @@ import (
 type ContainerRegistryInterface interface {
 	Check(digest string, imageReference name.Reference) (bool, error)
 	Pull(imageReference name.Reference) (v1.Image, string, error)
+	PullPlatform(imageReference name.Reference, platform *v1.Platform) (v1.Image, string, error)
 	Push(image v1.Image, dest name.Reference) error
 }
 
@@ -41,6 +42,21 @@ func (i *ContainerRegistryClient) Pull(imageReference name.Reference) (v1.Image,
 	return image, digest.String(), nil
 }
 
+// PullPlatform pulls the image of the given platform from a multi-platform image index
+func (i *ContainerRegistryClient) PullPlatform(imageReference name.Reference, platform *v1.Platform) (v1.Image, string, error) {
+	image, err := remote.Image(imageReference, remote.WithAuthFromKeychain(i.auth), remote.WithPlatform(*platform))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to pull image %s for platform %s: %w", imageReference.Name(), platform, err)
+	}
+
+	digest, err := image.Digest()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get image digest for %s: %w", imageReference.Name(), err)
+	}
+
+	return image, digest.String(), nil
+}
+
 func (i *ContainerRegistryClient) Check(digest string, imageReference name.Reference) (bool, error) {
 	_, remoteDigest, err := i.Pull(imageReference)
 
@@ -0,0 +1,120 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package internal
+
+import (
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// GlobalImageRegistryPath is the global value Bitnami style charts use to
+// override the registry of every image, in the chart and its subcharts
+const GlobalImageRegistryPath = ".global.imageRegistry"
+
+// chartValues returns the values the chart templates see: the chart values
+// with the subcharts values, the rewrite actions applied and the globals
+// propagated to the subcharts
+func chartValues(chart *chart.Chart, rewriteActions []*RewriteAction) (map[string]interface{}, error) {
+	values, err := applyRewrites(buildValuesMap(chart), rewriteActions)
+	if err != nil {
+		return nil, err
+	}
+	return propagateGlobals(chart, values), nil
+}
+
+// propagateGlobals copies the global values of the chart into the global
+// values of each subchart, as Helm does, the parent globals taking precedence.
+// The given values are left untouched
+func propagateGlobals(chart *chart.Chart, values map[string]interface{}) map[string]interface{} {
+	globals, _ := asValuesMap(values["global"])
+	result := copyValues(values)
+	for _, dependency := range chart.Dependencies() {
+		for _, key := range SubchartValuesKeys(chart, dependency) {
+			subchartValues, ok := asValuesMap(result[key])
+			if !ok {
+				continue
+			}
+			subchartValues = copyValues(subchartValues)
+			if len(globals) > 0 {
+				subchartGlobals, _ := asValuesMap(subchartValues["global"])
+				subchartValues["global"] = coalesceGlobals(subchartGlobals, globals)
+			}
+			result[key] = propagateGlobals(dependency, subchartValues)
+		}
+	}
+	return result
+}
+
+// coalesceGlobals merges the parent globals into the subchart ones, merging
+// the maps both define
+func coalesceGlobals(subchartGlobals, globals map[string]interface{}) map[string]interface{} {
+	result := copyValues(subchartGlobals)
+	for key, value := range globals {
+		valueMap, isMap := asValuesMap(value)
+		subchartMap, subchartIsMap := asValuesMap(result[key])
+		if isMap && subchartIsMap {
+			result[key] = coalesceGlobals(subchartMap, valueMap)
+			continue
+		}
+		result[key] = value
+	}
+	return result
+}
+
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		result[key] = value
+	}
+	return result
+}
+
+// GlobalImageRegistry returns the global.imageRegistry overriding the template
+// registry, as seen by the chart or subchart its registry values path belongs
+// to. It is empty if the template has no registry placeholder or no global
+// registry is set
+func (t *ImageTemplate) GlobalImageRegistry(chart *chart.Chart) string {
+	values, err := chartValues(chart, nil)
+	if err != nil {
+		return ""
+	}
+	return t.globalImageRegistry(chart, values)
+}
+
+func (t *ImageTemplate) globalImageRegistry(chart *chart.Chart, values map[string]interface{}) string {
+	if t.RegistryTemplate == "" {
+		return ""
+	}
+	keys, err := ParseValuesPath(t.RegistryTemplate)
+	if err != nil {
+		return ""
+	}
+
+	// The global seen by the deepest subchart in the path
+	globalKeys := []interface{}{}
+	current := chart
+	for _, key := range keys[:len(keys)-1] {
+		subchart := findSubchart(current, key)
+		if subchart == nil {
+			break
+		}
+		globalKeys = append(globalKeys, key)
+		current = subchart
+	}
+	globalKeys = append(globalKeys, "global", "imageRegistry")
+
+	value, _ := lookupKeys(values, globalKeys)
+	registry, _ := value.(string)
+	return registry
+}
+
+func findSubchart(chart *chart.Chart, key interface{}) *chart.Chart {
+	for _, dependency := range chart.Dependencies() {
+		for _, valuesKey := range SubchartValuesKeys(chart, dependency) {
+			if valuesKey == key {
+				return dependency
+			}
+		}
+	}
+	return nil
+}
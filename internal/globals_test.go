@@ -0,0 +1,90 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package internal_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/chart"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/test"
+)
+
+var _ = Describe("Global values", func() {
+	globalsChart := func(globalRegistry string) *test.ChartSeed {
+		return &test.ChartSeed{
+			Values: map[string]interface{}{
+				"global": map[string]interface{}{
+					"imageRegistry": globalRegistry,
+					"storageClass":  "standard",
+				},
+				"image": map[string]interface{}{"registry": "docker.io", "repository": "bitnami/wordpress", "tag": "6.0.0"},
+			},
+			Dependencies: []*test.ChartSeed{{
+				Name: "mariadb",
+				Values: map[string]interface{}{
+					"global": map[string]interface{}{"imageRegistry": "", "labels": map[string]interface{}{"team": "db"}},
+					"image":  map[string]interface{}{"registry": "docker.io", "repository": "bitnami/mariadb", "tag": "10.6.8"},
+				},
+			}},
+		}
+	}
+
+	It("propagates the chart globals to the subcharts, the parent taking precedence", func() {
+		c := test.MakeChart(globalsChart("my-registry.io"))
+
+		value, ok := internal.LookupValue(c, ".mariadb.global.imageRegistry")
+		Expect(ok).To(BeTrue())
+		Expect(value).To(Equal("my-registry.io"))
+		value, _ = internal.LookupValue(c, ".mariadb.global.storageClass")
+		Expect(value).To(Equal("standard"))
+		value, _ = internal.LookupValue(c, ".mariadb.global.labels.team")
+		Expect(value).To(Equal("db"))
+	})
+
+	It("sets the values of aliased subcharts under their aliases", func() {
+		c := test.MakeChart(globalsChart("my-registry.io"))
+		c.Metadata = &chart.Metadata{Name: "wordpress", Dependencies: []*chart.Dependency{
+			{Name: "mariadb", Alias: "primary"},
+			{Name: "mariadb", Alias: "replica"},
+		}}
+		c.Values["replica"] = map[string]interface{}{"image": map[string]interface{}{"tag": "10.6.9"}}
+
+		_, ok := internal.LookupValue(c, ".mariadb.image.tag")
+		Expect(ok).To(BeFalse())
+		value, _ := internal.LookupValue(c, ".primary.image.tag")
+		Expect(value).To(Equal("10.6.8"))
+		value, _ = internal.LookupValue(c, ".replica.image.tag")
+		Expect(value).To(Equal("10.6.9"))
+		value, _ = internal.LookupValue(c, ".replica.global.imageRegistry")
+		Expect(value).To(Equal("my-registry.io"))
+	})
+
+	It("renders the image registries overridden by global.imageRegistry", func() {
+		c := test.MakeChart(globalsChart("my-registry.io"))
+		template, err := internal.NewFromString("{{ .mariadb.image.registry }}/{{ .mariadb.image.repository }}:{{ .mariadb.image.tag }}")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(template.GlobalImageRegistry(c)).To(Equal("my-registry.io"))
+
+		image, err := template.Render(c)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(image.Name()).To(Equal("my-registry.io/bitnami/mariadb:10.6.8"))
+
+		image, err = template.Render(c, &internal.RewriteAction{Path: internal.GlobalImageRegistryPath, Value: "harbor-repo.vmware.com"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(image.Name()).To(Equal("harbor-repo.vmware.com/bitnami/mariadb:10.6.8"))
+	})
+
+	It("renders the image registries as is with an empty global.imageRegistry", func() {
+		c := test.MakeChart(globalsChart(""))
+		template, err := internal.NewFromString("{{ .image.registry }}/{{ .image.repository }}:{{ .image.tag }}")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(template.GlobalImageRegistry(c)).To(BeEmpty())
+
+		image, err := template.Render(c)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(image.Name()).To(Equal("index.docker.io/bitnami/wordpress:6.0.0"))
+	})
+})
@@ -16,6 +16,8 @@ type ImageChange struct {
 	Digest             string
 	Tag                string
 	AlreadyPushed      bool
+	// Rule describes the mapping rule choosing where the image moves to, if any
+	Rule string
 }
 
 func (change *ImageChange) ShouldPush() bool {
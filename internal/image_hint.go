@@ -0,0 +1,219 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"gopkg.in/yaml.v2"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// ImageHintsV2 is the version of the structured image hints format
+const ImageHintsV2 = 2
+
+// ImageHintsDocument is the structured (v2) image hints format, where each
+// image sets the values paths of its parts explicitly
+type ImageHintsDocument struct {
+	Version int          `yaml:"version"`
+	Images  []*ImageHint `yaml:"images"`
+}
+
+// ImageHint locates an image in the chart values. Either Reference, holding
+// the registry and repository together, or Repository must be set. Without a
+// Registry, the Repository is relocated as a Reference, registry included.
+// Images hardcoded in a chart template set the Template file and the Image
+// reference instead
+type ImageHint struct {
+	Registry   string `yaml:"registry,omitempty"`
+	Repository string `yaml:"repository,omitempty"`
+	Tag        string `yaml:"tag,omitempty"`
+	Digest     string `yaml:"digest,omitempty"`
+	Reference  string `yaml:"reference,omitempty"`
+	// Optional images are skipped when their values are not set
+	Optional bool `yaml:"optional,omitempty"`
+	// Condition is a boolean values path, the image is skipped when false
+	Condition string `yaml:"condition,omitempty"`
+	// Platforms of the image to relocate, i.e linux/arm64
+	Platforms []string `yaml:"platforms,omitempty"`
+	// Template is a chart template file, i.e templates/tests/test.yaml,
+	// hardcoding the Image reference, i.e busybox:1.36
+	Template string `yaml:"template,omitempty"`
+	Image    string `yaml:"image,omitempty"`
+}
+
+// NewFromHint creates the image template of a structured hint
+func NewFromHint(hint *ImageHint) (*ImageTemplate, error) {
+	for _, path := range []string{hint.Registry, hint.Repository, hint.Tag, hint.Digest, hint.Reference, hint.Condition} {
+		if path != "" && !strings.HasPrefix(path, ".") {
+			return nil, fmt.Errorf("invalid image hint values path %q: it must start with a dot", path)
+		}
+	}
+
+	if len(hint.Platforms) > 1 {
+		return nil, fmt.Errorf("invalid image hint: relocating several platforms of an image is not supported, got %s", strings.Join(hint.Platforms, ", "))
+	}
+	for _, platform := range hint.Platforms {
+		if _, err := v1.ParsePlatform(platform); err != nil {
+			return nil, fmt.Errorf("invalid image hint platform %q: %w", platform, err)
+		}
+	}
+
+	if hint.Template != "" || hint.Image != "" {
+		if hint.Registry != "" || hint.Repository != "" || hint.Tag != "" || hint.Digest != "" || hint.Reference != "" {
+			return nil, errors.New("invalid image hint: template images cannot be combined with values paths")
+		}
+		template, err := NewFromTemplateImage(hint.Template, hint.Image)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image hint: %w", err)
+		}
+		template.Optional = hint.Optional
+		template.Condition = hint.Condition
+		template.Platforms = hint.Platforms
+		return template, nil
+	}
+
+	template := &ImageTemplate{
+		RegistryTemplate:              hint.Registry,
+		RepositoryTemplate:            hint.Repository,
+		RegistryAndRepositoryTemplate: hint.Reference,
+		TagTemplate:                   hint.Tag,
+		DigestTemplate:                hint.Digest,
+		Optional:                      hint.Optional,
+		Condition:                     hint.Condition,
+		Platforms:                     hint.Platforms,
+	}
+	switch {
+	case hint.Reference != "" && (hint.Registry != "" || hint.Repository != ""):
+		return nil, errors.New("invalid image hint: reference cannot be combined with registry or repository")
+	case hint.Reference == "" && hint.Repository == "":
+		return nil, errors.New("invalid image hint: either reference or repository is required")
+	case hint.Repository != "" && hint.Registry == "":
+		// A lone repository holds the registry too
+		template.RegistryAndRepositoryTemplate = hint.Repository
+		template.RepositoryTemplate = ""
+	}
+
+	// The template is built from the parsed values paths of each part, the
+	// paths are never parsed back from the pattern
+	parts := []struct{ separator, path string }{
+		{"", template.RegistryTemplate},
+		{"/", template.RepositoryTemplate},
+		{"", template.RegistryAndRepositoryTemplate},
+		{":", template.TagTemplate},
+		{"@", template.DigestTemplate},
+	}
+	raw, text := "", ""
+	for _, part := range parts {
+		if part.path == "" {
+			continue
+		}
+		keys, err := ParseValuesPath(part.path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image hint values path %q: %w", part.path, err)
+		}
+		raw += fmt.Sprintf("%s{{ %s }}", part.separator, part.path)
+		text += fmt.Sprintf("%s{{ %s }}", part.separator, indexCall(keys))
+	}
+	parsed, err := template.parse(raw, text)
+	if err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// Hint returns the structured hint of the template
+func (t *ImageTemplate) Hint() *ImageHint {
+	return &ImageHint{
+		Registry:   t.RegistryTemplate,
+		Repository: t.RepositoryTemplate,
+		Tag:        t.TagTemplate,
+		Digest:     t.DigestTemplate,
+		Reference:  t.RegistryAndRepositoryTemplate,
+		Optional:   t.Optional,
+		Condition:  t.Condition,
+		Platforms:  t.Platforms,
+		Template:   t.TemplateFile,
+		Image:      t.TemplateImage,
+	}
+}
+
+// Structured tells if the template uses options only the v2 format supports
+func (t *ImageTemplate) Structured() bool {
+	return t.Optional || t.Condition != "" || len(t.Platforms) > 0 || t.TemplateImage != ""
+}
+
+// Enabled tells if the template condition, if any, holds in the chart values.
+// As Helm does for dependency conditions, a missing or non boolean condition
+// value leaves the image enabled
+func (t *ImageTemplate) Enabled(chart *chart.Chart) bool {
+	if t.Condition == "" {
+		return true
+	}
+	value, _ := LookupValue(chart, t.Condition)
+	enabled, ok := value.(bool)
+	return !ok || enabled
+}
+
+// EncodeImagePatterns writes the templates as an image hints file, in the
+// legacy list of strings format or the structured format for v2
+func EncodeImagePatterns(templates []*ImageTemplate, version int) ([]byte, error) {
+	if version == ImageHintsV2 {
+		doc := &ImageHintsDocument{Version: ImageHintsV2, Images: []*ImageHint{}}
+		for _, template := range templates {
+			doc.Images = append(doc.Images, template.Hint())
+		}
+		data, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode image hints: %w", err)
+		}
+		return append([]byte("---\n"), data...), nil
+	}
+
+	out := bytes.Buffer{}
+	out.WriteString("---\n")
+	for _, template := range templates {
+		if template.Structured() {
+			return nil, fmt.Errorf("image hint %q has options that require the v2 format", template.Raw)
+		}
+		fmt.Fprintf(&out, "- %q\n", template.Raw)
+	}
+	return out.Bytes(), nil
+}
+
+// isStructuredHints tells if the hints document is in the v2 format, a map
+// instead of a list of patterns
+func isStructuredHints(patterns []byte) bool {
+	var doc interface{}
+	if err := yaml.Unmarshal(patterns, &doc); err != nil {
+		return false
+	}
+	_, isMap := doc.(map[interface{}]interface{})
+	return isMap
+}
+
+// parseStructuredHints reads a v2 image hints document
+func parseStructuredHints(patterns []byte) ([]*ImageTemplate, error) {
+	doc := &ImageHintsDocument{}
+	if err := yaml.UnmarshalStrict(patterns, doc); err != nil {
+		return nil, fmt.Errorf("image pattern file is not in the correct format: %w", err)
+	}
+	if doc.Version != ImageHintsV2 {
+		return nil, fmt.Errorf("unsupported image hints version %d", doc.Version)
+	}
+
+	templates := []*ImageTemplate{}
+	for i, hint := range doc.Images {
+		template, err := NewFromHint(hint)
+		if err != nil {
+			return nil, fmt.Errorf("image hint #%d: %w", i+1, err)
+		}
+		templates = append(templates, template)
+	}
+	return templates, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package internal_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/test"
+)
+
+var _ = Describe("Structured image hints", func() {
+	const structuredHints = `---
+version: 2
+images:
+- registry: .image.registry
+  repository: .image.repository
+  tag: .image.tag
+- reference: .metrics.image
+  optional: true
+  condition: .metrics.enabled
+  platforms:
+  - linux/arm64
+`
+
+	It("parses the explicit fields of each image", func() {
+		templates, err := internal.ParseImagePatterns([]byte(structuredHints))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(templates).To(HaveLen(2))
+
+		Expect(templates[0].Raw).To(Equal("{{ .image.registry }}/{{ .image.repository }}:{{ .image.tag }}"))
+		Expect(templates[0].RegistryTemplate).To(Equal(".image.registry"))
+		Expect(templates[0].RepositoryTemplate).To(Equal(".image.repository"))
+		Expect(templates[0].TagTemplate).To(Equal(".image.tag"))
+		Expect(templates[0].Structured()).To(BeFalse())
+
+		Expect(templates[1].Raw).To(Equal("{{ .metrics.image }}"))
+		Expect(templates[1].RegistryAndRepositoryTemplate).To(Equal(".metrics.image"))
+		Expect(templates[1].Optional).To(BeTrue())
+		Expect(templates[1].Condition).To(Equal(".metrics.enabled"))
+		Expect(templates[1].Platforms).To(Equal([]string{"linux/arm64"}))
+	})
+
+	It("converts between the legacy and the structured formats", func() {
+		legacy, err := internal.ParseImagePatterns([]byte(`- "{{ .image.registry }}/{{ .image.repository }}:{{ .image.tag }}"`))
+		Expect(err).ToNot(HaveOccurred())
+
+		data, err := internal.EncodeImagePatterns(legacy, internal.ImageHintsV2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal(`---
+version: 2
+images:
+- registry: .image.registry
+  repository: .image.repository
+  tag: .image.tag
+`))
+
+		structured, err := internal.ParseImagePatterns(data)
+		Expect(err).ToNot(HaveOccurred())
+		data, err = internal.EncodeImagePatterns(structured, 1)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("---\n- \"{{ .image.registry }}/{{ .image.repository }}:{{ .image.tag }}\"\n"))
+	})
+
+	It("cannot convert structured options to the legacy format", func() {
+		templates, err := internal.ParseImagePatterns([]byte(structuredHints))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = internal.EncodeImagePatterns(templates, 1)
+		Expect(err).To(MatchError(ContainSubstring("require the v2 format")))
+	})
+
+	It("rejects invalid hints", func() {
+		_, err := internal.ParseImagePatterns([]byte("version: 2\nimages:\n- tag: .image.tag\n"))
+		Expect(err).To(MatchError("image hint #1: invalid image hint: either reference or repository is required"))
+
+		_, err = internal.ParseImagePatterns([]byte("version: 2\nimages:\n- reference: .image\n  registry: .registry\n"))
+		Expect(err).To(MatchError(ContainSubstring("reference cannot be combined")))
+
+		_, err = internal.ParseImagePatterns([]byte("version: 2\nimages:\n- reference: image\n"))
+		Expect(err).To(MatchError(ContainSubstring("it must start with a dot")))
+
+		_, err = internal.ParseImagePatterns([]byte("version: 2\nimages:\n- reference: .image\n  platforms: [linux/amd64, linux/arm64]\n"))
+		Expect(err).To(MatchError(ContainSubstring("relocating several platforms of an image is not supported")))
+
+		_, err = internal.ParseImagePatterns([]byte("version: 3\nimages: []\n"))
+		Expect(err).To(MatchError("unsupported image hints version 3"))
+	})
+
+	It("evaluates the condition against the chart values", func() {
+		template, err := internal.NewFromHint(&internal.ImageHint{Reference: ".metrics.image", Condition: ".metrics.enabled"})
+		Expect(err).ToNot(HaveOccurred())
+
+		chart := test.MakeChart(&test.ChartSeed{Values: map[string]interface{}{
+			"metrics": map[string]interface{}{"enabled": false},
+		}})
+		Expect(template.Enabled(chart)).To(BeFalse())
+
+		chart = test.MakeChart(&test.ChartSeed{Values: map[string]interface{}{}})
+		Expect(template.Enabled(chart)).To(BeTrue())
+	})
+})
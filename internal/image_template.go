@@ -6,7 +6,6 @@ package internal
 import (
 	"fmt"
 	"regexp"
-	"strings"
 	"text/template"
 
 	"gopkg.in/yaml.v2"
@@ -28,30 +27,78 @@ type ImageTemplate struct {
 	RegistryAndRepositoryTemplate string
 	TagTemplate                   string
 	DigestTemplate                string
+
+	// Options of the structured (v2) hints format
+	Optional  bool
+	Condition string
+	Platforms []string
+
+	// An image hardcoded in a chart template file instead of set in values
+	TemplateFile  string
+	TemplateImage string
 }
 
 func (t *ImageTemplate) String() string {
 	return t.Raw
 }
 
-func prepTemplateString(input string) string {
+// Paths returns the values paths of the template placeholders, in order
+func (t *ImageTemplate) Paths() []string {
+	paths := []string{}
+	for _, match := range TemplateRegex.FindAllStringSubmatch(t.Raw, -1) {
+		paths = append(paths, match[1])
+	}
+	return paths
+}
+
+// prepTemplateString turns each values path of the input into an index call,
+// i.e. {{ .sidecars[0].image }} into {{ index . "sidecars" 0 "image" }}
+func prepTemplateString(input string) (string, error) {
 	output := ""
 	matches := TemplateRegex.FindAllStringSubmatchIndex(input, -1)
 	start := 0
 	for _, match := range matches {
-		output += input[start:match[2]] + "index ."
-		parts := strings.Split(input[match[2]+1:match[3]], ".")
-		for _, part := range parts {
-			output += " \"" + part + "\""
+		keys, err := ParseValuesPath(input[match[2]:match[3]])
+		if err != nil {
+			return "", err
 		}
+		output += input[start:match[2]] + indexCall(keys)
 		start = match[3]
 	}
 	output += input[start:]
-	return output
+	return output, nil
+}
+
+// indexCall returns the template index call looking up the values path keys
+func indexCall(keys []interface{}) string {
+	call := "index ."
+	for _, key := range keys {
+		if index, isIndex := key.(int); isIndex {
+			call += fmt.Sprintf(" %d", index)
+		} else {
+			call += fmt.Sprintf(" %q", key)
+		}
+	}
+	return call
+}
+
+// parse sets the raw pattern of the template and parses its text, made of
+// index calls
+func (t *ImageTemplate) parse(raw, text string) (*ImageTemplate, error) {
+	temp, err := template.New(text).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image template \"%s\": %w", raw, err)
+	}
+	t.Raw = raw
+	t.Template = temp
+	return t, nil
 }
 
 func NewFromString(input string) (*ImageTemplate, error) {
-	preppedInput := prepTemplateString(input)
+	preppedInput, err := prepTemplateString(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image template \"%s\": %w", input, err)
+	}
 	temp, err := template.New(preppedInput).Parse(preppedInput)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse image template \"%s\": %w", input, err)
@@ -94,7 +141,13 @@ func NewFromString(input string) (*ImageTemplate, error) {
 	return imageTemplate, nil
 }
 
+// ParseImagePatterns reads an image hints file, either in the legacy list of
+// template strings format or in the structured (v2) format
 func ParseImagePatterns(patterns []byte) ([]*ImageTemplate, error) {
+	if isStructuredHints(patterns) {
+		return parseStructuredHints(patterns)
+	}
+
 	var templateStrings []string
 	err := yaml.Unmarshal(patterns, &templateStrings)
 	if err != nil {
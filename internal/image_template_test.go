@@ -116,6 +116,23 @@ var _ = Describe("internal.NewFromString", func() {
 			Expect(err.Error()).To(Equal("failed to parse image template \"{{ .a }}/{{ .b }}/{{ .c }}/{{ .d }}\": more fragments than expected"))
 		})
 	})
+	Context("List items", func() {
+		It("parses successfully", func() {
+			imageTemplate, err := internal.NewFromString("{{ .sidecars[0].image.repository }}:{{ .sidecars[0].image.tag }}")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(imageTemplate.RegistryAndRepositoryTemplate).To(Equal(".sidecars[0].image.repository"))
+			Expect(imageTemplate.TagTemplate).To(Equal(".sidecars[0].image.tag"))
+			Expect(imageTemplate.Template.Name()).To(Equal("{{ index . \"sidecars\" 0 \"image\" \"repository\" }}:{{ index . \"sidecars\" 0 \"image\" \"tag\" }}"))
+		})
+	})
+
+	Context("Invalid values path", func() {
+		It("returns an error", func() {
+			_, err := internal.NewFromString("{{ .sidecars[first].image }}")
+			Expect(err).To(MatchError(ContainSubstring("invalid values path \".sidecars[first].image\"")))
+		})
+	})
+
 	Context("Subchart with dashes", func() {
 		It("parses successfully", func() {
 			imageTemplate, err := internal.NewFromString("{{ .sub-chart.image.registry }}/{{ .sub-chart.image.repository }}:{{ .sub-chart.image.tag }}")
@@ -130,6 +147,12 @@ var _ = Describe("internal.NewFromString", func() {
 			By("translating the template into index format", func() {
 				Expect(imageTemplate.Template.Name()).To(Equal("{{ index . \"sub-chart\" \"image\" \"registry\" }}/{{ index . \"sub-chart\" \"image\" \"repository\" }}:{{ index . \"sub-chart\" \"image\" \"tag\" }}"))
 			})
+
+			By("listing the values paths in order", func() {
+				Expect(imageTemplate.Paths()).To(Equal([]string{
+					".sub-chart.image.registry", ".sub-chart.image.repository", ".sub-chart.image.tag",
+				}))
+			})
 		})
 	})
 })
@@ -39,6 +39,22 @@ type FakeContainerRegistryInterface struct {
 		result2 string
 		result3 error
 	}
+	PullPlatformStub        func(name.Reference, *v1.Platform) (v1.Image, string, error)
+	pullPlatformMutex       sync.RWMutex
+	pullPlatformArgsForCall []struct {
+		arg1 name.Reference
+		arg2 *v1.Platform
+	}
+	pullPlatformReturns struct {
+		result1 v1.Image
+		result2 string
+		result3 error
+	}
+	pullPlatformReturnsOnCall map[int]struct {
+		result1 v1.Image
+		result2 string
+		result3 error
+	}
 	PushStub        func(v1.Image, name.Reference) error
 	pushMutex       sync.RWMutex
 	pushArgsForCall []struct {
@@ -187,6 +203,74 @@ func (fake *FakeContainerRegistryInterface) PullReturnsOnCall(i int, result1 v1.
 	}{result1, result2, result3}
 }
 
+func (fake *FakeContainerRegistryInterface) PullPlatform(arg1 name.Reference, arg2 *v1.Platform) (v1.Image, string, error) {
+	fake.pullPlatformMutex.Lock()
+	ret, specificReturn := fake.pullPlatformReturnsOnCall[len(fake.pullPlatformArgsForCall)]
+	fake.pullPlatformArgsForCall = append(fake.pullPlatformArgsForCall, struct {
+		arg1 name.Reference
+		arg2 *v1.Platform
+	}{arg1, arg2})
+	stub := fake.PullPlatformStub
+	fakeReturns := fake.pullPlatformReturns
+	fake.recordInvocation("PullPlatform", []interface{}{arg1, arg2})
+	fake.pullPlatformMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3
+	}
+	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
+}
+
+func (fake *FakeContainerRegistryInterface) PullPlatformCallCount() int {
+	fake.pullPlatformMutex.RLock()
+	defer fake.pullPlatformMutex.RUnlock()
+	return len(fake.pullPlatformArgsForCall)
+}
+
+func (fake *FakeContainerRegistryInterface) PullPlatformCalls(stub func(name.Reference, *v1.Platform) (v1.Image, string, error)) {
+	fake.pullPlatformMutex.Lock()
+	defer fake.pullPlatformMutex.Unlock()
+	fake.PullPlatformStub = stub
+}
+
+func (fake *FakeContainerRegistryInterface) PullPlatformArgsForCall(i int) (name.Reference, *v1.Platform) {
+	fake.pullPlatformMutex.RLock()
+	defer fake.pullPlatformMutex.RUnlock()
+	argsForCall := fake.pullPlatformArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeContainerRegistryInterface) PullPlatformReturns(result1 v1.Image, result2 string, result3 error) {
+	fake.pullPlatformMutex.Lock()
+	defer fake.pullPlatformMutex.Unlock()
+	fake.PullPlatformStub = nil
+	fake.pullPlatformReturns = struct {
+		result1 v1.Image
+		result2 string
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeContainerRegistryInterface) PullPlatformReturnsOnCall(i int, result1 v1.Image, result2 string, result3 error) {
+	fake.pullPlatformMutex.Lock()
+	defer fake.pullPlatformMutex.Unlock()
+	fake.PullPlatformStub = nil
+	if fake.pullPlatformReturnsOnCall == nil {
+		fake.pullPlatformReturnsOnCall = make(map[int]struct {
+			result1 v1.Image
+			result2 string
+			result3 error
+		})
+	}
+	fake.pullPlatformReturnsOnCall[i] = struct {
+		result1 v1.Image
+		result2 string
+		result3 error
+	}{result1, result2, result3}
+}
+
 func (fake *FakeContainerRegistryInterface) Push(arg1 v1.Image, arg2 name.Reference) error {
 	fake.pushMutex.Lock()
 	ret, specificReturn := fake.pushReturnsOnCall[len(fake.pushArgsForCall)]
@@ -256,6 +340,8 @@ func (fake *FakeContainerRegistryInterface) Invocations() map[string][][]interfa
 	defer fake.checkMutex.RUnlock()
 	fake.pullMutex.RLock()
 	defer fake.pullMutex.RUnlock()
+	fake.pullPlatformMutex.RLock()
+	defer fake.pullPlatformMutex.RUnlock()
 	fake.pushMutex.RLock()
 	defer fake.pushMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
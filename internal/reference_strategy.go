@@ -0,0 +1,98 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package internal
+
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Reference strategies, telling how the rewritten chart references the
+// relocated images
+const (
+	// ReferenceStrategyTag references the image by its pushed tag only
+	ReferenceStrategyTag = "tag"
+	// ReferenceStrategyDigest references the image by digest only
+	ReferenceStrategyDigest = "digest"
+	// ReferenceStrategyTagAndDigest references the image by its pushed tag
+	// and digest, i.e repository:tag@digest
+	ReferenceStrategyTagAndDigest = "tag-and-digest"
+)
+
+// ReferenceStrategies lists the reference strategies
+var ReferenceStrategies = []string{ReferenceStrategyTag, ReferenceStrategyDigest, ReferenceStrategyTagAndDigest}
+
+// referenceSuffix returns what follows the repository in the reference to the
+// relocated image, following the reference strategy. Images are referenced by
+// digest by default
+func referenceSuffix(originalImage name.Repository, imageDigest string, rules *OCIImageLocation) (string, error) {
+	switch rules.ReferenceStrategy {
+	case "", ReferenceStrategyDigest:
+		return "@" + imageDigest, nil
+	case ReferenceStrategyTag:
+		if rules.Tag == "" {
+			return "", noTagError(originalImage)
+		}
+		return ":" + rules.Tag, nil
+	case ReferenceStrategyTagAndDigest:
+		if rules.Tag == "" {
+			return "", noTagError(originalImage)
+		}
+		return fmt.Sprintf(":%s@%s", rules.Tag, imageDigest), nil
+	}
+	return "", fmt.Errorf("unknown reference strategy %q", rules.ReferenceStrategy)
+}
+
+// referenceValues returns what to append to the repository value and the
+// values to set to the tag and digest placeholders of the template, empty to
+// leave them as they are, so that the rewritten chart references the image
+// following the reference strategy. With no strategy, images are referenced
+// by digest unless the template has a tag or digest placeholder, whose tag is
+// then set to the pushed one if retagged
+func (t *ImageTemplate) referenceValues(originalImage name.Repository, imageDigest string, rules *OCIImageLocation) (string, string, string, error) {
+	if t.TagTemplate == "" && t.DigestTemplate == "" {
+		suffix, err := referenceSuffix(originalImage, imageDigest, rules)
+		return suffix, "", "", err
+	}
+
+	switch rules.ReferenceStrategy {
+	case "":
+		if !rules.Retagged {
+			return "", "", "", nil
+		}
+		return "", rules.Tag, "", nil
+	case ReferenceStrategyTag:
+		if t.DigestTemplate != "" {
+			return "", "", "", fmt.Errorf("image template %q can't reference the image by tag only, it has a digest placeholder", t.Raw)
+		}
+		if rules.Tag == "" {
+			return "", "", "", noTagError(originalImage)
+		}
+		return "", rules.Tag, "", nil
+	case ReferenceStrategyDigest:
+		if t.TagTemplate != "" {
+			return "", "", "", fmt.Errorf("image template %q can't reference the image by digest only, it has a tag placeholder", t.Raw)
+		}
+		return "", "", imageDigest, nil
+	case ReferenceStrategyTagAndDigest:
+		if rules.Tag == "" {
+			return "", "", "", noTagError(originalImage)
+		}
+		switch {
+		case t.TagTemplate == "":
+			// repository:tag@{{ digest }}
+			return ":" + rules.Tag, "", imageDigest, nil
+		case t.DigestTemplate == "":
+			// repository:{{ tag }}, the tag value holding both
+			return "", fmt.Sprintf("%s@%s", rules.Tag, imageDigest), "", nil
+		}
+		return "", rules.Tag, imageDigest, nil
+	}
+	return "", "", "", fmt.Errorf("unknown reference strategy %q", rules.ReferenceStrategy)
+}
+
+func noTagError(originalImage name.Repository) error {
+	return fmt.Errorf("image %s has no tag to reference, it is pushed by digest only", originalImage.Name())
+}
@@ -0,0 +1,103 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package internal_test
+
+import (
+	"github.com/google/go-containerregistry/pkg/name"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+)
+
+const referenceTestDigest = "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+
+var _ = Describe("Reference strategies", func() {
+	originalImage := name.MustParseReference("docker.io/bitnami/redis:6.2").Context()
+
+	location := func(strategy, tag string) *internal.OCIImageLocation {
+		return &internal.OCIImageLocation{Registry: "harbor-repo.vmware.com", Tag: tag, ReferenceStrategy: strategy, Retagged: tag != "6.2"}
+	}
+
+	DescribeTable("rewrites the values the template references the image with",
+		func(template, strategy string, expected map[string]string) {
+			actions, err := newTemplate(template).Apply(originalImage, referenceTestDigest, location(strategy, "6.2-relocated"))
+			Expect(err).ToNot(HaveOccurred())
+			values := map[string]string{}
+			for _, action := range actions {
+				values[action.Path] = action.Value
+			}
+			Expect(values).To(Equal(expected))
+		},
+		Entry("pins the digest with no placeholders by default",
+			"{{ .image.registry }}/{{ .image.repository }}", "",
+			map[string]string{".image.registry": "harbor-repo.vmware.com", ".image.repository": "bitnami/redis@" + referenceTestDigest}),
+		Entry("sets the pushed tag of tag placeholders by default",
+			"{{ .image.registry }}/{{ .image.repository }}:{{ .image.tag }}", "",
+			map[string]string{".image.registry": "harbor-repo.vmware.com", ".image.tag": "6.2-relocated"}),
+		Entry("appends the tag with no placeholders",
+			"{{ .image.registry }}/{{ .image.repository }}", internal.ReferenceStrategyTag,
+			map[string]string{".image.registry": "harbor-repo.vmware.com", ".image.repository": "bitnami/redis:6.2-relocated"}),
+		Entry("sets the digest placeholder",
+			"{{ .image.registry }}/{{ .image.repository }}@{{ .image.digest }}", internal.ReferenceStrategyDigest,
+			map[string]string{".image.registry": "harbor-repo.vmware.com", ".image.digest": referenceTestDigest}),
+		Entry("sets both placeholders",
+			"{{ .image.registry }}/{{ .image.repository }}:{{ .image.tag }}@{{ .image.digest }}", internal.ReferenceStrategyTagAndDigest,
+			map[string]string{".image.registry": "harbor-repo.vmware.com", ".image.tag": "6.2-relocated", ".image.digest": referenceTestDigest}),
+		Entry("sets the tag and digest in the tag placeholder",
+			"{{ .image.registry }}/{{ .image.repository }}:{{ .image.tag }}", internal.ReferenceStrategyTagAndDigest,
+			map[string]string{".image.registry": "harbor-repo.vmware.com", ".image.tag": "6.2-relocated@" + referenceTestDigest}),
+		Entry("appends the tag before the digest placeholder",
+			"{{ .image.registry }}/{{ .image.repository }}@{{ .image.digest }}", internal.ReferenceStrategyTagAndDigest,
+			map[string]string{".image.registry": "harbor-repo.vmware.com", ".image.repository": "bitnami/redis:6.2-relocated", ".image.digest": referenceTestDigest}),
+	)
+
+	It("leaves the tag placeholders of images keeping their tag by default", func() {
+		actions, err := newTemplate("{{ .image.registry }}/{{ .image.repository }}:{{ .image.tag }}").
+			Apply(originalImage, referenceTestDigest, location("", "6.2"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actions).To(Equal([]*internal.RewriteAction{{Path: ".image.registry", Value: "harbor-repo.vmware.com"}}))
+	})
+
+	It("fails when the values layout does not allow the strategy", func() {
+		_, err := newTemplate("{{ .image.repository }}:{{ .image.tag }}@{{ .image.digest }}").
+			Apply(originalImage, referenceTestDigest, location(internal.ReferenceStrategyTag, "6.2"))
+		Expect(err).To(MatchError(ContainSubstring("can't reference the image by tag only, it has a digest placeholder")))
+
+		_, err = newTemplate("{{ .image.repository }}:{{ .image.tag }}").
+			Apply(originalImage, referenceTestDigest, location(internal.ReferenceStrategyDigest, "6.2"))
+		Expect(err).To(MatchError(ContainSubstring("can't reference the image by digest only, it has a tag placeholder")))
+
+		_, err = newTemplate("{{ .image.repository }}").
+			Apply(originalImage, referenceTestDigest, location(internal.ReferenceStrategyTagAndDigest, ""))
+		Expect(err).To(MatchError("image index.docker.io/bitnami/redis has no tag to reference, it is pushed by digest only"))
+	})
+
+	It("relocates references following the strategy", func() {
+		ref, err := internal.RelocateReference(originalImage, referenceTestDigest, location(internal.ReferenceStrategyTag, "6.2"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ref.Name()).To(Equal("harbor-repo.vmware.com/bitnami/redis:6.2"))
+
+		ref, err = internal.RelocateReference(originalImage, referenceTestDigest, location(internal.ReferenceStrategyTagAndDigest, "6.2"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ref.String()).To(Equal("harbor-repo.vmware.com/bitnami/redis:6.2@" + referenceTestDigest))
+
+		template, err := internal.NewFromTemplateImage("templates/tests/test-pod.yaml", "bitnami/redis:6.2")
+		Expect(err).ToNot(HaveOccurred())
+		ref, err = template.RelocateTemplateImage(originalImage, referenceTestDigest, location("", "6.2-relocated"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ref.Name()).To(Equal("harbor-repo.vmware.com/bitnami/redis:6.2-relocated"))
+
+		ref, err = template.RelocateTemplateImage(originalImage, referenceTestDigest, location(internal.ReferenceStrategyDigest, "6.2-relocated"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ref.Name()).To(Equal("harbor-repo.vmware.com/bitnami/redis@" + referenceTestDigest))
+	})
+})
+
+func newTemplate(input string) *internal.ImageTemplate {
+	template, err := internal.NewFromString(input)
+	Expect(err).ToNot(HaveOccurred())
+	return template
+}
@@ -0,0 +1,101 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package internal
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Repository path strategies, telling what of the original repository path is
+// kept under the RepositoryPrefix
+const (
+	// PathStrategyLastSegment keeps the image name only, i.e bitnami/redis
+	// becomes prefix/redis
+	PathStrategyLastSegment = "last-segment"
+	// PathStrategyFull keeps the whole path, i.e prefix/bitnami/redis
+	PathStrategyFull = "full"
+	// PathStrategyRegistry keeps the whole path under the original registry
+	// host, i.e prefix/docker.io/bitnami/redis
+	PathStrategyRegistry = "registry"
+	// PathStrategyFlat joins the whole path with the PathSeparator, for
+	// registries limiting the path depth, i.e prefix/bitnami-redis
+	PathStrategyFlat = "flat"
+)
+
+// DefaultPathSeparator joins the path segments of the flat strategy
+const DefaultPathSeparator = "-"
+
+// PathStrategies lists the repository path strategies
+var PathStrategies = []string{PathStrategyLastSegment, PathStrategyFull, PathStrategyRegistry, PathStrategyFlat}
+
+var (
+	// pathSeparatorRegex matches the separators the distribution spec allows
+	// between the alphanumerics of a path component
+	pathSeparatorRegex = regexp.MustCompile(`^(?:[._]|__|-+)$`)
+	invalidPathChars   = regexp.MustCompile(`[^a-z0-9._-]+`)
+	repeatedSeparators = regexp.MustCompile(`[._-]{2,}`)
+)
+
+// ValidPathSeparator tells if the separator is allowed in repository paths
+func ValidPathSeparator(separator string) bool {
+	return pathSeparatorRegex.MatchString(separator)
+}
+
+// relocatedPath returns the repository path of the original image under the
+// prefix, following the strategy of the rules. With no strategy, the image
+// name is kept under the prefix, or the whole path with no prefix
+func relocatedPath(originalImage name.Repository, rules *OCIImageLocation) string {
+	segments := strings.Split(originalImage.RepositoryStr(), "/")
+	switch rules.PathStrategy {
+	case "":
+		if rules.RepositoryPrefix == "" {
+			return originalImage.RepositoryStr()
+		}
+		segments = segments[len(segments)-1:]
+	case PathStrategyLastSegment:
+		segments = segments[len(segments)-1:]
+	case PathStrategyRegistry:
+		registry := originalImage.RegistryStr()
+		if registry == name.DefaultRegistry {
+			registry = "docker.io"
+		}
+		segments = append([]string{registry}, segments...)
+	case PathStrategyFlat:
+		separator := rules.PathSeparator
+		if separator == "" {
+			separator = DefaultPathSeparator
+		}
+		segments = []string{strings.Join(sanitizePath(segments), separator)}
+	}
+
+	path := sanitizePath(segments)
+	if rules.RepositoryPrefix != "" {
+		path = append([]string{rules.RepositoryPrefix}, path...)
+	}
+	return strings.Join(path, "/")
+}
+
+// sanitizePath turns each segment into a valid repository path component:
+// lower case alphanumerics joined by single separators. Empty segments are
+// dropped
+func sanitizePath(segments []string) []string {
+	sanitized := []string{}
+	for _, segment := range segments {
+		segment = invalidPathChars.ReplaceAllString(strings.ToLower(segment), "-")
+		segment = repeatedSeparators.ReplaceAllStringFunc(segment, func(separators string) string {
+			if ValidPathSeparator(separators) {
+				return separators
+			}
+			return "-"
+		})
+		segment = strings.Trim(segment, "._-")
+		if segment != "" {
+			sanitized = append(sanitized, segment)
+		}
+	}
+	return sanitized
+}
@@ -0,0 +1,48 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package internal_test
+
+import (
+	"github.com/google/go-containerregistry/pkg/name"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+)
+
+const pathTestDigest = "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+
+var _ = DescribeTable("Repository path strategies",
+	func(image string, rules *internal.OCIImageLocation, expected string) {
+		original, err := name.ParseReference(image)
+		Expect(err).ToNot(HaveOccurred())
+		relocated, err := internal.RelocateReference(original.Context(), pathTestDigest, rules)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(relocated.Context().Name()).To(Equal(expected))
+	},
+	Entry("keeps the whole path with no prefix nor strategy",
+		"docker.io/bitnami/redis:6.2", &internal.OCIImageLocation{Registry: "harbor-repo.vmware.com"},
+		"harbor-repo.vmware.com/bitnami/redis"),
+	Entry("keeps the image name under the prefix by default",
+		"docker.io/bitnami/redis:6.2", &internal.OCIImageLocation{Registry: "harbor-repo.vmware.com", RepositoryPrefix: "pwall"},
+		"harbor-repo.vmware.com/pwall/redis"),
+	Entry("keeps the image name with the last-segment strategy",
+		"quay.io/opstree/redis:v6.2", &internal.OCIImageLocation{Registry: "harbor-repo.vmware.com", PathStrategy: internal.PathStrategyLastSegment},
+		"harbor-repo.vmware.com/redis"),
+	Entry("keeps the whole path with the full strategy",
+		"quay.io/opstree/redis:v6.2", &internal.OCIImageLocation{Registry: "harbor-repo.vmware.com", RepositoryPrefix: "pwall", PathStrategy: internal.PathStrategyFull},
+		"harbor-repo.vmware.com/pwall/opstree/redis"),
+	Entry("keeps the registry host with the registry strategy",
+		"redis:6.2", &internal.OCIImageLocation{Registry: "harbor-repo.vmware.com", RepositoryPrefix: "pwall", PathStrategy: internal.PathStrategyRegistry},
+		"harbor-repo.vmware.com/pwall/docker.io/library/redis"),
+	Entry("sanitizes registry hosts with ports",
+		"localhost:5000/team/app:1.0", &internal.OCIImageLocation{Registry: "harbor-repo.vmware.com", PathStrategy: internal.PathStrategyRegistry},
+		"harbor-repo.vmware.com/localhost-5000/team/app"),
+	Entry("flattens the path with the flat strategy",
+		"quay.io/opstree/redis:v6.2", &internal.OCIImageLocation{Registry: "harbor-repo.vmware.com", RepositoryPrefix: "pwall", PathStrategy: internal.PathStrategyFlat},
+		"harbor-repo.vmware.com/pwall/opstree-redis"),
+	Entry("flattens the path with a custom separator",
+		"gcr.io/my-project/team/app:1.0", &internal.OCIImageLocation{Registry: "harbor-repo.vmware.com", PathStrategy: internal.PathStrategyFlat, PathSeparator: "__"},
+		"harbor-repo.vmware.com/my-project__team__app"),
+)
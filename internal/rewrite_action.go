@@ -5,9 +5,7 @@ package internal
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/divideandconquer/go-merge/merge"
 	"github.com/google/go-containerregistry/pkg/name"
@@ -19,67 +17,144 @@ import (
 type OCIImageLocation struct {
 	Registry         string
 	RepositoryPrefix string
+	// Repository, registry included, the image is moved to, replacing the
+	// Registry and RepositoryPrefix rules
+	Repository string
+	// PathStrategy tells what of the original repository path is kept, one of
+	// the PathStrategies, and PathSeparator joins it for the flat strategy
+	PathStrategy  string
+	PathSeparator string
+	// Tag the image is pushed under, empty if pushed by digest only, and
+	// ReferenceStrategy how the rewritten chart references it, one of the
+	// ReferenceStrategies
+	Tag               string
+	ReferenceStrategy string
+	// Retagged tells if the Tag differs from the original one, so that tag
+	// placeholders are rewritten with no ReferenceStrategy
+	Retagged bool
 }
 type RewriteAction struct {
 	Path  string `json:"path"`
 	Value string `json:"value"`
 }
 
-func (a *RewriteAction) TopLevelKey() string {
-	return strings.Split(a.Path, ".")[1]
+// keys returns the keys of the path
+func (a *RewriteAction) keys() ([]interface{}, error) {
+	keys, err := ParseValuesPath(a.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rewrite action: %w", err)
+	}
+	return keys, nil
+}
+
+// TopLevelKey returns the first key of the path, unquoted
+func (a *RewriteAction) TopLevelKey() (string, error) {
+	keys, err := a.keys()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(keys[0]), nil
 }
 
-// removes the first part of the dot delimited string
+// removes the first key of the path
 // .sub-1.foo.bar => .foo.bar
-func (a *RewriteAction) stripPrefix() string {
-	// Starting in 2 since there is an empty string as first element
-	return "." + strings.Join(strings.Split(a.Path, ".")[2:], ".")
+func (a *RewriteAction) stripPrefix() (string, error) {
+	keys, err := a.keys()
+	if err != nil {
+		return "", err
+	}
+	return FormatValuesPath(keys[1:]), nil
 }
 
-func (a *RewriteAction) GetPathToMap() string {
-	pathParts := strings.Split(a.Path, ".")
-	return strings.Join(pathParts[:len(pathParts)-1], ".")
+// GetPathToMap returns the path to the map, or list, holding the value
+func (a *RewriteAction) GetPathToMap() (string, error) {
+	keys, err := a.keys()
+	if err != nil {
+		return "", err
+	}
+	return FormatValuesPath(keys[:len(keys)-1]), nil
 }
 
-func (a *RewriteAction) GetSubPathToMap() string {
-	pathParts := strings.Split(a.Path, ".")
-	return "." + strings.Join(pathParts[2:len(pathParts)-1], ".")
+func (a *RewriteAction) GetSubPathToMap() (string, error) {
+	keys, err := a.keys()
+	if err != nil {
+		return "", err
+	}
+	if len(keys) <= 2 {
+		return ".", nil
+	}
+	return FormatValuesPath(keys[1 : len(keys)-1]), nil
 }
 
-func (a *RewriteAction) GetKey() string {
-	pathParts := strings.Split(a.Path, ".")
-	return pathParts[len(pathParts)-1]
+// GetKey returns the key of the value in its map, unquoted, or its [index]
+// in its list
+func (a *RewriteAction) GetKey() (string, error) {
+	keys, err := a.keys()
+	if err != nil {
+		return "", err
+	}
+	if index, isIndex := keys[len(keys)-1].(int); isIndex {
+		return fmt.Sprintf("[%d]", index), nil
+	}
+	return fmt.Sprint(keys[len(keys)-1]), nil
 }
 
-func (a *RewriteAction) ToMap() map[string]interface{} {
-	keys := strings.Split(strings.TrimPrefix(a.Path, "."), ".")
+func (a *RewriteAction) ToMap() (map[string]interface{}, error) {
+	keys, err := a.keys()
+	if err != nil {
+		return nil, err
+	}
 	var node ValuesMap
 	var value interface{} = a.Value
 
 	for i := len(keys) - 1; i >= 0; i-- {
-		key := keys[i]
+		key := fmt.Sprint(keys[i])
 		node = make(ValuesMap)
 		node[key] = value
 		value = node
 	}
 
-	return node
+	return node, nil
 }
 
 // Apply will try to execute the rewrite action declaration on the given Helm Chart or sub-charts
 func (a *RewriteAction) Apply(chart *chart.Chart) error {
-	chartToApply, relativeRewriteRule := a.FindChartDestination(chart)
+	chartToApply, relativeRewriteRule, err := a.FindChartDestination(chart)
+	if err != nil {
+		return err
+	}
 	return applyUpdate(chartToApply, relativeRewriteRule)
 }
 
 // Apply the yaml update described in the rewrite action to the provided Helm Chart
 func applyUpdate(chart *chart.Chart, a *RewriteAction) error {
 	valuesIndex, data := getChartValues(chart)
+	// The value must be in the values file, updating it would do nothing
+	// otherwise and the chart would silently keep the original value
+	keys, err := a.keys()
+	if err != nil {
+		return err
+	}
+	values, err := chartutil.ReadValues(data)
+	if err != nil {
+		return fmt.Errorf("failed to read the values of %s: %w", chart.Name(), err)
+	}
+	if _, found := lookupKeys(map[string]interface{}(values), keys); valuesIndex < 0 || !found {
+		return fmt.Errorf("failed to apply modification to %s: no value at %s in its %s", chart.Name(), a.Path, chartutil.ValuesfileName)
+	}
+	key, err := a.GetKey()
+	if err != nil {
+		return err
+	}
+	pathToMap, err := a.GetPathToMap()
+	if err != nil {
+		return err
+	}
 	value := map[string]string{
-		a.GetKey(): a.Value,
+		key: a.Value,
 	}
 
-	newData, err := yamlops2.UpdateMap(data, a.GetPathToMap(), "", nil, value)
+	newData, err := yamlops2.UpdateMap(data, pathToMap, "", nil, value)
 	if err != nil {
 		return fmt.Errorf("failed to apply modification to %s: %w", chart.Name(), err)
 	}
@@ -92,21 +167,28 @@ func applyUpdate(chart *chart.Chart, a *RewriteAction) error {
 // FindChartDestination will recursively find the Helm Chart a rewrite action will apply to
 // by starting on a parentChart
 // Additionally it will return the rewrite action with path relative to that Helm Chart
-func (a *RewriteAction) FindChartDestination(parentChart *chart.Chart) (*chart.Chart, *RewriteAction) {
-	for _, subchart := range parentChart.Dependencies() {
-		if subchart.Name() == a.TopLevelKey() {
-			// Recursively perform the check stripping out the rewrite prefix
-			// and providing the actual subchart reference
-			subChartRewriteAction := &RewriteAction{
-				Path:  a.stripPrefix(),
-				Value: a.Value,
-			}
-
-			return subChartRewriteAction.FindChartDestination(subchart)
+func (a *RewriteAction) FindChartDestination(parentChart *chart.Chart) (*chart.Chart, *RewriteAction, error) {
+	topLevelKey, err := a.TopLevelKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	// Subchart values are keyed by their alias, if any
+	if subchart := findSubchart(parentChart, topLevelKey); subchart != nil {
+		// Recursively perform the check stripping out the rewrite prefix
+		// and providing the actual subchart reference
+		path, err := a.stripPrefix()
+		if err != nil {
+			return nil, nil, err
 		}
+		subChartRewriteAction := &RewriteAction{
+			Path:  path,
+			Value: a.Value,
+		}
+
+		return subChartRewriteAction.FindChartDestination(subchart)
 	}
 
-	return parentChart, a
+	return parentChart, a, nil
 }
 
 func getChartValues(chart *chart.Chart) (int, []byte) {
@@ -129,36 +211,100 @@ func buildValuesMap(chart *chart.Chart) map[string]interface{} {
 	// Add values for chart dependencies
 	for _, dependency := range chart.Dependencies() {
 		// recursively load the dependency values
-		values[dependency.Name()] = merge.Merge(buildValuesMap(dependency), values[dependency.Name()])
+		dependencyValues := buildValuesMap(dependency)
+		for _, key := range SubchartValuesKeys(chart, dependency) {
+			values[key] = merge.Merge(dependencyValues, values[key])
+		}
 	}
 
 	return values
 }
 
+// LookupValue returns the value at the path of the chart values, subchart
+// values and globals included, as templates see them. Paths are made of .keys
+// and [index] list items
+func LookupValue(chart *chart.Chart, path string) (interface{}, bool) {
+	keys, err := ParseValuesPath(path)
+	if err != nil {
+		return nil, false
+	}
+	values, err := chartValues(chart, nil)
+	if err != nil {
+		return nil, false
+	}
+	return lookupKeys(values, keys)
+}
+
+// RewritesToValues merges the rewrite actions into a nested values map, with
+// subchart values under their chart name, as Helm expects in values files.
+// Helm replaces lists as a whole, so lists holding rewritten items are copied
+// entirely from the chart values
+func RewritesToValues(chart *chart.Chart, rewriteActions []*RewriteAction) (map[string]interface{}, error) {
+	chartValues := buildValuesMap(chart)
+	var values interface{} = map[string]interface{}{}
+	for _, action := range rewriteActions {
+		keys, err := ParseValuesPath(action.Path)
+		if err != nil {
+			return nil, err
+		}
+		for i, key := range keys {
+			if _, isIndex := key.(int); !isIndex {
+				continue
+			}
+			if _, found := lookupKeys(values, keys[:i]); !found {
+				list, _ := lookupKeys(chartValues, keys[:i])
+				if values, err = setValue(values, keys[:i], list); err != nil {
+					return nil, err
+				}
+			}
+			break
+		}
+	}
+	return applyRewrites(values.(map[string]interface{}), rewriteActions)
+}
+
 func applyRewrites(values map[string]interface{}, rewriteActions []*RewriteAction) (map[string]interface{}, error) {
 	for _, action := range rewriteActions {
-		actionMap := action.ToMap()
-		result := merge.Merge(values, actionMap)
-		var ok bool
-		values, ok = result.(map[string]interface{})
-		if !ok {
-			return nil, errors.New("can't apply rewrites to Chart values, invalid format")
+		keys, err := ParseValuesPath(action.Path)
+		if err != nil {
+			return nil, err
 		}
+		result, err := setValue(values, keys, action.Value)
+		if err != nil {
+			return nil, fmt.Errorf("can't apply rewrites to Chart values: %w", err)
+		}
+		values = result.(map[string]interface{})
 	}
 
 	return values, nil
 }
 
 func (t *ImageTemplate) Render(chart *chart.Chart, rewriteActions ...*RewriteAction) (name.Reference, error) {
-	values := buildValuesMap(chart)
-
+	if t.TemplateImage != "" {
+		return t.renderTemplateImage(chart)
+	}
+	if t.HasWildcard() {
+		return nil, fmt.Errorf("image template %q has wildcards, it must be expanded first", t.Raw)
+	}
 	// Apply rewrite actions
-	var err error
-	values, err = applyRewrites(values, rewriteActions)
+	values, err := chartValues(chart, rewriteActions)
 	if err != nil {
 		return nil, err
 	}
 
+	// Bitnami style charts use the global registry instead of the image one
+	if registry := t.globalImageRegistry(chart, values); registry != "" {
+		keys, err := ParseValuesPath(t.RegistryTemplate)
+		if err != nil {
+			return nil, err
+		}
+		result, err := setValue(values, keys, registry)
+		if err != nil {
+			return nil, err
+		}
+		values = result.(map[string]interface{})
+	}
+
 	output := bytes.Buffer{}
 	err = t.Template.Execute(&output, values)
 	if err != nil {
@@ -175,25 +321,20 @@ func (t *ImageTemplate) Render(chart *chart.Chart, rewriteActions ...*RewriteAct
 
 func (t *ImageTemplate) Apply(originalImage name.Repository, imageDigest string, rules *OCIImageLocation) ([]*RewriteAction, error) {
 	var rewrites []*RewriteAction
-
-	registry := originalImage.Registry.Name()
-	if rules.Registry != "" {
-		registry = rules.Registry
+	if t.TemplateImage != "" {
+		// Hardcoded images are rewritten in their template file, not in values
+		return rewrites, nil
 	}
 
-	// Repository path should contain the repositoryPrefix + imageName
-	repository := originalImage.RepositoryStr()
-	if rules.RepositoryPrefix != "" {
-		repoParts := strings.Split(originalImage.RepositoryStr(), "/")
-		imageName := repoParts[len(repoParts)-1]
-		repository = fmt.Sprintf("%s/%s", rules.RepositoryPrefix, imageName)
-	}
+	registry, repository := relocatedRepository(originalImage, rules)
 
 	// Append the image digest unless the tag or digest are explicitly encoded in the template
-	// By doing so, we default to immutable references
-	if t.TagTemplate == "" && t.DigestTemplate == "" {
-		repository = fmt.Sprintf("%s@%s", repository, imageDigest)
+	// or the reference strategy says otherwise. By doing so, we default to immutable references
+	suffix, tag, digest, err := t.referenceValues(originalImage, imageDigest, rules)
+	if err != nil {
+		return nil, err
 	}
+	repository += suffix
 
 	registryChanged := originalImage.Registry.Name() != registry
 	repoChanged := originalImage.RepositoryStr() != repository
@@ -222,5 +363,52 @@ func (t *ImageTemplate) Apply(originalImage name.Repository, imageDigest string,
 		}
 	}
 
+	if t.TagTemplate != "" && tag != "" {
+		rewrites = append(rewrites, &RewriteAction{
+			Path:  t.TagTemplate,
+			Value: tag,
+		})
+	}
+	if t.DigestTemplate != "" && digest != "" {
+		rewrites = append(rewrites, &RewriteAction{
+			Path:  t.DigestTemplate,
+			Value: digest,
+		})
+	}
+
 	return rewrites, nil
 }
+
+// relocatedRepository returns the registry and repository path the original
+// image is moved to following the rules
+func relocatedRepository(originalImage name.Repository, rules *OCIImageLocation) (string, string) {
+	if rules.Repository != "" {
+		if repository, err := name.NewRepository(rules.Repository); err == nil {
+			return repository.RegistryStr(), repository.RepositoryStr()
+		}
+	}
+
+	registry := originalImage.Registry.Name()
+	if rules.Registry != "" {
+		registry = rules.Registry
+	}
+
+	// Repository path should contain the repositoryPrefix + the path the strategy keeps
+	return registry, relocatedPath(originalImage, rules)
+}
+
+// RelocateReference returns the reference the original image is moved to
+// following the rules. As for templates with no tag nor digest, the relocated
+// image is referenced by digest unless the reference strategy says otherwise
+func RelocateReference(originalImage name.Repository, imageDigest string, rules *OCIImageLocation) (name.Reference, error) {
+	registry, repository := relocatedRepository(originalImage, rules)
+	suffix, err := referenceSuffix(originalImage, imageDigest, rules)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := name.ParseReference(fmt.Sprintf("%s/%s%s", registry, repository, suffix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse relocated image reference: %w", err)
+	}
+	return ref, nil
+}
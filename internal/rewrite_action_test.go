@@ -41,6 +41,38 @@ var _ = Describe("RewriteAction", func() {
 			}
 			Expect(action.GetPathToMap()).To(Equal(".alpha.bravo.charlie"))
 		})
+
+		It("returns the path to the list of a list item", func() {
+			action := &internal.RewriteAction{
+				Path:  ".alpha.bravo[1]",
+				Value: "needle",
+			}
+			Expect(action.GetPathToMap()).To(Equal(".alpha.bravo"))
+			Expect(action.GetKey()).To(Equal("[1]"))
+		})
+
+		It("keeps quoted keys with dots whole", func() {
+			action := &internal.RewriteAction{
+				Path:  `.["my-sub.chart"].podLabels["app.kubernetes.io/image"]`,
+				Value: "needle",
+			}
+			Expect(action.TopLevelKey()).To(Equal("my-sub.chart"))
+			Expect(action.GetPathToMap()).To(Equal(`.["my-sub.chart"].podLabels`))
+			Expect(action.GetKey()).To(Equal("app.kubernetes.io/image"))
+			Expect(action.ToMap()).To(HaveKey("my-sub.chart"))
+		})
+	})
+
+	It("fails on invalid paths", func() {
+		action := &internal.RewriteAction{
+			Path:  `.alpha["bravo`,
+			Value: "needle",
+		}
+		_, err := action.GetPathToMap()
+		Expect(err).To(MatchError(ContainSubstring(`invalid rewrite action: invalid values path ".alpha[\"bravo"`)))
+		_, err = action.GetKey()
+		Expect(err).To(HaveOccurred())
+		Expect(action.Apply(&chart.Chart{})).ToNot(Succeed())
 	})
 
 	Describe("GetSubPathToMap", func() {
@@ -71,7 +103,8 @@ var _ = Describe("RewriteAction", func() {
 					Value: "needle",
 				}
 
-				haystack := action.ToMap()
+				haystack, err := action.ToMap()
+				Expect(err).ToNot(HaveOccurred())
 				Expect(haystack).To(HaveKeyWithValue("alpha", "needle"))
 			})
 		})
@@ -83,7 +116,8 @@ var _ = Describe("RewriteAction", func() {
 					Value: "needle",
 				}
 
-				haystack := action.ToMap()
+				haystack, err := action.ToMap()
+				Expect(err).ToNot(HaveOccurred())
 				Expect(haystack).To(HaveKey("alpha"))
 				haystackLevelTwo := haystack["alpha"]
 				Expect(haystackLevelTwo).To(HaveKeyWithValue("bravo", "needle"))
@@ -97,7 +131,8 @@ var _ = Describe("RewriteAction", func() {
 					Value: "needle",
 				}
 
-				haystack := action.ToMap()
+				haystack, err := action.ToMap()
+				Expect(err).ToNot(HaveOccurred())
 				Expect(haystack).To(HaveKey("alpha"))
 
 				var ok bool
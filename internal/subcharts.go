@@ -0,0 +1,36 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package internal
+
+import (
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// SubchartValuesKeys returns the keys Helm sets the values of the subchart
+// under in its parent chart values: the aliases of the dependencies it is
+// vendored for or, for dependencies with no alias, its name. A chart vendored
+// once can be installed several times under different aliases
+func SubchartValuesKeys(parent, subchart *chart.Chart) []string {
+	keys := []string{}
+	seen := map[string]bool{}
+	if parent.Metadata != nil {
+		for _, dependency := range parent.Metadata.Dependencies {
+			if dependency.Name != subchart.Name() {
+				continue
+			}
+			key := dependency.Name
+			if dependency.Alias != "" {
+				key = dependency.Alias
+			}
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return []string{subchart.Name()}
+	}
+	return keys
+}
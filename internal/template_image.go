@@ -0,0 +1,169 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// NewFromTemplateImage creates the template of an image reference hardcoded
+// in a chart template file, i.e busybox:1.36 in templates/tests/test.yaml.
+// Template files of subcharts are under charts/<subchart name>/
+func NewFromTemplateImage(file, image string) (*ImageTemplate, error) {
+	if file == "" || image == "" {
+		return nil, fmt.Errorf("invalid template image: both the template file and the image are required")
+	}
+	if path.IsAbs(file) || path.Clean(file) != file || strings.HasPrefix(file, "../") {
+		return nil, fmt.Errorf("invalid template file %q: it must be a path relative to the chart", file)
+	}
+	if _, err := name.ParseReference(image); err != nil {
+		return nil, fmt.Errorf("invalid template image %q: %w", image, err)
+	}
+	return &ImageTemplate{
+		Raw:           fmt.Sprintf("%s in %s", image, file),
+		TemplateFile:  file,
+		TemplateImage: image,
+	}, nil
+}
+
+// renderTemplateImage checks the image is in the template file and parses it
+func (t *ImageTemplate) renderTemplateImage(chart *chart.Chart) (name.Reference, error) {
+	file, err := findTemplateFile(chart, t.TemplateFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, found := replaceImageLiteral(file.Data, t.TemplateImage, t.TemplateImage); !found {
+		return nil, fmt.Errorf("image %s not found in template file %s", t.TemplateImage, t.TemplateFile)
+	}
+	image, err := name.ParseReference(t.TemplateImage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference: %w", err)
+	}
+	return image, nil
+}
+
+// RelocateTemplateImage returns the reference replacing the image hardcoded in
+// the template file, following the reference strategy. With no strategy, an
+// explicit tag is kept, replaced by the pushed one if known, otherwise the
+// relocated image is referenced by digest
+func (t *ImageTemplate) RelocateTemplateImage(originalImage name.Repository, imageDigest string, rules *OCIImageLocation) (name.Reference, error) {
+	registry, repository := relocatedRepository(originalImage, rules)
+	suffix, err := referenceSuffix(originalImage, imageDigest, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := name.ParseReference(t.TemplateImage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference: %w", err)
+	}
+	imageName := t.TemplateImage[strings.LastIndex(t.TemplateImage, "/")+1:]
+	if tag, isTag := ref.(name.Tag); isTag && strings.Contains(imageName, ":") && rules.ReferenceStrategy == "" {
+		suffix = ":" + tag.TagStr()
+		if rules.Tag != "" {
+			suffix = ":" + rules.Tag
+		}
+	}
+
+	image, err := name.ParseReference(registry + "/" + repository + suffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse relocated image reference: %w", err)
+	}
+	return image, nil
+}
+
+// TemplateRewrite replaces an image reference hardcoded in a chart template
+// file, its path relative to the root chart
+type TemplateRewrite struct {
+	File     string `json:"file"`
+	Original string `json:"original"`
+	Value    string `json:"value"`
+}
+
+// Apply replaces every occurrence of the original image in the template file.
+// Only whole references are replaced, the rest of the template source,
+// template actions included, is left as is
+func (r *TemplateRewrite) Apply(chart *chart.Chart) error {
+	file, err := findTemplateFile(chart, r.File)
+	if err != nil {
+		return err
+	}
+	data, found := replaceImageLiteral(file.Data, r.Original, r.Value)
+	if !found {
+		return fmt.Errorf("image %s not found in template file %s", r.Original, r.File)
+	}
+	file.Data = data
+	return nil
+}
+
+// findTemplateFile returns the template file of the chart, looking into the
+// subcharts for charts/<subchart name>/ paths
+func findTemplateFile(c *chart.Chart, filename string) (*chart.File, error) {
+	for _, template := range c.Templates {
+		if template.Name == filename {
+			return template, nil
+		}
+	}
+	if rest := strings.TrimPrefix(filename, "charts/"); rest != filename {
+		if i := strings.Index(rest, "/"); i > 0 {
+			if subchart := findSubchartByName(c, rest[:i]); subchart != nil {
+				file, err := findTemplateFile(subchart, rest[i+1:])
+				if err != nil {
+					return nil, fmt.Errorf("template file %s not found in chart %s", filename, c.Name())
+				}
+				return file, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("template file %s not found in chart %s", filename, c.Name())
+}
+
+// findSubchartByName returns the subchart vendored in charts/<name>/. Unlike
+// values, template files of aliased subcharts are under their chart name
+func findSubchartByName(c *chart.Chart, name string) *chart.Chart {
+	for _, dependency := range c.Dependencies() {
+		if dependency.Name() == name {
+			return dependency
+		}
+	}
+	return nil
+}
+
+// replaceImageLiteral replaces the occurrences of the image in data that are
+// not part of a longer reference, as busybox:1.36 in mybusybox:1.36.1, and
+// tells if there were any
+func replaceImageLiteral(data []byte, image, value string) ([]byte, bool) {
+	literal := []byte(image)
+	out := bytes.Buffer{}
+	found := false
+	i := 0
+	for {
+		j := bytes.Index(data[i:], literal)
+		if j < 0 {
+			break
+		}
+		start, end := i+j, i+j+len(literal)
+		if (start == 0 || !isReferenceChar(data[start-1])) && (end == len(data) || !isReferenceChar(data[end])) {
+			out.Write(data[i:start])
+			out.WriteString(value)
+			found = true
+		} else {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	out.Write(data[i:])
+	return out.Bytes(), found
+}
+
+func isReferenceChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		strings.IndexByte("._-/:@", c) >= 0
+}
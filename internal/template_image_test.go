@@ -0,0 +1,127 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package internal_test
+
+import (
+	"github.com/google/go-containerregistry/pkg/name"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/chart"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+)
+
+var _ = Describe("Images hardcoded in templates", func() {
+	const testTemplate = `apiVersion: v1
+kind: Pod
+metadata:
+  name: "{{ .Release.Name }}-test"
+spec:
+  containers:
+  - name: test
+    image: busybox:1.36
+    command: ["sh", "-c", "echo busybox:1.36.1 mybusybox:1.36"]
+  - name: wait
+    image: {{ .Values.waitImage | default "busybox:1.36" | quote }}
+`
+	var c *chart.Chart
+
+	BeforeEach(func() {
+		c = &chart.Chart{
+			Metadata:  &chart.Metadata{Name: "app"},
+			Templates: []*chart.File{{Name: "templates/tests/test-pod.yaml", Data: []byte(testTemplate)}},
+		}
+		c.AddDependency(&chart.Chart{
+			Metadata:  &chart.Metadata{Name: "mariadb"},
+			Templates: []*chart.File{{Name: "templates/job.yaml", Data: []byte("image: docker.io/bitnami/kubectl:1.24\n")}},
+		})
+	})
+
+	It("parses template image hints", func() {
+		template, err := internal.NewFromHint(&internal.ImageHint{Template: "templates/tests/test-pod.yaml", Image: "busybox:1.36"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(template.Raw).To(Equal("busybox:1.36 in templates/tests/test-pod.yaml"))
+		Expect(template.Structured()).To(BeTrue())
+		Expect(template.Hint()).To(Equal(&internal.ImageHint{Template: "templates/tests/test-pod.yaml", Image: "busybox:1.36"}))
+
+		_, err = internal.NewFromHint(&internal.ImageHint{Template: "templates/tests/test-pod.yaml"})
+		Expect(err).To(MatchError(ContainSubstring("both the template file and the image are required")))
+		_, err = internal.NewFromHint(&internal.ImageHint{Template: "../test-pod.yaml", Image: "busybox:1.36"})
+		Expect(err).To(MatchError(ContainSubstring("it must be a path relative to the chart")))
+		_, err = internal.NewFromHint(&internal.ImageHint{Template: "templates/tests/test-pod.yaml", Image: "busybox:1.36", Tag: ".tag"})
+		Expect(err).To(MatchError(ContainSubstring("cannot be combined with values paths")))
+	})
+
+	It("renders the images found in the template files", func() {
+		template, err := internal.NewFromTemplateImage("charts/mariadb/templates/job.yaml", "docker.io/bitnami/kubectl:1.24")
+		Expect(err).ToNot(HaveOccurred())
+		image, err := template.Render(c)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(image.Name()).To(Equal("index.docker.io/bitnami/kubectl:1.24"))
+
+		template, err = internal.NewFromTemplateImage("templates/tests/test-pod.yaml", "busybox:1.35")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = template.Render(c)
+		Expect(err).To(MatchError("image busybox:1.35 not found in template file templates/tests/test-pod.yaml"))
+
+		template, err = internal.NewFromTemplateImage("templates/missing.yaml", "busybox:1.36")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = template.Render(c)
+		Expect(err).To(MatchError("template file templates/missing.yaml not found in chart app"))
+	})
+
+	It("relocates the images keeping their tag or pinning their digest", func() {
+		rules := &internal.OCIImageLocation{Registry: "harbor-repo.vmware.com", RepositoryPrefix: "pwall"}
+		original := name.MustParseReference("busybox:1.36").Context()
+
+		template, err := internal.NewFromTemplateImage("templates/tests/test-pod.yaml", "busybox:1.36")
+		Expect(err).ToNot(HaveOccurred())
+		image, err := template.RelocateTemplateImage(original, "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", rules)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(image.Name()).To(Equal("harbor-repo.vmware.com/pwall/busybox:1.36"))
+
+		template, err = internal.NewFromTemplateImage("templates/tests/test-pod.yaml", "localhost:5000/busybox")
+		Expect(err).ToNot(HaveOccurred())
+		image, err = template.RelocateTemplateImage(original, "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", rules)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(image.Name()).To(Equal("harbor-repo.vmware.com/pwall/busybox@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"))
+	})
+
+	It("finds the template files of aliased subcharts under their chart name", func() {
+		c.Metadata.Dependencies = []*chart.Dependency{{Name: "mariadb", Alias: "db"}}
+		template, err := internal.NewFromTemplateImage("charts/mariadb/templates/job.yaml", "docker.io/bitnami/kubectl:1.24")
+		Expect(err).ToNot(HaveOccurred())
+		image, err := template.Render(c)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(image.Name()).To(Equal("index.docker.io/bitnami/kubectl:1.24"))
+
+		template, err = internal.NewFromTemplateImage("charts/db/templates/job.yaml", "docker.io/bitnami/kubectl:1.24")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = template.Render(c)
+		Expect(err).To(MatchError(ContainSubstring("template file charts/db/templates/job.yaml not found")))
+	})
+
+	It("rewrites the whole references only, leaving the template syntax as is", func() {
+		rewrite := &internal.TemplateRewrite{
+			File:     "templates/tests/test-pod.yaml",
+			Original: "busybox:1.36",
+			Value:    "harbor-repo.vmware.com/pwall/busybox:1.36",
+		}
+		Expect(rewrite.Apply(c)).To(Succeed())
+		Expect(string(c.Templates[0].Data)).To(Equal(`apiVersion: v1
+kind: Pod
+metadata:
+  name: "{{ .Release.Name }}-test"
+spec:
+  containers:
+  - name: test
+    image: harbor-repo.vmware.com/pwall/busybox:1.36
+    command: ["sh", "-c", "echo busybox:1.36.1 mybusybox:1.36"]
+  - name: wait
+    image: {{ .Values.waitImage | default "harbor-repo.vmware.com/pwall/busybox:1.36" | quote }}
+`))
+
+		Expect(rewrite.Apply(c)).To(MatchError("image busybox:1.36 not found in template file templates/tests/test-pod.yaml"))
+	})
+})
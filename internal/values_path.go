@@ -0,0 +1,224 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal/yamlops"
+)
+
+// Wildcard stands for every item of a list in a values path, as in
+// .sidecars[*].image
+const Wildcard = "[*]"
+
+// wildcardIndex is the parsed key of a Wildcard
+const wildcardIndex = -1
+
+// valuesPathRegex matches each key of a values path: a .key of a map, a
+// ["quoted key"] of a map, quoted as a Go string, or an [index] of a list
+var valuesPathRegex = regexp.MustCompile(`\.([^.\[\]]+)|\.?\[("(?:[^"\\]|\\.)*")\]|\[(\d+|\*)\]`)
+
+// ParseValuesPath splits a values path like .sidecars[0].image or
+// .podLabels["app.kubernetes.io/name"] into its map keys, as strings, and its
+// list indices, as ints
+func ParseValuesPath(path string) ([]interface{}, error) {
+	keys := []interface{}{}
+	end := 0
+	for _, match := range valuesPathRegex.FindAllStringSubmatchIndex(path, -1) {
+		if match[0] != end {
+			break
+		}
+		end = match[1]
+		switch {
+		case match[2] >= 0:
+			keys = append(keys, path[match[2]:match[3]])
+		case match[4] >= 0:
+			key, err := strconv.Unquote(path[match[4]:match[5]])
+			if err != nil {
+				return nil, fmt.Errorf("invalid values path %q: %w", path, err)
+			}
+			keys = append(keys, key)
+		default:
+			index := wildcardIndex
+			if digits := path[match[6]:match[7]]; digits != "*" {
+				index, _ = strconv.Atoi(digits)
+			}
+			keys = append(keys, index)
+		}
+	}
+	if end != len(path) || len(keys) == 0 {
+		return nil, fmt.Errorf("invalid values path %q", path)
+	}
+	if _, isIndex := keys[0].(int); isIndex {
+		return nil, fmt.Errorf("invalid values path %q: it must start with a key", path)
+	}
+	return keys, nil
+}
+
+// FormatValuesPath writes the keys as a values path, quoting the keys with
+// special characters, as yaml documents are scanned
+func FormatValuesPath(keys []interface{}) string {
+	path := ""
+	for _, key := range keys {
+		switch key := key.(type) {
+		case string:
+			path = yamlops.JoinPath(path, key)
+		case int:
+			if key == wildcardIndex {
+				path += Wildcard
+			} else {
+				path += fmt.Sprintf("[%d]", key)
+			}
+		}
+	}
+	return path
+}
+
+// lookupKeys walks the values following the parsed path keys
+func lookupKeys(values interface{}, keys []interface{}) (interface{}, bool) {
+	value := values
+	for _, key := range keys {
+		switch key := key.(type) {
+		case string:
+			m, ok := asValuesMap(value)
+			if !ok {
+				return nil, false
+			}
+			if value, ok = m[key]; !ok {
+				return nil, false
+			}
+		case int:
+			list, ok := value.([]interface{})
+			if !ok || key < 0 || key >= len(list) {
+				return nil, false
+			}
+			value = list[key]
+		}
+	}
+	return value, true
+}
+
+// setValue returns the values with the value set at the parsed path keys. The
+// maps and lists along the path are copied, the original values are left
+// untouched. List items must exist
+func setValue(values interface{}, keys []interface{}, value interface{}) (interface{}, error) {
+	if len(keys) == 0 {
+		return value, nil
+	}
+	switch key := keys[0].(type) {
+	case string:
+		m := map[string]interface{}{}
+		if values != nil {
+			original, ok := asValuesMap(values)
+			if !ok {
+				return nil, fmt.Errorf("can't set key %q, the value is a %T and not a map", key, values)
+			}
+			for k, v := range original {
+				m[k] = v
+			}
+		}
+		child, err := setValue(m[key], keys[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = child
+		return m, nil
+	case int:
+		list, ok := values.([]interface{})
+		if !ok || key < 0 || key >= len(list) {
+			return nil, fmt.Errorf("list item [%d] not found", key)
+		}
+		list = append([]interface{}{}, list...)
+		child, err := setValue(list[key], keys[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		list[key] = child
+		return list, nil
+	}
+	return nil, fmt.Errorf("invalid values path key %v", keys[0])
+}
+
+func asValuesMap(value interface{}) (map[string]interface{}, bool) {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m, true
+	case ValuesMap:
+		return m, true
+	}
+	return nil, false
+}
+
+// HasWildcard tells if the template iterates over the items of a list
+func (t *ImageTemplate) HasWildcard() bool {
+	return strings.Contains(t.Raw, Wildcard) || strings.Contains(t.Condition, Wildcard)
+}
+
+// Expand returns a template for each item of the list the template wildcards
+// iterate over in the chart values, with the wildcard replaced by the item
+// index. Missing lists expand to no templates. Templates with no wildcards
+// are returned as is
+func (t *ImageTemplate) Expand(chart *chart.Chart) ([]*ImageTemplate, error) {
+	if t.TemplateImage != "" {
+		return []*ImageTemplate{t}, nil
+	}
+	listPath := ""
+	for _, path := range append(t.Paths(), t.Condition) {
+		if i := strings.Index(path, Wildcard); i >= 0 {
+			listPath = path[:i]
+			break
+		}
+	}
+	if listPath == "" {
+		return []*ImageTemplate{t}, nil
+	}
+
+	value, ok := LookupValue(chart, listPath)
+	if !ok || value == nil {
+		return []*ImageTemplate{}, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("image template %q: values path %s is a %T, expected a list", t.Raw, listPath, value)
+	}
+
+	expanded := []*ImageTemplate{}
+	for i := range list {
+		item := fmt.Sprintf("%s[%d]", listPath, i)
+		template, err := NewFromString(strings.ReplaceAll(t.Raw, listPath+Wildcard, item))
+		if err != nil {
+			return nil, err
+		}
+		template.Optional = t.Optional
+		template.Condition = strings.ReplaceAll(t.Condition, listPath+Wildcard, item)
+		template.Platforms = t.Platforms
+
+		// Nested lists have wildcards left
+		items, err := template.Expand(chart)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, items...)
+	}
+	return expanded, nil
+}
+
+// ExpandImagePatterns expands the wildcards of the templates in the chart values
+func ExpandImagePatterns(chart *chart.Chart, templates []*ImageTemplate) ([]*ImageTemplate, error) {
+	expanded := []*ImageTemplate{}
+	for _, template := range templates {
+		items, err := template.Expand(chart)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, items...)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package internal_test
+
+import (
+	"github.com/google/go-containerregistry/pkg/name"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/chart"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+)
+
+var _ = Describe("Values paths with list items", func() {
+	const valuesYAML = `sidecars:
+- name: proxy
+  image: docker.io/envoyproxy/envoy:v1.22.0
+- name: logs
+  image: docker.io/fluent/fluent-bit:1.9
+jobs:
+- containers:
+  - image: docker.io/bitnami/kubectl:1.24
+`
+	var c *chart.Chart
+
+	BeforeEach(func() {
+		c = &chart.Chart{
+			Metadata: &chart.Metadata{Name: "app"},
+			Values: map[string]interface{}{
+				"sidecars": []interface{}{
+					map[string]interface{}{"name": "proxy", "image": "docker.io/envoyproxy/envoy:v1.22.0"},
+					map[string]interface{}{"name": "logs", "image": "docker.io/fluent/fluent-bit:1.9"},
+				},
+				"jobs": []interface{}{
+					map[string]interface{}{"containers": []interface{}{
+						map[string]interface{}{"image": "docker.io/bitnami/kubectl:1.24"},
+					}},
+				},
+			},
+			Raw: []*chart.File{{Name: "values.yaml", Data: []byte(valuesYAML)}},
+		}
+	})
+
+	It("looks up list items", func() {
+		value, ok := internal.LookupValue(c, ".sidecars[1].name")
+		Expect(ok).To(BeTrue())
+		Expect(value).To(Equal("logs"))
+
+		_, ok = internal.LookupValue(c, ".sidecars[2].name")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("expands wildcards into a template per list item", func() {
+		template, err := internal.NewFromString("{{ .sidecars[*].image }}")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(template.HasWildcard()).To(BeTrue())
+		_, err = template.Render(c)
+		Expect(err).To(MatchError(ContainSubstring("must be expanded first")))
+
+		templates, err := internal.ExpandImagePatterns(c, []*internal.ImageTemplate{template})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(templates).To(HaveLen(2))
+		Expect(templates[0].Raw).To(Equal("{{ .sidecars[0].image }}"))
+		Expect(templates[1].Raw).To(Equal("{{ .sidecars[1].image }}"))
+
+		image, err := templates[1].Render(c)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(image.Name()).To(Equal("index.docker.io/fluent/fluent-bit:1.9"))
+	})
+
+	It("expands nested wildcards", func() {
+		template, err := internal.NewFromString("{{ .jobs[*].containers[*].image }}")
+		Expect(err).ToNot(HaveOccurred())
+		templates, err := template.Expand(c)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(templates).To(HaveLen(1))
+		Expect(templates[0].Raw).To(Equal("{{ .jobs[0].containers[0].image }}"))
+	})
+
+	It("expands missing lists into no templates and fails on other values", func() {
+		template, err := internal.NewFromString("{{ .initContainers[*].image }}")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(template.Expand(c)).To(BeEmpty())
+
+		template, err = internal.NewFromString("{{ .sidecars[0].name[*] }}")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = template.Expand(c)
+		Expect(err).To(MatchError(ContainSubstring("values path .sidecars[0].name is a string, expected a list")))
+	})
+
+	It("renders and applies rewrites of list items", func() {
+		action := &internal.RewriteAction{Path: ".sidecars[1].image", Value: "harbor-repo.vmware.com/pwall/fluent-bit:1.9"}
+		template, err := internal.NewFromString("{{ .sidecars[1].image }}")
+		Expect(err).ToNot(HaveOccurred())
+
+		image, err := template.Render(c, action)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(image.Name()).To(Equal("harbor-repo.vmware.com/pwall/fluent-bit:1.9"))
+		value, _ := internal.LookupValue(c, ".sidecars[1].image")
+		Expect(value).To(Equal("docker.io/fluent/fluent-bit:1.9"), "rendering must not modify the chart values")
+
+		Expect(action.Apply(c)).To(Succeed())
+		Expect(string(c.Raw[0].Data)).To(Equal(`sidecars:
+- name: proxy
+  image: docker.io/envoyproxy/envoy:v1.22.0
+- name: logs
+  image: harbor-repo.vmware.com/pwall/fluent-bit:1.9
+jobs:
+- containers:
+  - image: docker.io/bitnami/kubectl:1.24
+`))
+	})
+
+	It("parses and formats quoted keys", func() {
+		keys, err := internal.ParseValuesPath(`.["app.kubernetes.io/name"].plain["with \"quotes\""][0].["a b"]`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(keys).To(Equal([]interface{}{"app.kubernetes.io/name", "plain", `with "quotes"`, 0, "a b"}))
+		Expect(internal.FormatValuesPath(keys)).To(Equal(`.["app.kubernetes.io/name"].plain["with \"quotes\""][0]["a b"]`))
+
+		_, err = internal.ParseValuesPath(`.["unterminated]`)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Values keys with special characters", func() {
+	It("renders and applies rewrites of quoted keys", func() {
+		c := &chart.Chart{
+			Metadata: &chart.Metadata{Name: "app"},
+			Values: map[string]interface{}{
+				"images": map[string]interface{}{
+					"app.kubernetes.io/proxy": map[string]interface{}{"repository": "docker.io/envoyproxy/envoy", "tag": "v1.22.0"},
+				},
+			},
+			Raw: []*chart.File{{Name: "values.yaml", Data: []byte(`images:
+  app.kubernetes.io/proxy:
+    repository: docker.io/envoyproxy/envoy
+    tag: v1.22.0
+`)}},
+		}
+		template, err := internal.NewFromString(`{{ .images["app.kubernetes.io/proxy"].repository }}:{{ .images["app.kubernetes.io/proxy"].tag }}`)
+		Expect(err).ToNot(HaveOccurred())
+		image, err := template.Render(c)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(image.Name()).To(Equal("index.docker.io/envoyproxy/envoy:v1.22.0"))
+
+		repository, err := name.NewRepository("docker.io/envoyproxy/envoy")
+		Expect(err).ToNot(HaveOccurred())
+		actions, err := template.Apply(repository, "sha256:aaaa", &internal.OCIImageLocation{Registry: "harbor-repo.vmware.com"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actions).To(HaveLen(1))
+		Expect(actions[0].Apply(c)).To(Succeed())
+		Expect(string(c.Raw[0].Data)).To(Equal(`images:
+  app.kubernetes.io/proxy:
+    repository: harbor-repo.vmware.com/envoyproxy/envoy
+    tag: v1.22.0
+`))
+	})
+})
@@ -0,0 +1,56 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package yamlops
+
+import (
+	"bufio"
+	"bytes"
+)
+
+// SplitDocuments splits a multi-document YAML stream into its documents.
+//
+// Every byte of the stream is kept, document separators included, so that the
+// documents can be updated on their own, i.e with UpdateMap, and joined back
+// with JoinDocuments without disturbing any other content.
+func SplitDocuments(stream []byte) [][]byte {
+	docs := [][]byte{}
+	current := []byte{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(stream))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(stream)+1)
+	scanner.Split(scanNewLine)
+	offset := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		end := offset + len(line)
+		if end < len(stream) {
+			end++ // the newline
+		}
+		if isDocumentSeparator(line) && len(current) > 0 {
+			docs = append(docs, current)
+			current = []byte{}
+		}
+		current = append(current, stream[offset:end]...)
+		offset = end
+	}
+	if len(current) > 0 {
+		docs = append(docs, current)
+	}
+	return docs
+}
+
+// JoinDocuments puts back together the documents returned by SplitDocuments
+func JoinDocuments(docs [][]byte) []byte {
+	return bytes.Join(docs, nil)
+}
+
+// isDocumentSeparator returns true for the "---" lines starting a document
+func isDocumentSeparator(line []byte) bool {
+	line = bytes.TrimRight(line, "\r")
+	if !bytes.HasPrefix(line, []byte("---")) {
+		return false
+	}
+	rest := line[3:]
+	return len(rest) == 0 || rest[0] == ' ' || rest[0] == '\t'
+}
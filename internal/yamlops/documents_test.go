@@ -0,0 +1,55 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package yamlops_test
+
+import (
+	"reflect"
+	"testing"
+
+	yamlops2 "github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal/yamlops"
+)
+
+func TestSplitDocuments(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		docs   []string
+	}{
+		{
+			"single document",
+			"a: 1\nb: 2\n",
+			[]string{"a: 1\nb: 2\n"},
+		},
+		{
+			"documents with separators",
+			"# leading comment\na: 1\n---\nb: 2\n--- # c\nc: 3",
+			[]string{"# leading comment\na: 1\n", "---\nb: 2\n", "--- # c\nc: 3"},
+		},
+		{
+			"leading separator",
+			"---\na: 1\n---\r\nb: 2\r\n",
+			[]string{"---\na: 1\n", "---\r\nb: 2\r\n"},
+		},
+		{
+			"separator-like content",
+			"a: |\n  ---\n  text\n----: 1\n",
+			[]string{"a: |\n  ---\n  text\n----: 1\n"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			docs := yamlops2.SplitDocuments([]byte(test.stream))
+			got := []string{}
+			for _, doc := range docs {
+				got = append(got, string(doc))
+			}
+			if !reflect.DeepEqual(got, test.docs) {
+				t.Errorf("want %q, got %q", test.docs, got)
+			}
+			if joined := string(yamlops2.JoinDocuments(docs)); joined != test.stream {
+				t.Errorf("want joined %q, got %q", test.stream, joined)
+			}
+		})
+	}
+}
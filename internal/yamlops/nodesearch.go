@@ -4,6 +4,7 @@
 package yamlops
 
 import (
+	"regexp"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -40,13 +41,19 @@ NextNode:
 }
 
 // NodeHasPath returns a NodeMatchFunc that tests if the node's path matches the
-// query spec.
+// query spec, e.g. ".some.path.in.a.list[0].to.a.field". A "[*]" in the spec
+// matches any list item, e.g. ".sidecars[*].image". Keys with special
+// characters must be quoted as PathKey does, e.g. `.labels["app.kubernetes.io/name"]`.
 func NodeHasPath(spec string) NodeMatchFunc {
-	// TODO(mgoodall): parse the spec for complex key names, any list item,
-	// etc.  But for now, assume it's exact all the way down, e.g. a relatively
-	// simple ".some.path.in.a.list[0].to.a.field".
+	if !strings.Contains(spec, "[*]") {
+		return func(node *yaml.Node, path string) bool {
+			return path == spec
+		}
+	}
+	pattern := strings.ReplaceAll(regexp.QuoteMeta(spec), `\[\*\]`, `\[\d+\]`)
+	re := regexp.MustCompile("^" + pattern + "$")
 	return func(node *yaml.Node, path string) bool {
-		return path == spec
+		return re.MatchString(path)
 	}
 }
 
@@ -74,6 +74,11 @@ func TestNodeHasPath(t *testing.T) {
 		{".foo", ".bar", false},
 		{".[0]", ".[0]", true},
 		{".[0]", ".[1]", false},
+		{".a[*].image", ".a[0].image", true},
+		{".a[*].image", ".a[12].image", true},
+		{".a[*].image", ".a.image", false},
+		{".a[*].image", ".ab[0].image", false},
+		{".a[*].b[*]", ".a[1].b[2]", true},
 	}
 
 	for i, test := range tests {
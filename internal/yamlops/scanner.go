@@ -48,9 +48,7 @@ func (ns *NodeScanner) Next() bool {
 			case "!!map":
 				name := top.node.Content[top.content]
 				value := top.node.Content[top.content+1]
-				// TODO(mgoodall): trim probably shouldn't happen, but is
-				// currently needed to handle children of the root (`.`) node.
-				ns.stack = append(ns.stack, &stackItem{value, strings.TrimRight(top.path, ".") + "." + name.Value, 0})
+				ns.stack = append(ns.stack, &stackItem{value, JoinPath(top.path, name.Value), 0})
 				top.content += 2
 			case "!!seq":
 				content := top.node.Content[top.content]
@@ -75,3 +73,28 @@ func (ns *NodeScanner) Current() (*yaml.Node, string) {
 	current := ns.stack[len(ns.stack)-1]
 	return current.node, current.path
 }
+
+// PathKey returns how a map key is written in a node path: .key, or ["key"],
+// quoted as a Go string, when the key holds characters with a meaning in
+// paths, such as dots, or spaces.
+func PathKey(key string) string {
+	if key == "" || strings.ContainsAny(key, ".[]\"{} \t\n") {
+		return fmt.Sprintf("[%q]", key)
+	}
+	return "." + key
+}
+
+// JoinPath appends the map key to the node path. Quoted keys of the root node
+// keep its dot, as in .["app.kubernetes.io/name"].
+func JoinPath(path, key string) string {
+	pathKey := PathKey(key)
+	if strings.HasPrefix(pathKey, ".") {
+		// TODO(mgoodall): trim probably shouldn't happen, but is
+		// currently needed to handle children of the root (`.`) node.
+		return strings.TrimRight(path, ".") + pathKey
+	}
+	if path == "" {
+		return "." + pathKey
+	}
+	return path + pathKey
+}
@@ -93,6 +93,17 @@ func TestScannerSimple(t *testing.T) {
 				{".outer.inner.foo", "!!str", "bar"},
 			},
 		},
+		{
+			"map with special keys",
+			"app.kubernetes.io/name:\n  my-sub.chart: a\n  plain-key: b\n  \"with [brackets]\": c",
+			[]node{
+				{".", "!!map", ""},
+				{`.["app.kubernetes.io/name"]`, "!!map", ""},
+				{`.["app.kubernetes.io/name"]["my-sub.chart"]`, "!!str", "a"},
+				{`.["app.kubernetes.io/name"].plain-key`, "!!str", "b"},
+				{`.["app.kubernetes.io/name"]["with [brackets]"]`, "!!str", "c"},
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -8,6 +8,8 @@ import (
 	"bytes"
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -26,6 +28,8 @@ import (
 //
 // It should be possible to remove some of these limitations as needed.
 //
+// Items of a matching list are updated by naming them "[index]" in values.
+//
 // Examples:
 //
 // Update a Chart's values.yaml to set a specific image's reference:
@@ -203,8 +207,19 @@ func parse(doc []byte) (*yaml.Node, error) {
 	return node.Content[0], nil
 }
 
-// Find the named field's value in the map node.
+// Find the named field's value in the map node, or the item of a sequence
+// node named by its "[index]".
 func yamlMapFieldValueNode(node *yaml.Node, name string) (*yaml.Node, bool) {
+	if node.Kind == yaml.SequenceNode {
+		if !strings.HasPrefix(name, "[") || !strings.HasSuffix(name, "]") {
+			return nil, false
+		}
+		index, err := strconv.Atoi(name[1 : len(name)-1])
+		if err != nil || index < 0 || index >= len(node.Content) {
+			return nil, false
+		}
+		return node.Content[index], true
+	}
 	for i := 0; i < len(node.Content); i += 2 {
 		k, v := node.Content[i], node.Content[i+1]
 		if k.Value == name {
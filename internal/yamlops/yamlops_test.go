@@ -35,6 +35,22 @@ func TestUpdateMap(t *testing.T) {
 			map[string]string{"foo": "xxx"},
 			"- name: a\n  foo: xxx\n- name: b\n  foo: b foo",
 		},
+		{
+			"updates list item with path",
+			"a:\n  images:\n  - a image\n  - b image",
+			".a.images",
+			nil,
+			map[string]string{"[1]": "xxx"},
+			"a:\n  images:\n  - a image\n  - xxx",
+		},
+		{
+			"updates map with quoted keys in path",
+			"a.b:\n  \"c d\":\n    foo: a foo",
+			`.["a.b"]["c d"]`,
+			nil,
+			map[string]string{"foo": "xxx"},
+			"a.b:\n  \"c d\":\n    foo: xxx",
+		},
 		{
 			"updates nested map with path",
 			"a:\n  b:\n    foo: a b foo",
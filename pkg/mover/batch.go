@@ -0,0 +1,281 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+)
+
+// ErrBatchMoveFailed indicates that at least one of the charts in a batch
+// could not be relocated
+var ErrBatchMoveFailed = errors.New("failed to relocate some charts")
+
+// ChartMoveResult reports the outcome of relocating one of the charts of a batch
+type ChartMoveResult struct {
+	// Chart as name@version, or its source reference if it could not be loaded
+	Chart string
+	// Err is nil if the chart was relocated
+	Err error
+}
+
+// BatchMover relocates several charts at once. Images shared by the charts
+// are pulled, checked and pushed only once. Its initialization must be done
+// via NewBatchMover
+type BatchMover struct {
+	movers []*ChartMover
+	// results, in request order. Charts failing to load already have their error
+	results []*ChartMoveResult
+	// settings holds the options common to all the charts, used for the batch output
+	settings *ChartMover
+}
+
+// NewBatchMover creates a BatchMover for the given move requests. Charts
+// failing to load or to compute their relocation are reported in the move
+// results instead of aborting the whole batch, unlike images of different
+// charts colliding on the same target.
+func NewBatchMover(reqs []*ChartMoveRequest, opts ...Option) (*BatchMover, error) {
+	if len(reqs) == 0 {
+		return nil, errors.New("no charts to relocate")
+	}
+
+	bm := &BatchMover{settings: &ChartMover{logger: defaultLogger{}, retries: DefaultRetries}}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(bm.settings)
+		}
+	}
+	log := bm.settings.logger
+
+	cache := newRegistryCache()
+	for _, req := range reqs {
+		result := &ChartMoveResult{Chart: sourceName(&req.Source)}
+		bm.results = append(bm.results, result)
+		if req.Target.Chart.IntermediateBundle != nil {
+			result.Err = errors.New("intermediate bundles are not supported as batch targets")
+			bm.movers = append(bm.movers, nil)
+			continue
+		}
+
+		log.Printf("Loading %s...\n", result.Chart)
+		cm, err := NewChartMover(req, append(opts, withRegistryCache(cache))...)
+		if err != nil {
+			result.Err = err
+			bm.movers = append(bm.movers, nil)
+			continue
+		}
+		result.Chart = fmt.Sprintf("%s@%s", cm.chart.Name(), cm.chart.Metadata.Version)
+		bm.movers = append(bm.movers, cm)
+	}
+
+	// Images of different charts relocated to the same reference can't be
+	// told apart once pushed, so they abort the whole batch
+	if err := detectCollisions(bm.imageChanges()); err != nil {
+		return nil, err
+	}
+	return bm, nil
+}
+
+// imageChanges returns the image changes of all the loaded charts
+func (bm *BatchMover) imageChanges() []*internal.ImageChange {
+	changes := []*internal.ImageChange{}
+	for _, cm := range bm.movers {
+		if cm != nil {
+			changes = append(changes, cm.imageChanges...)
+		}
+	}
+	return changes
+}
+
+// Print shows the deduplicated image copies across all charts, followed by
+// the changes to be applied to each chart
+func (bm *BatchMover) Print() {
+	unique := bm.uniqueImageChanges(func(*internal.ImageChange) bool { return true })
+	if len(unique) > 0 {
+		bm.settings.printImageCopies(unique)
+	}
+
+	log := bm.settings.logger
+	for i, cm := range bm.movers {
+		result := bm.results[i]
+		if cm == nil {
+			log.Printf("\nSkipping %s: %s\n", result.Chart, result.Err)
+			continue
+		}
+		log.Printf("\nChart %s:\n", result.Chart)
+		cm.printChartMove()
+		cm.printSkippedImages()
+	}
+}
+
+// Move pushes every image once and then relocates each of the charts whose
+// images were pushed. It returns the result of each chart, in request order,
+// and ErrBatchMoveFailed if any of them failed.
+func (bm *BatchMover) Move() ([]*ChartMoveResult, error) {
+	pushErrors := map[string]error{}
+	for _, change := range bm.uniqueImageChanges((*internal.ImageChange).ShouldPush) {
+		if err := bm.owner(change).pushRewrittenImages([]*internal.ImageChange{change}); err != nil {
+			pushErrors[change.RewrittenReference.Name()] = err
+		}
+	}
+
+	failed := false
+	for i, cm := range bm.movers {
+		result := bm.results[i]
+		if cm != nil {
+			bm.settings.logger.Printf("Relocating %s...\n", result.Chart)
+			result.Err = relocateBatchChart(cm, pushErrors)
+		}
+		if result.Err != nil {
+			failed = true
+		}
+	}
+
+	if failed {
+		return bm.results, ErrBatchMoveFailed
+	}
+	return bm.results, nil
+}
+
+// relocateBatchChart relocates the chart unless any of its images failed to be pushed
+func relocateBatchChart(cm *ChartMover, pushErrors map[string]error) error {
+	for _, change := range cm.imageChanges {
+		if err, ok := pushErrors[change.RewrittenReference.Name()]; ok {
+			return fmt.Errorf("failed to push image %s: %w", change.RewrittenReference.Name(), err)
+		}
+	}
+	return cm.relocateChart()
+}
+
+// uniqueImageChanges returns the image changes of all the charts, once per
+// rewritten reference, that match the filter
+func (bm *BatchMover) uniqueImageChanges(filter func(*internal.ImageChange) bool) []*internal.ImageChange {
+	unique := []*internal.ImageChange{}
+	seen := map[string]bool{}
+	for _, cm := range bm.movers {
+		if cm == nil {
+			continue
+		}
+		for _, change := range cm.imageChanges {
+			if !filter(change) || seen[change.RewrittenReference.Name()] {
+				continue
+			}
+			seen[change.RewrittenReference.Name()] = true
+			unique = append(unique, change)
+		}
+	}
+	return unique
+}
+
+// owner returns the chart mover the image change belongs to
+func (bm *BatchMover) owner(change *internal.ImageChange) *ChartMover {
+	for _, cm := range bm.movers {
+		if cm == nil {
+			continue
+		}
+		for _, c := range cm.imageChanges {
+			if c == change {
+				return cm
+			}
+		}
+	}
+	return nil
+}
+
+// sourceName describes the chart source before it is loaded
+func sourceName(src *Source) string {
+	switch {
+	case src.Chart.Local != nil:
+		return src.Chart.Local.Path
+	case src.Chart.IntermediateBundle != nil:
+		return src.Chart.IntermediateBundle.Path
+	case src.Chart.OCI != nil:
+		return src.Chart.OCI.Reference
+	case src.Chart.Repository != nil:
+		return fmt.Sprintf("%s from %s", src.Chart.Repository.Name, src.Chart.Repository.URL)
+	}
+	return "unknown chart"
+}
+
+// registryCache remembers pulled images and push checks so that charts
+// sharing images do not pull or check them more than once
+type registryCache struct {
+	pulls  map[string]*cachedPull
+	checks map[string]*cachedCheck
+}
+
+type cachedPull struct {
+	image  v1.Image
+	digest string
+}
+
+type cachedCheck struct {
+	needToPush bool
+}
+
+func newRegistryCache() *registryCache {
+	return &registryCache{
+		pulls:  map[string]*cachedPull{},
+		checks: map[string]*cachedCheck{},
+	}
+}
+
+// withRegistryCache makes the chart mover registries go through the cache
+func withRegistryCache(cache *registryCache) Option {
+	return func(cm *ChartMover) {
+		cm.sourceContainerRegistry = &cachedRegistry{ContainerRegistryInterface: cm.sourceContainerRegistry, cache: cache}
+		cm.targetContainerRegistry = &cachedRegistry{ContainerRegistryInterface: cm.targetContainerRegistry, cache: cache}
+	}
+}
+
+// cachedRegistry caches the pull and check results of the wrapped registry.
+// Failures are not cached, so that later charts retry them. Pushes are never
+// cached, BatchMover already pushes each image once
+type cachedRegistry struct {
+	internal.ContainerRegistryInterface
+	cache *registryCache
+}
+
+func (r *cachedRegistry) Pull(imageReference name.Reference) (v1.Image, string, error) {
+	if pull, ok := r.cache.pulls[imageReference.Name()]; ok {
+		return pull.image, pull.digest, nil
+	}
+	image, digest, err := r.ContainerRegistryInterface.Pull(imageReference)
+	if err != nil {
+		return nil, "", err
+	}
+	r.cache.pulls[imageReference.Name()] = &cachedPull{image: image, digest: digest}
+	return image, digest, nil
+}
+
+func (r *cachedRegistry) PullPlatform(imageReference name.Reference, platform *v1.Platform) (v1.Image, string, error) {
+	key := imageReference.Name() + " " + platform.String()
+	if pull, ok := r.cache.pulls[key]; ok {
+		return pull.image, pull.digest, nil
+	}
+	image, digest, err := r.ContainerRegistryInterface.PullPlatform(imageReference, platform)
+	if err != nil {
+		return nil, "", err
+	}
+	r.cache.pulls[key] = &cachedPull{image: image, digest: digest}
+	return image, digest, nil
+}
+
+func (r *cachedRegistry) Check(digest string, imageReference name.Reference) (bool, error) {
+	key := imageReference.Name() + "@" + digest
+	if check, ok := r.cache.checks[key]; ok {
+		return check.needToPush, nil
+	}
+	needToPush, err := r.ContainerRegistryInterface.Check(digest, imageReference)
+	if err != nil {
+		return false, err
+	}
+	r.cache.checks[key] = &cachedCheck{needToPush: needToPush}
+	return needToPush, nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/chart/loader"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal/internalfakes"
+)
+
+var _ = Describe("BatchMover", func() {
+	const digest = "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+
+	var (
+		fakeRegistry *internalfakes.FakeContainerRegistryInterface
+		outDir       string
+	)
+
+	BeforeEach(func() {
+		fakeRegistry = &internalfakes.FakeContainerRegistryInterface{}
+		var err error
+		outDir, err = os.MkdirTemp("", "batch-test-*")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(outDir)
+	})
+
+	batchChartMover := func(out, rewritten string) *ChartMover {
+		c, err := loader.Load(filepath.Join(fixturesRoot, "testchart"))
+		Expect(err).ToNot(HaveOccurred())
+		rewrittenRef, err := name.ParseReference(rewritten)
+		Expect(err).ToNot(HaveOccurred())
+		return &ChartMover{
+			chart:                   c,
+			chartDestination:        filepath.Join(outDir, out),
+			targetContainerRegistry: fakeRegistry,
+			logger:                  NoLogger,
+			retries:                 1,
+			imageChanges: []*internal.ImageChange{{
+				ImageReference:     name.MustParseReference("docker.io/bitnami/wordpress:1.2.3"),
+				RewrittenReference: rewrittenRef,
+				Image:              makeImage(digest),
+				Digest:             digest,
+				Tag:                "1.2.3",
+			}},
+		}
+	}
+
+	It("pushes shared images once and relocates every chart", func() {
+		bm := &BatchMover{
+			movers: []*ChartMover{
+				batchChartMover("first.tgz", "harbor-repo.vmware.com/pwall/wordpress:1.2.3"),
+				batchChartMover("second.tgz", "harbor-repo.vmware.com/pwall/wordpress:1.2.3"),
+			},
+			results:  []*ChartMoveResult{{Chart: "first"}, {Chart: "second"}},
+			settings: &ChartMover{logger: NoLogger},
+		}
+
+		results, err := bm.Move()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fakeRegistry.PushCallCount()).To(Equal(1))
+		for _, result := range results {
+			Expect(result.Err).ToNot(HaveOccurred())
+		}
+		Expect(filepath.Join(outDir, "first.tgz")).To(BeAnExistingFile())
+		Expect(filepath.Join(outDir, "second.tgz")).To(BeAnExistingFile())
+	})
+
+	It("reports the charts whose images failed to be pushed", func() {
+		fakeRegistry.PushStub = func(_ v1.Image, ref name.Reference) error {
+			if ref.Context().RepositoryStr() == "broken/wordpress" {
+				return errors.New("push failed")
+			}
+			return nil
+		}
+		bm := &BatchMover{
+			movers: []*ChartMover{
+				batchChartMover("first.tgz", "harbor-repo.vmware.com/broken/wordpress:1.2.3"),
+				nil,
+				batchChartMover("third.tgz", "harbor-repo.vmware.com/pwall/wordpress:1.2.3"),
+			},
+			results: []*ChartMoveResult{
+				{Chart: "first"}, {Chart: "second", Err: errors.New("failed to load")}, {Chart: "third"},
+			},
+			settings: &ChartMover{logger: NoLogger},
+		}
+
+		results, err := bm.Move()
+		Expect(err).To(MatchError(ErrBatchMoveFailed))
+		Expect(results[0].Err).To(MatchError(ContainSubstring("push failed")))
+		Expect(results[1].Err).To(MatchError("failed to load"))
+		Expect(results[2].Err).ToNot(HaveOccurred())
+		Expect(filepath.Join(outDir, "first.tgz")).ToNot(BeAnExistingFile())
+		Expect(filepath.Join(outDir, "third.tgz")).To(BeAnExistingFile())
+	})
+
+	It("detects distinct images of different charts relocated to the same reference", func() {
+		first := batchChartMover("first.tgz", "harbor-repo.vmware.com/pwall/wordpress:1.2.3")
+		second := batchChartMover("second.tgz", "harbor-repo.vmware.com/pwall/wordpress:1.2.3")
+		bm := &BatchMover{movers: []*ChartMover{first, nil, second}}
+		Expect(detectCollisions(bm.imageChanges())).To(Succeed())
+
+		second.imageChanges[0].ImageReference = name.MustParseReference("quay.io/bitnami/wordpress:1.2.3")
+		second.imageChanges[0].Digest = "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+		err := detectCollisions(bm.imageChanges())
+		Expect(errors.Is(err, ErrTargetCollision)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("harbor-repo.vmware.com/pwall/wordpress:1.2.3 <=\n" +
+			"    index.docker.io/bitnami/wordpress:1.2.3 (" + digest + ")\n" +
+			"    quay.io/bitnami/wordpress:1.2.3 (sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb)"))
+	})
+
+	It("pulls and checks shared images once", func() {
+		fakeRegistry.PullReturns(makeImage(digest), digest, nil)
+		fakeRegistry.CheckReturns(true, nil)
+		cache := newRegistryCache()
+		first := &ChartMover{sourceContainerRegistry: fakeRegistry, targetContainerRegistry: fakeRegistry}
+		second := &ChartMover{sourceContainerRegistry: fakeRegistry, targetContainerRegistry: fakeRegistry}
+		withRegistryCache(cache)(first)
+		withRegistryCache(cache)(second)
+
+		ref := name.MustParseReference("docker.io/bitnami/wordpress:1.2.3")
+		target := name.MustParseReference("harbor-repo.vmware.com/pwall/wordpress:1.2.3")
+		for _, cm := range []*ChartMover{first, second} {
+			_, pulledDigest, err := cm.sourceContainerRegistry.Pull(ref)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pulledDigest).To(Equal(digest))
+			needToPush, err := cm.targetContainerRegistry.Check(digest, target)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(needToPush).To(BeTrue())
+		}
+		Expect(fakeRegistry.PullCallCount()).To(Equal(1))
+		Expect(fakeRegistry.CheckCallCount()).To(Equal(1))
+	})
+	It("retries failed pulls", func() {
+		fakeRegistry.PullReturnsOnCall(0, nil, "", errors.New("connection reset"))
+		fakeRegistry.PullReturnsOnCall(1, makeImage(digest), digest, nil)
+		cache := newRegistryCache()
+		cm := &ChartMover{sourceContainerRegistry: fakeRegistry, targetContainerRegistry: fakeRegistry}
+		withRegistryCache(cache)(cm)
+
+		ref := name.MustParseReference("docker.io/bitnami/wordpress:1.2.3")
+		_, _, err := cm.sourceContainerRegistry.Pull(ref)
+		Expect(err).To(MatchError("connection reset"))
+		_, pulledDigest, err := cm.sourceContainerRegistry.Pull(ref)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pulledDigest).To(Equal(digest))
+		_, _, err = cm.sourceContainerRegistry.Pull(ref)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fakeRegistry.PullCallCount()).To(Equal(2))
+	})
+})
@@ -6,6 +6,7 @@ package mover
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -17,6 +18,7 @@ import (
 	"github.com/avast/retry-go"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/mitchellh/copystructure"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/chartutil"
@@ -98,6 +100,54 @@ type LocalChart struct {
 // the hints file and container images
 type IntermediateBundle LocalChart
 
+// OCIChart is a reference to a chart stored in an OCI registry,
+// i.e oci://registry.example.com/charts/mariadb:11.0.4
+//
+// As a target, the reference is the base repository path where the chart is
+// pushed as name:version, i.e oci://registry.example.com/charts
+// If empty, the chart is placed according to the target rewrite rules.
+type OCIChart struct {
+	Reference string
+}
+
+// RepositoryChart is a reference to a chart published in a Helm HTTP repository
+type RepositoryChart struct {
+	// URL of the repository, where its index.yaml can be found
+	URL  string
+	Name string
+	// Version is either an exact chart version or a semver constraint, i.e 11.x
+	// The latest version is used if empty
+	Version string
+}
+
+// RepositoryDir is a local directory served as a static Helm HTTP repository.
+// Relocated charts are added to it and merged into its index.yaml
+type RepositoryDir struct {
+	Path string
+	// URL the directory is served from, used for the index entries as in
+	// helm repo index --url. Entries are relative to the index if empty
+	URL string
+}
+
+// ChartMuseum is a Helm HTTP repository supporting the ChartMuseum upload
+// API (POST /api/charts)
+type ChartMuseum struct {
+	URL                string
+	Username, Password string
+}
+
+// RelocatedDependencies keeps the dependencies declared in Chart.yaml, and
+// Chart.lock, pointing them to where the relocated subcharts are published
+// instead of removing them, so that helm dependency update keeps working
+type RelocatedDependencies struct {
+	// Repository the dependencies point to, either an oci:// base path or a
+	// Helm HTTP repository URL. The relocated subcharts must be published there
+	// separately.
+	// If empty, the subcharts are published along with the chart to its OCI,
+	// repository directory or ChartMuseum target, in that order of preference
+	Repository string
+}
+
 // OCICredentials defines a private repo name and credentials
 type OCICredentials struct {
 	Server             string
@@ -116,13 +166,43 @@ type ContainersAuth struct {
 type ChartSpec struct {
 	Local              *LocalChart
 	IntermediateBundle *IntermediateBundle
+	OCI                *OCIChart
+	Repository         *RepositoryChart
+	RepositoryDir      *RepositoryDir
+	ChartMuseum        *ChartMuseum
+	KustomizeOverlay   *KustomizeOverlay
+	ValuesOverride     *ValuesOverride
 }
 
 // Source of the chart move
 type Source struct {
 	Chart          ChartSpec
 	ImageHintsFile string
+	// ImageHintsFiles are more image hints files, merged with ImageHintsFile
+	ImageHintsFiles []string
+	// MergeHints merges the image hints files with the hints found in the
+	// chart: its embedded hints file, its artifacthub.io/images annotation and
+	// the hints files of its subcharts. Otherwise the image hints files, if
+	// any, replace them
+	MergeHints     bool
 	ContainersAuth *ContainersAuth
+	// VerifyCoverage fails the move if the image hints miss images of the
+	// workloads rendered from the chart templates
+	VerifyCoverage bool
+	// RelocateDisabled relocates the images of the components and subcharts
+	// the chart values disable too, so they can be enabled at install time.
+	// Otherwise they are skipped and their values keep referencing the
+	// original registries
+	RelocateDisabled bool
+}
+
+// imageHintsFiles returns all the image hints files of the source
+func (src *Source) imageHintsFiles() []string {
+	files := []string{}
+	if src.ImageHintsFile != "" {
+		files = append(files, src.ImageHintsFile)
+	}
+	return append(files, src.ImageHintsFiles...)
 }
 
 // Target of the chart move
@@ -130,12 +210,17 @@ type Target struct {
 	Chart          ChartSpec
 	Rules          RewriteRules
 	ContainersAuth *ContainersAuth
+	// Dependencies, if set, keeps the chart dependencies instead of stripping them
+	Dependencies *RelocatedDependencies
 }
 
 // ChartMoveRequest defines a chart move
 type ChartMoveRequest struct {
 	Source Source
 	Target Target
+	// Targets, if set, relocate the chart to each of them instead of Target,
+	// via NewMultiTargetMover
+	Targets []*Target
 }
 
 // ChartMover represents a Helm Chart moving relocation. It's initialization must be done view NewChartMover
@@ -146,10 +231,24 @@ type ChartMover struct {
 	sourceContainerRegistry   internal.ContainerRegistryInterface
 	targetContainerRegistry   internal.ContainerRegistryInterface
 	targetIntermediateTarPath string
-	chart                     *chart.Chart
-	logger                    Logger
-	retries                   uint
-	intermediateBundle        *intermediateBundle
+	targetOCIChart            string
+	targetOCIChartBase        string
+	targetContainersAuth      *ContainersAuth
+	targetRepositoryDir       *RepositoryDir
+	targetChartMuseum         *ChartMuseum
+	targetKustomizeDir        string
+	targetValuesFile          string
+	// image hints left out of the relocation, as their components are disabled
+	skippedImages []*skippedImage
+	// relocateDisabled relocates the images of disabled components instead
+	relocateDisabled bool
+	// repository the relocated dependencies point to, they are stripped if empty
+	targetDependencyRepository string
+	publishSubcharts           bool
+	chart                      *chart.Chart
+	logger                     Logger
+	retries                    uint
+	intermediateBundle         *intermediateBundle
 	// raw contents of the hints file. Sample:
 	// test/fixtures/testchart.images.yaml
 	rawHints []byte
@@ -163,6 +262,16 @@ type ChartChanges struct {
 // NewChartMover creates a ChartMover to relocate a chart following the given
 // imagePatters and rules.
 func NewChartMover(req *ChartMoveRequest, opts ...Option) (*ChartMover, error) {
+	if len(req.Targets) > 0 {
+		return nil, errors.New("moving a chart to several targets requires a MultiTargetMover")
+	}
+	return newChartMover(req, nil, opts...)
+}
+
+// newChartMover creates the ChartMover of the request. If given the source
+// already loaded, the mover rewrites its own copy of the chart instead of
+// loading it again
+func newChartMover(req *ChartMoveRequest, source *ChartMover, opts ...Option) (*ChartMover, error) {
 	cm := &ChartMover{
 		logger:  defaultLogger{},
 		retries: DefaultRetries,
@@ -176,7 +285,15 @@ func NewChartMover(req *ChartMoveRequest, opts ...Option) (*ChartMover, error) {
 		return nil, err
 	}
 
-	if err := cm.loadChart(&req.Source); err != nil {
+	if source != nil {
+		chart, err := copyChart(source.chart)
+		if err != nil {
+			return nil, err
+		}
+		cm.chart = chart
+		cm.intermediateBundle = source.intermediateBundle
+		cm.rawHints = source.rawHints
+	} else if err := cm.loadChart(&req.Source); err != nil {
 		return nil, err
 	}
 
@@ -187,6 +304,33 @@ func NewChartMover(req *ChartMoveRequest, opts ...Option) (*ChartMover, error) {
 			targetOutput(req.Target.Chart.Local.Path, cm.chart.Name(), cm.chart.Metadata.Version)
 	}
 
+	if req.Target.Chart.OCI != nil {
+		base, err := targetOCIChartBase(req.Target.Chart.OCI, &req.Target.Rules)
+		if err != nil {
+			return nil, err
+		}
+		cm.targetOCIChartBase = base
+		cm.targetOCIChart = ociChartRef(base, cm.chart.Name(), cm.chart.Metadata.Version)
+		cm.targetContainersAuth = req.Target.ContainersAuth
+	}
+	cm.targetRepositoryDir = req.Target.Chart.RepositoryDir
+	cm.targetChartMuseum = req.Target.Chart.ChartMuseum
+	if req.Target.Chart.KustomizeOverlay != nil {
+		cm.targetKustomizeDir = req.Target.Chart.KustomizeOverlay.Path
+	}
+	if req.Target.Chart.ValuesOverride != nil {
+		cm.targetValuesFile = valuesOverrideFilename(req.Target.Chart.ValuesOverride.Path)
+	}
+
+	if req.Target.Dependencies != nil && req.Target.Chart.IntermediateBundle == nil {
+		repository, publish, err := dependencyRepository(req.Target.Dependencies, &req.Target.Chart, cm.targetOCIChartBase)
+		if err != nil {
+			return nil, err
+		}
+		cm.targetDependencyRepository = repository
+		cm.publishSubcharts = publish
+	}
+
 	// Option overrides
 	for _, opt := range opts {
 		if opt != nil {
@@ -194,8 +338,13 @@ func NewChartMover(req *ChartMoveRequest, opts ...Option) (*ChartMover, error) {
 		}
 	}
 
-	if err := cm.loadImageHints(&req.Source); err != nil {
-		return nil, fmt.Errorf("failed to load hints file: %w", err)
+	if source == nil {
+		if err := cm.vendorDependencies(&req.Source); err != nil {
+			return nil, err
+		}
+		if err := cm.loadImageHints(&req.Source); err != nil {
+			return nil, fmt.Errorf("failed to load hints file: %w", err)
+		}
 	}
 
 	imagePatterns, err := internal.ParseImagePatterns(cm.rawHints)
@@ -203,7 +352,14 @@ func NewChartMover(req *ChartMoveRequest, opts ...Option) (*ChartMover, error) {
 		return nil, fmt.Errorf("failed to parse image patterns: %w", err)
 	}
 
+	if req.Source.VerifyCoverage {
+		if err := cm.verifyCoverage(imagePatterns); err != nil {
+			return nil, err
+		}
+	}
+
 	cm.logger.Println("Computing relocation...\n")
+	cm.relocateDisabled = req.Source.RelocateDisabled
 	imageChanges, err := cm.loadOriginalImages(imagePatterns)
 	if err != nil {
 		return nil, err
@@ -214,6 +370,12 @@ func NewChartMover(req *ChartMoveRequest, opts ...Option) (*ChartMover, error) {
 		return nil, fmt.Errorf("failed to compute chart rewrites: %w", err)
 	}
 
+	if cm.targetValuesFile != "" {
+		if rewrites := templateRewrites(imageChanges); len(rewrites) > 0 {
+			return nil, fmt.Errorf("image %s is hardcoded in template %s, a values override can't relocate it", rewrites[0].Original, rewrites[0].File)
+		}
+	}
+
 	cm.imageChanges = imageChanges
 	cm.chartChanges = chartChanges
 
@@ -232,19 +394,35 @@ func (cm *ChartMover) WithRetries(retries uint) *ChartMover {
 func (cm *ChartMover) Print() {
 	if cm.targetIntermediateTarPath != "" {
 		cm.printSaveIntermediateBundle()
-		return
+	} else {
+		cm.printMove()
 	}
-	cm.printMove()
+	cm.printSkippedImages()
 }
 
-// loadChart loads the chart in memory from the intermediate bundle or a given path
+// loadChart loads the chart in memory from the intermediate bundle, an OCI
+// registry, a Helm repository or a given path
 func (cm *ChartMover) loadChart(src *Source) error {
 	if src.Chart.Local != nil {
 		return cm.loadChartFromPath(src.Chart.Local.Path)
 	} else if src.Chart.IntermediateBundle != nil {
 		return cm.loadChartFromIntermediateBundle(src.Chart.IntermediateBundle.Path)
+	} else if src.Chart.OCI != nil {
+		return cm.loadChartFromOCI(src.Chart.OCI.Reference, src.ContainersAuth)
+	} else if src.Chart.Repository != nil {
+		return cm.loadChartFromRepository(src.Chart.Repository)
+	}
+	return fmt.Errorf("must provide either a local chart, an OCI chart, a repository chart or an intermediate bundle as input")
+}
+
+// vendorDependencies fetches the missing dependencies of the loaded chart.
+// Intermediate bundles are self contained, missing dependencies are not
+// fetched from them as they are meant to be used offline
+func (cm *ChartMover) vendorDependencies(src *Source) error {
+	if src.Chart.IntermediateBundle != nil {
+		return nil
 	}
-	return fmt.Errorf("must provide either a local chart or an intermediate bundle as input")
+	return vendorDependencies(cm.chart, src.ContainersAuth, cm.logger)
 }
 
 // loadChartFromIntermediateBundle loads the chart in memory after extracting
@@ -335,13 +513,13 @@ func detectChartName(chartdir string) (string, error) {
 // Uses loadImageHintsFromBundle or loadImageHintsFromFileOrChart.
 func (cm *ChartMover) loadImageHints(src *Source) error {
 	if src.Chart.IntermediateBundle != nil {
-		if src.ImageHintsFile != "" {
+		if len(src.imageHintsFiles()) > 0 {
 			return fmt.Errorf("do not set a hints filename, the bundle already provides it")
 		}
 		if err := cm.loadImageHintsFromBundle(); err != nil {
 			return err
 		}
-	} else if err := cm.loadImageHintsFromFileOrChart(src.ImageHintsFile); err != nil {
+	} else if err := cm.loadImageHintsFromFileOrChart(src.imageHintsFiles(), src.MergeHints); err != nil {
 		return err
 	}
 	if cm.rawHints == nil {
@@ -360,10 +538,10 @@ func (cm *ChartMover) loadImageHintsFromBundle() error {
 	return nil
 }
 
-// loadImageHintsFromFileOrChart loads the image hints from a given file or the
-// chart, if the hints file is present inside.
-func (cm *ChartMover) loadImageHintsFromFileOrChart(imageHintsFile string) error {
-	rawHints, err := loadImageHints(imageHintsFile, cm.chart, cm.logger)
+// loadImageHintsFromFileOrChart loads the image hints from the given files or
+// the chart, merging both if requested.
+func (cm *ChartMover) loadImageHintsFromFileOrChart(imageHintsFiles []string, mergeHints bool) error {
+	rawHints, err := loadImageHints(imageHintsFiles, cm.chart, mergeHints, cm.logger)
 	if err != nil {
 		return err
 	}
@@ -390,10 +568,61 @@ func (cm *ChartMover) printSaveIntermediateBundle() {
 }
 
 func (cm *ChartMover) printMove() {
+	cm.printImageCopies(cm.imageChanges)
+	if cm.targetKustomizeDir != "" {
+		cm.printKustomizeOverlay()
+		return
+	}
+	if cm.targetValuesFile != "" {
+		cm.printValuesOverride()
+		return
+	}
+	cm.printChartMove()
+}
+
+// printKustomizeOverlay shows the images of the Kustomize overlay
+func (cm *ChartMover) printKustomizeOverlay() {
+	log := cm.logger
+	log.Printf("\nImages to be set in %s:\n", filepath.Join(cm.targetKustomizeDir, KustomizationFilename))
+	for _, image := range kustomizeImages(cm.imageChanges) {
+		ref := image.NewName
+		if image.Digest != "" {
+			ref += "@" + image.Digest
+		} else if image.NewTag != "" {
+			ref += ":" + image.NewTag
+		}
+		log.Printf("  %s: %s\n", image.Name, ref)
+	}
+	log.Println()
+}
+
+func (cm *ChartMover) printValuesOverride() {
+	log := cm.logger
+	log.Printf("\nValues to be set in %s:\n", cm.targetValuesFile)
+	for _, change := range cm.chartChanges {
+		log.Printf("  %s: %s\n", change.Path, change.Value)
+	}
+	log.Println()
+}
+
+func (cm *ChartMover) printSkippedImages() {
+	if len(cm.skippedImages) == 0 {
+		return
+	}
+	log := cm.logger
+	log.Println("Images skipped:")
+	for _, skipped := range cm.skippedImages {
+		log.Printf(" %s (%s)\n", skipped.hint, skipped.reason)
+	}
+	log.Println("Their values still reference the original registries, enabling them at install time pulls from there")
+	log.Println()
+}
+
+func (cm *ChartMover) printImageCopies(imageChanges []*internal.ImageChange) {
 	log := cm.logger
 	log.Println("Image copies:")
 
-	for _, change := range cm.imageChanges {
+	for _, change := range imageChanges {
 		pushRequiredTxt := "already exists"
 		if change.ShouldPush() {
 			pushRequiredTxt = "push required"
@@ -402,10 +631,32 @@ func (cm *ChartMover) printMove() {
 		if cm.intermediateBundle != nil {
 			src = fmt.Sprintf("(bundle %s:%s)", cm.intermediateBundle.bundlePath, src)
 		}
-		log.Printf(" %s => %s (%s) (%s)\n",
-			src, change.RewrittenReference.Name(), change.Digest, pushRequiredTxt)
+		rule := ""
+		if change.Rule != "" {
+			rule = fmt.Sprintf(" (%s)", change.Rule)
+		}
+		log.Printf(" %s => %s (%s) (%s)%s\n",
+			src, referenceName(change.RewrittenReference), change.Digest, pushRequiredTxt, rule)
+		if singlePlatformUnderOriginalTag(change) {
+			log.Printf("   Warning: only the %s platform is pushed under the original tag %s, replacing any multi-platform image there. Use a --tag-strategy to push it under its own tag\n",
+				change.Pattern.Platforms[0], change.Tag)
+		}
 	}
+}
+
+// singlePlatformUnderOriginalTag tells if a single platform of the image is
+// pushed under the tag of the original, usually multi-platform, image
+func singlePlatformUnderOriginalTag(change *internal.ImageChange) bool {
+	if change.Pattern == nil || len(change.Pattern.Platforms) == 0 || change.Tag == "" {
+		return false
+	}
+	original, isTag := change.ImageReference.(name.Tag)
+	return isTag && original.TagStr() == change.Tag
+}
 
+// printChartMove shows the rewrites and targets of the chart
+func (cm *ChartMover) printChartMove() {
+	log := cm.logger
 	for _, chartChanges := range orderedChangesByChart(cm.chartChanges, cm.chart) {
 		log.Printf("\nChanges to be applied to %s/values.yaml:\n", chartChanges.chart.ChartFullPath())
 		for _, change := range chartChanges.changes {
@@ -415,6 +666,25 @@ func (cm *ChartMover) printMove() {
 
 		log.Println()
 	}
+	cm.printTemplateRewrites()
+
+	if cm.targetDependencyRepository != "" {
+		log.Printf("Chart dependencies will point to %s\n", cm.targetDependencyRepository)
+		if cm.publishSubcharts {
+			for _, sub := range relocatedSubcharts(cm.chart) {
+				log.Printf("Relocated subchart %s-%s will be published along with the chart\n", sub.Name(), sub.Metadata.Version)
+			}
+		}
+	}
+	if cm.targetOCIChart != "" {
+		log.Printf("Relocated chart will be pushed to %s\n", cm.targetOCIChart)
+	}
+	if cm.targetRepositoryDir != nil {
+		log.Printf("Relocated chart will be added to the repository at %s\n", cm.targetRepositoryDir.Path)
+	}
+	if cm.targetChartMuseum != nil {
+		log.Printf("Relocated chart will be uploaded to %s\n", cm.targetChartMuseum.URL)
+	}
 }
 
 // Return the ordered set of changes grouped by Helm Chart.
@@ -423,7 +693,11 @@ func orderedChangesByChart(changes []*internal.RewriteAction, rootChart *chart.C
 	groupedChanges := make(map[*chart.Chart][]*internal.RewriteAction)
 
 	for _, change := range changes {
-		destination, _ := change.FindChartDestination(rootChart)
+		destination, _, err := change.FindChartDestination(rootChart)
+		if err != nil {
+			// Invalid paths are shown under the root chart, applying them fails
+			destination = rootChart
+		}
 		if changesForChart, ok := groupedChanges[destination]; ok {
 			groupedChanges[destination] = append(changesForChart, change)
 		} else {
@@ -465,6 +739,12 @@ A regular move executes the Chart relocation which includes
 - Push all the images to their new locations
 - Rewrite the Helm Chart and its subcharts
 - Repackage the Helm chart as toChartFilename
+- Push the repackaged Helm chart to an OCI registry, if requested
+- Publish the repackaged Helm chart to Helm HTTP repositories, if requested
+
+A move to a Kustomize overlay or a values override file pushes the images the
+same way but, instead of rewriting the Helm Chart, sets them in the overlay
+kustomization.yaml or the values file to be passed to helm install -f
 
 A save to an offline tarball bundle will:
 - Drop all images to disk, with the original chart (unpacked) and hints file
@@ -490,63 +770,252 @@ func (cm *ChartMover) moveChart() error {
 	if err != nil {
 		return err
 	}
-	err = modifyChart(cm.chart, cm.chartChanges, cm.chartDestination)
+
+	return cm.relocateChart()
+}
+
+// relocateChart rewrites the chart, once its images have been pushed, and
+// saves, pushes or publishes it to the requested targets. For Kustomize
+// overlays and values override files, those are written instead
+func (cm *ChartMover) relocateChart() error {
+	log := cm.logger
+	if cm.targetKustomizeDir != "" {
+		// The chart is left untouched, the overlay relocates its images instead
+		filename, err := writeKustomizeOverlay(cm.targetKustomizeDir, kustomizeImages(cm.imageChanges))
+		if err != nil {
+			return err
+		}
+		log.Println("Done moving", filename)
+		return nil
+	}
+	if cm.targetValuesFile != "" {
+		// The chart is left untouched, the values file relocates its images instead
+		if err := writeValuesOverride(cm.targetValuesFile, cm.chart, cm.chartChanges); err != nil {
+			return err
+		}
+		log.Println("Done moving", cm.targetValuesFile)
+		return nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "relocated-chart-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory for the relocated chart: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	chartFilename := cm.chartDestination
+	if chartFilename == "" {
+		// The chart is only pushed, so it is written to a temporary location
+		chartFilename = filepath.Join(tmpDir, fmt.Sprintf("%s-%s.tgz", cm.chart.Name(), cm.chart.Metadata.Version))
+	}
+
+	err = modifyChart(cm.chart, cm.chartChanges, templateRewrites(cm.imageChanges), chartFilename, cm.targetDependencyRepository)
 	if err != nil {
 		return err
 	}
 
-	log.Println("Done moving", cm.chartDestination)
+	// Subcharts go first so that the chart dependencies can be resolved as soon as it is published
+	if cm.publishSubcharts {
+		if err := cm.publishDependencies(tmpDir); err != nil {
+			return err
+		}
+	}
+
+	if cm.targetOCIChart != "" {
+		if err := cm.pushChart(chartFilename, cm.targetOCIChart); err != nil {
+			return err
+		}
+	}
+
+	if err := cm.publishChart(chartFilename, cm.chart.Metadata); err != nil {
+		return err
+	}
+
+	if cm.chartDestination != "" {
+		log.Println("Done moving", cm.chartDestination)
+	}
 	return nil
 }
 
+// publishChart adds the relocated chart tarball to the target Helm HTTP repositories
+func (cm *ChartMover) publishChart(chartFilename string, md *chart.Metadata) error {
+	if cm.targetRepositoryDir != nil {
+		cm.logger.Printf("Adding chart to the repository at %s...\n", cm.targetRepositoryDir.Path)
+		digest, err := publishToRepositoryDir(chartFilename, md, cm.targetRepositoryDir)
+		if err != nil {
+			return err
+		}
+		cm.logger.Printf("Done moving %s (sha256:%s)\n", cm.targetRepositoryDir.Path, digest)
+	}
+
+	if cm.targetChartMuseum != nil {
+		err := retry.Do(
+			func() error {
+				cm.logger.Printf("Uploading chart to %s...\n", cm.targetChartMuseum.URL)
+				if err := uploadToChartMuseum(chartFilename, cm.targetChartMuseum); err != nil {
+					return err
+				}
+				cm.logger.Println("Done moving", cm.targetChartMuseum.URL)
+				return nil
+			},
+			retry.Attempts(cm.retries),
+			retry.OnRetry(func(n uint, err error) {
+				cm.logger.Printf("Attempt #%d failed: %s\n", n+1, err.Error())
+			}),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushChart pushes the relocated chart tarball to the target OCI reference
+func (cm *ChartMover) pushChart(chartFilename, ref string) error {
+	data, err := os.ReadFile(chartFilename)
+	if err != nil {
+		return fmt.Errorf("failed to read relocated chart %s: %w", chartFilename, err)
+	}
+
+	err = retry.Do(
+		func() error {
+			cm.logger.Printf("Pushing chart %s...\n", ref)
+			digest, err := pushOCIChart(data, ref, cm.targetContainersAuth)
+			if err != nil {
+				return err
+			}
+			cm.logger.Printf("Done moving %s (%s)\n", ref, digest)
+			return nil
+		},
+		retry.Attempts(cm.retries),
+		retry.OnRetry(func(n uint, err error) {
+			cm.logger.Printf("Attempt #%d failed: %s\n", n+1, err.Error())
+		}),
+	)
+	return err
+}
+
 // validateTarget ensures the requested Target has expected inputs.
 // If the archival target is not set, at least one transformation rule must be set
+// Pushing or publishing the chart requires a place to push it to
 func validateTarget(target *Target) error {
 	if target.Chart.IntermediateBundle != nil {
 		return nil
 	}
 	rules := target.Rules
-	if rules.Registry == "" && rules.RepositoryPrefix == "" {
+	if rules.empty() {
 		return ErrOCIRewritesMissing
 	}
+	if target.Chart.OCI != nil && target.Chart.OCI.Reference == "" && rules.Registry == "" {
+		return ErrOCIChartTargetMissing
+	}
+	if err := validateUntouchedChartTarget(target); err != nil {
+		return err
+	}
+	if target.Chart.RepositoryDir != nil && target.Chart.RepositoryDir.Path == "" {
+		return errors.New("the target repository directory path is required")
+	}
+	if target.Chart.ChartMuseum != nil {
+		if u, err := url.Parse(target.Chart.ChartMuseum.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid ChartMuseum URL %q, expected an http(s) URL", target.Chart.ChartMuseum.URL)
+		}
+	}
+	return nil
+}
+
+// validateUntouchedChartTarget ensures that targets relocating the images
+// without modifying the chart, Kustomize overlays and values override files,
+// are not combined with any other chart target
+func validateUntouchedChartTarget(target *Target) error {
+	spec := target.Chart
+	if spec.KustomizeOverlay == nil && spec.ValuesOverride == nil {
+		return nil
+	}
+	if spec.KustomizeOverlay != nil && spec.KustomizeOverlay.Path == "" {
+		return errors.New("the target Kustomize overlay directory is required")
+	}
+	if spec.ValuesOverride != nil && spec.ValuesOverride.Path == "" {
+		return errors.New("the target values override file path is required")
+	}
+	if (spec.KustomizeOverlay != nil && spec.ValuesOverride != nil) || spec.Local != nil || spec.OCI != nil ||
+		spec.RepositoryDir != nil || spec.ChartMuseum != nil || target.Dependencies != nil {
+		return errors.New("kustomize overlays and values override files leave the chart untouched, they cannot be combined with other chart targets")
+	}
 	return nil
 }
 
-// imageLoadFn defines how an image is loaded
-type imageLoadFn func(name.Reference) (v1.Image, string, error)
+// imageLoadFn defines how an image is loaded, for the given platform if set
+type imageLoadFn func(name.Reference, *v1.Platform) (v1.Image, string, error)
 
 // loadOriginalImages will load container images from a remote registry or a local intermediate bundle.
 // The heavy lifting is done by loadImageChanges, but here the actual image load
 // function is selected.
 func (cm *ChartMover) loadOriginalImages(imagePatterns []*internal.ImageTemplate) ([]*internal.ImageChange, error) {
-	loadFn := func(originalImage name.Reference) (v1.Image, string, error) {
+	loadFn := func(originalImage name.Reference, platform *v1.Platform) (v1.Image, string, error) {
+		if platform != nil {
+			return cm.sourceContainerRegistry.PullPlatform(originalImage, platform)
+		}
 		return cm.sourceContainerRegistry.Pull(originalImage)
 	}
 	action := "pull"
 	if cm.intermediateBundle != nil {
-		loadFn = func(originalImage name.Reference) (v1.Image, string, error) {
+		// Bundles hold the images already pulled for their platform
+		loadFn = func(originalImage name.Reference, _ *v1.Platform) (v1.Image, string, error) {
 			return cm.intermediateBundle.loadImage(originalImage)
 		}
 		action = "load"
 	}
-	imageChanges, err := loadImageChanges(cm.chart, imagePatterns, loadFn)
+	imageChanges, skipped, err := loadImageChanges(cm.chart, imagePatterns, cm.relocateDisabled, loadFn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to %s original images: %w", action, err)
 	}
+	cm.skippedImages = skipped
 	return imageChanges, nil
 }
 
 // loadImageChanges loads images from a loader function load and wraps them as
 // ImageChange appropriately. As the load function is abstracted away this
-// can be loading remote or local images the same way.
-func loadImageChanges(chart *chart.Chart, patterns []*internal.ImageTemplate, load imageLoadFn) ([]*internal.ImageChange, error) {
+// can be loading remote or local images the same way. Wildcard patterns load
+// an image per list item. Images of disabled components, unless
+// relocateDisabled is set, and unset optional images are returned as skipped
+// instead.
+func loadImageChanges(chart *chart.Chart, patterns []*internal.ImageTemplate, relocateDisabled bool, load imageLoadFn) ([]*internal.ImageChange, []*skippedImage, error) {
+	patterns, err := internal.ExpandImagePatterns(chart, patterns)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	var changes []*internal.ImageChange
+	skipped := []*skippedImage{}
 	imageCache := map[string]*internal.ImageChange{}
+	skipper := newImageSkipper(chart)
 
 	for _, pattern := range patterns {
+		disabledReason := skipper.skipReason(pattern)
+		if disabledReason != "" && !relocateDisabled {
+			skipped = append(skipped, &skippedImage{hint: pattern.Raw, reason: disabledReason})
+			continue
+		}
 		originalImage, err := pattern.Render(chart)
 		if err != nil {
-			return nil, err
+			if disabledReason != "" {
+				// Disabled components often leave their images unset
+				skipped = append(skipped, &skippedImage{hint: pattern.Raw, reason: fmt.Sprintf("%s and its image is not set: %v", disabledReason, err)})
+				continue
+			}
+			if pattern.Optional {
+				skipped = append(skipped, &skippedImage{hint: pattern.Raw, reason: fmt.Sprintf("optional image is not set: %v", err)})
+				continue
+			}
+			return nil, nil, err
+		}
+		platform, err := imagePlatform(pattern)
+		if err != nil {
+			return nil, nil, err
+		}
+		cacheKey := originalImage.Name()
+		if platform != nil {
+			cacheKey += " " + platform.String()
 		}
 
 		change := &internal.ImageChange{
@@ -554,17 +1023,17 @@ func loadImageChanges(chart *chart.Chart, patterns []*internal.ImageTemplate, lo
 			ImageReference: originalImage,
 		}
 
-		if imageCache[originalImage.Name()] == nil {
-			image, digest, err := load(originalImage)
+		if imageCache[cacheKey] == nil {
+			image, digest, err := load(originalImage, platform)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			change.Image = image
 			change.Digest = digest
-			imageCache[originalImage.Name()] = change
+			imageCache[cacheKey] = change
 		} else {
-			change.Image = imageCache[originalImage.Name()].Image
-			change.Digest = imageCache[originalImage.Name()].Digest
+			change.Image = imageCache[cacheKey].Image
+			change.Digest = imageCache[cacheKey].Digest
 		}
 
 		// If the identifier is not the digest, then it must be the tag.
@@ -573,49 +1042,100 @@ func loadImageChanges(chart *chart.Chart, patterns []*internal.ImageTemplate, lo
 		}
 		changes = append(changes, change)
 	}
-	return changes, nil
+	return changes, skipped, nil
+}
+
+// imagePlatform returns the platform to relocate the image for, nil for the
+// default platform. Relocating several platforms of an image is not supported
+func imagePlatform(pattern *internal.ImageTemplate) (*v1.Platform, error) {
+	switch len(pattern.Platforms) {
+	case 0:
+		return nil, nil
+	case 1:
+		return v1.ParsePlatform(pattern.Platforms[0])
+	}
+	return nil, fmt.Errorf("image %s: relocating several platforms of an image is not supported", pattern.Raw)
 }
 
 func (cm *ChartMover) computeChanges(imageChanges []*internal.ImageChange, registryRules *RewriteRules) ([]*internal.ImageChange, []*internal.RewriteAction, error) {
 	var chartChanges []*internal.RewriteAction
 	imageCache := map[string]bool{}
-	rewriteRules := &internal.OCIImageLocation{
-		Registry:         registryRules.Registry,
-		RepositoryPrefix: registryRules.RepositoryPrefix,
+
+	locations := make([]*internal.OCIImageLocation, len(imageChanges))
+	for i, change := range imageChanges {
+		location, rule, err := registryRules.location(change.ImageReference, chartVersion(cm.chart))
+		if err != nil {
+			return nil, nil, err
+		}
+		locations[i] = location
+		change.Rule = rule
+		change.Tag = location.Tag
 	}
 
-	for _, change := range imageChanges {
-		newActions, err := change.Pattern.Apply(change.ImageReference.Context(), change.Digest, rewriteRules)
+	globalAction, err := cm.globalRegistryAction(imageChanges, locations, registryRules.GlobalImageRegistry)
+	if err != nil {
+		return nil, nil, err
+	}
+	var globalActions []*internal.RewriteAction
+	if globalAction != nil {
+		globalActions = append(globalActions, globalAction)
+		chartChanges = append(chartChanges, globalAction)
+	}
+
+	for i, change := range imageChanges {
+		newActions, err := change.Pattern.Apply(change.ImageReference.Context(), change.Digest, locations[i])
 		if err != nil {
 			return nil, nil, err
 		}
+		if globalAction != nil && registryRules.GlobalImageRegistry {
+			newActions = withoutRegistryAction(newActions, change.Pattern)
+		}
+		if registryRules.customStrategies() {
+			newActions = changedValueActions(cm.chart, newActions)
+		}
 
 		chartChanges = append(chartChanges, newActions...)
 
-		rewrittenImage, err := change.Pattern.Render(cm.chart, newActions...)
+		var rewrittenImage name.Reference
+		if change.Pattern.TemplateImage != "" {
+			// Images hardcoded in templates are rewritten in their template file
+			rewrittenImage, err = change.Pattern.RelocateTemplateImage(change.ImageReference.Context(), change.Digest, locations[i])
+		} else {
+			rewrittenImage, err = change.Pattern.Render(cm.chart, append(globalActions, newActions...)...)
+		}
 		if err != nil {
 			return nil, nil, err
 		}
 
 		change.RewrittenReference = rewrittenImage
+	}
 
-		if change.ShouldPush() {
-			if imageCache[rewrittenImage.Name()] {
-				// This image has already been checked previously, so just force this one to be skipped
-				change.AlreadyPushed = true
-			} else {
-				// If ForcePush is set we add it to the list of changes to be performed regardless
-				if !registryRules.ForcePush {
-					needToPush, err := cm.targetContainerRegistry.Check(change.Digest, rewrittenImage)
-					if err != nil {
-						return nil, nil, fmt.Errorf("failed check, use forcePush option to override :%w", err)
-					}
-					change.AlreadyPushed = !needToPush
-				}
+	// Distinct images relocated to the same reference would overwrite each
+	// other, so give up before checking or pushing any of them
+	if err := detectCollisions(imageChanges); err != nil {
+		return nil, nil, err
+	}
 
-				imageCache[rewrittenImage.Name()] = true
+	for _, change := range imageChanges {
+		if !change.ShouldPush() {
+			continue
+		}
+		rewrittenImage := change.RewrittenReference
+		if imageCache[rewrittenImage.Name()] {
+			// This image has already been checked previously, so just force this one to be skipped
+			change.AlreadyPushed = true
+			continue
+		}
+		// If ForcePush is set we add it to the list of changes to be performed regardless
+		if !registryRules.ForcePush {
+			needToPush, err := cm.targetContainerRegistry.Check(change.Digest, rewrittenImage)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed check, use forcePush option to override :%w", err)
 			}
+			change.AlreadyPushed = !needToPush
 		}
+
+		imageCache[rewrittenImage.Name()] = true
 	}
 	return imageChanges, chartChanges, nil
 }
@@ -658,18 +1178,32 @@ func (cm *ChartMover) pushRewrittenImages(imageChanges []*internal.ImageChange)
 	return nil
 }
 
-func modifyChart(originalChart *chart.Chart, actions []*internal.RewriteAction, toChartFilename string) error {
+// modifyChart applies the rewrite actions and the template rewrites and saves
+// the chart. Its dependency references are pointed to dependencyRepository or
+// stripped if empty
+func modifyChart(originalChart *chart.Chart, actions []*internal.RewriteAction, rewrites []*internal.TemplateRewrite, toChartFilename, dependencyRepository string) error {
 	modifiedChart := originalChart
 	for _, action := range actions {
 		if err := action.Apply(modifiedChart); err != nil {
 			return err
 		}
 	}
+	for _, rewrite := range rewrites {
+		if err := rewrite.Apply(modifiedChart); err != nil {
+			return err
+		}
+	}
 
-	// Remove dependencies references. The chart will still work because it has the dependencies vendored in charts/
-	// This just prevents users from overriding the relocation overrides applied by this tool
-	if err := stripDependencyRefs(modifiedChart); err != nil {
-		return err
+	if dependencyRepository != "" {
+		if err := relocateDependencyRefs(modifiedChart, dependencyRepository); err != nil {
+			return err
+		}
+	} else {
+		// Remove dependencies references. The chart will still work because it has the dependencies vendored in charts/
+		// This just prevents users from overriding the relocation overrides applied by this tool
+		if err := stripDependencyRefs(modifiedChart); err != nil {
+			return err
+		}
 	}
 
 	return saveChart(modifiedChart, toChartFilename)
@@ -693,6 +1227,54 @@ func stripDependencyRefs(c *chart.Chart) error {
 	return nil
 }
 
+// copyChart returns a deep copy of the chart and its subcharts, to modify it
+// leaving the original untouched. Files data is shared, it is replaced and
+// never modified in place
+func copyChart(c *chart.Chart) (*chart.Chart, error) {
+	copied := *c
+	metadata, err := copystructure.Copy(c.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy chart %s: %w", c.Name(), err)
+	}
+	copied.Metadata, _ = metadata.(*chart.Metadata)
+	lock, err := copystructure.Copy(c.Lock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy chart %s: %w", c.Name(), err)
+	}
+	copied.Lock, _ = lock.(*chart.Lock)
+	values, err := copystructure.Copy(c.Values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy chart %s: %w", c.Name(), err)
+	}
+	copied.Values, _ = values.(map[string]interface{})
+	copied.Raw = copyFiles(c.Raw)
+	copied.Templates = copyFiles(c.Templates)
+	copied.Files = copyFiles(c.Files)
+
+	dependencies := []*chart.Chart{}
+	for _, dependency := range c.Dependencies() {
+		copiedDependency, err := copyChart(dependency)
+		if err != nil {
+			return nil, err
+		}
+		dependencies = append(dependencies, copiedDependency)
+	}
+	copied.SetDependencies(dependencies...)
+	return &copied, nil
+}
+
+func copyFiles(files []*chart.File) []*chart.File {
+	if files == nil {
+		return nil
+	}
+	copied := make([]*chart.File, len(files))
+	for i, file := range files {
+		f := *file
+		copied[i] = &f
+	}
+	return copied
+}
+
 func saveChart(chart *chart.Chart, toChartFilename string) error {
 	cwd, _ := os.Getwd()
 	tempDir, err := os.MkdirTemp(cwd, "relok8s-*")
@@ -713,17 +1295,35 @@ func saveChart(chart *chart.Chart, toChartFilename string) error {
 	return os.Remove(tempDir)
 }
 
-// load hints from either a given hints file or a chart-embedded hints file
-func loadImageHints(imageHintsFile string, chart *chart.Chart, log Logger) ([]byte, error) {
-	if imageHintsFile != "" {
+// loadImageHints merges the hints of the given files, which replace those
+// found in the chart unless mergeHints is set: its embedded hints file, its
+// artifacthub.io/images annotation and the embedded hints files of its
+// subcharts, prefixed with their values key. A single unprefixed source is
+// returned as is
+func loadImageHints(imageHintsFiles []string, chart *chart.Chart, mergeHints bool, log Logger) ([]byte, error) {
+	sources := []*hintsSource{}
+	for _, imageHintsFile := range imageHintsFiles {
 		rawHints, err := notNilData(loadImageHintsFromFile(imageHintsFile))
 		if err != nil {
 			return nil, err
 		}
-		return rawHints, nil
+		sources = append(sources, &hintsSource{data: rawHints})
+	}
+	if chart != nil && (len(sources) == 0 || mergeHints) {
+		chartSources, err := chartHintsSources(chart, chart, "", "", log)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, chartSources...)
+	}
+
+	switch {
+	case len(sources) == 0:
+		return nil, nil
+	case len(sources) == 1 && sources[0].prefix == "":
+		return sources[0].data, nil
 	}
-	// If the hints file is not provided, try to find the hints inside the Chart
-	return loadImageHintsFromChart(chart, log)
+	return mergeHintsSources(sources)
 }
 
 func loadImageHintsFromChart(chart *chart.Chart, log Logger) ([]byte, error) {
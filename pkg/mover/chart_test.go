@@ -300,6 +300,196 @@ var _ = Describe("Pull & Push Images", func() {
 				})
 			})
 		})
+
+		Context("two different images relocated to the same reference", func() {
+			It("reports the collision before checking any image", func() {
+				changes := []*internal.ImageChange{
+					{
+						Pattern:        newPattern("{{.observability.image.registry}}/{{.observability.image.repository}}:{{.observability.image.tag}}"),
+						ImageReference: name.MustParseReference("index.docker.io/bitnami/wavefront:5.6.7"),
+						Image:          makeImage("sha256:1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"),
+						Digest:         "sha256:1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+					},
+					{
+						Pattern:        newPattern("{{.observabilitytoo.image.registry}}/{{.observabilitytoo.image.repository}}:{{.observabilitytoo.image.tag}}"),
+						ImageReference: name.MustParseReference("quay.io/wavefront/wavefront:5.6.7"),
+						Image:          makeImage("sha256:2bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"),
+						Digest:         "sha256:2bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+					},
+				}
+				rules := &RewriteRules{
+					Registry:         "harbor-repo.vmware.com",
+					RepositoryPrefix: "pwall",
+				}
+
+				cm := testChartMover(fakeRegistry, printer)
+				_, _, err := cm.computeChanges(changes, rules)
+				Expect(errors.Is(err, ErrTargetCollision)).To(BeTrue())
+				Expect(err.Error()).To(Equal(ErrTargetCollision.Error() + ":" +
+					"\n  harbor-repo.vmware.com/pwall/wavefront:5.6.7 <=" +
+					"\n    index.docker.io/bitnami/wavefront:5.6.7 (sha256:1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa)" +
+					"\n    quay.io/wavefront/wavefront:5.6.7 (sha256:2bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb)"))
+				Expect(fakeRegistry.CheckCallCount()).To(BeZero())
+
+				By("keeping the images apart with the full repository path", func() {
+					rules.PathStrategy = PathStrategyFull
+					_, _, err := cm.computeChanges(changes, rules)
+					Expect(err).ToNot(HaveOccurred())
+				})
+			})
+		})
+
+		Context("the chart has a global image registry", func() {
+			var cm *ChartMover
+			changes := func() []*internal.ImageChange {
+				return []*internal.ImageChange{
+					{
+						Pattern:        newPattern("{{.image.registry}}/{{.image.repository}}:{{.image.tag}}"),
+						ImageReference: name.MustParseReference("index.docker.io/bitnami/wordpress:6.0.0"),
+						Image:          makeImage("sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"),
+						Digest:         "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+					},
+					{
+						Pattern:        newPattern("{{.mariadb.image.registry}}/{{.mariadb.image.repository}}:{{.mariadb.image.tag}}"),
+						ImageReference: name.MustParseReference("index.docker.io/bitnami/mariadb:10.6.8"),
+						Image:          makeImage("sha256:1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"),
+						Digest:         "sha256:1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+					},
+				}
+			}
+			globalsChart := func(globalRegistry string) *chart.Chart {
+				return test.MakeChart(&test.ChartSeed{
+					Values: map[string]interface{}{
+						"global": map[string]interface{}{"imageRegistry": globalRegistry},
+						"image":  map[string]interface{}{"registry": "docker.io", "repository": "bitnami/wordpress", "tag": "6.0.0"},
+					},
+					Dependencies: []*test.ChartSeed{{
+						Name: "mariadb",
+						Values: map[string]interface{}{
+							"image": map[string]interface{}{"registry": "docker.io", "repository": "bitnami/mariadb", "tag": "10.6.8"},
+						},
+					}},
+				})
+			}
+
+			BeforeEach(func() {
+				fakeRegistry.CheckReturns(true, nil)
+				cm = testChartMover(fakeRegistry, printer)
+			})
+
+			It("rewrites the global registry along with the image ones when it is set", func() {
+				cm.chart = globalsChart("docker.io")
+				newChanges, actions, err := cm.computeChanges(changes(), &RewriteRules{Registry: "harbor-repo.vmware.com"})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(actions).To(Equal([]*internal.RewriteAction{
+					{Path: ".global.imageRegistry", Value: "harbor-repo.vmware.com"},
+					{Path: ".image.registry", Value: "harbor-repo.vmware.com"},
+					{Path: ".mariadb.image.registry", Value: "harbor-repo.vmware.com"},
+				}))
+				Expect(newChanges[0].RewrittenReference.Name()).To(Equal("harbor-repo.vmware.com/bitnami/wordpress:6.0.0"))
+				Expect(newChanges[1].RewrittenReference.Name()).To(Equal("harbor-repo.vmware.com/bitnami/mariadb:10.6.8"))
+			})
+
+			It("relocates the images of subcharts ignoring the global registry", func() {
+				cm.chart = globalsChart("docker.io")
+				imageChanges := append(changes(), &internal.ImageChange{
+					// The exporter templates build the image from its own values only
+					Pattern:        newPattern("{{.exporter.image.registry}}/{{.exporter.image.repository}}:{{.exporter.image.tag}}"),
+					ImageReference: name.MustParseReference("quay.io/prometheus/mysqld-exporter:0.14.0"),
+					Image:          makeImage("sha256:2bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"),
+					Digest:         "sha256:2bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+				})
+				cm.chart.AddDependency(test.MakeChart(&test.ChartSeed{Values: map[string]interface{}{
+					"image": map[string]interface{}{"registry": "quay.io", "repository": "prometheus/mysqld-exporter", "tag": "0.14.0"},
+				}}))
+				cm.chart.Dependencies()[1].Metadata = &chart.Metadata{Name: "exporter"}
+
+				_, actions, err := cm.computeChanges(imageChanges, &RewriteRules{Registry: "harbor-repo.vmware.com"})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(actions).To(ContainElement(&internal.RewriteAction{Path: ".exporter.image.registry", Value: "harbor-repo.vmware.com"}))
+
+				By("dropping the image registries only when asked to rewrite the global one", func() {
+					_, actions, err := cm.computeChanges(imageChanges, &RewriteRules{Registry: "harbor-repo.vmware.com", GlobalImageRegistry: true})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(actions).To(Equal([]*internal.RewriteAction{
+						{Path: ".global.imageRegistry", Value: "harbor-repo.vmware.com"},
+					}))
+				})
+			})
+
+			It("rewrites the image registries when the global registry is empty", func() {
+				cm.chart = globalsChart("")
+				_, actions, err := cm.computeChanges(changes(), &RewriteRules{Registry: "harbor-repo.vmware.com"})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(actions).To(Equal([]*internal.RewriteAction{
+					{Path: ".image.registry", Value: "harbor-repo.vmware.com"},
+					{Path: ".mariadb.image.registry", Value: "harbor-repo.vmware.com"},
+				}))
+			})
+
+			It("rewrites the empty global registry when asked to", func() {
+				cm.chart = globalsChart("")
+				newChanges, actions, err := cm.computeChanges(changes(), &RewriteRules{Registry: "harbor-repo.vmware.com", RepositoryPrefix: "pwall", GlobalImageRegistry: true})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(actions).To(Equal([]*internal.RewriteAction{
+					{Path: ".global.imageRegistry", Value: "harbor-repo.vmware.com"},
+					{Path: ".image.repository", Value: "pwall/wordpress"},
+					{Path: ".mariadb.image.repository", Value: "pwall/mariadb"},
+				}))
+				Expect(newChanges[1].RewrittenReference.Name()).To(Equal("harbor-repo.vmware.com/pwall/mariadb:10.6.8"))
+			})
+
+			It("fails to rewrite a global registry the chart does not have", func() {
+				cm.chart = test.MakeChart(&test.ChartSeed{
+					Values: map[string]interface{}{
+						"image": map[string]interface{}{"registry": "docker.io", "repository": "bitnami/wordpress", "tag": "6.0.0"},
+					},
+				})
+				_, _, err := cm.computeChanges(changes()[:1], &RewriteRules{Registry: "harbor-repo.vmware.com", GlobalImageRegistry: true})
+				Expect(err).To(MatchError(ContainSubstring("the chart has no .global.imageRegistry value")))
+			})
+
+			It("fails to rewrite the global registry when the images move to several registries", func() {
+				cm.chart = globalsChart("")
+				imageChanges := changes()
+				imageChanges[1].ImageReference = name.MustParseReference("quay.io/bitnami/mariadb:10.6.8")
+				_, _, err := cm.computeChanges(imageChanges, &RewriteRules{RepositoryPrefix: "pwall", GlobalImageRegistry: true})
+				Expect(err).To(MatchError(ContainSubstring("the images move to several registries: index.docker.io, quay.io")))
+			})
+		})
+	})
+
+	Describe("template images", func() {
+		It("relocates the images hardcoded in templates with template rewrites", func() {
+			template, err := internal.NewFromTemplateImage("templates/tests/test.yaml", "busybox:1.36")
+			Expect(err).ToNot(HaveOccurred())
+			changes := []*internal.ImageChange{
+				{
+					Pattern:        template,
+					ImageReference: name.MustParseReference("busybox:1.36"),
+					Image:          makeImage("sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"),
+					Digest:         "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+				},
+				{
+					Pattern:        template,
+					ImageReference: name.MustParseReference("busybox:1.36"),
+					Image:          makeImage("sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"),
+					Digest:         "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+				},
+			}
+			fakeRegistry.CheckReturns(true, nil)
+
+			cm := testChartMover(fakeRegistry, printer)
+			newChanges, actions, err := cm.computeChanges(changes, &RewriteRules{Registry: "harbor-repo.vmware.com", RepositoryPrefix: "pwall"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actions).To(BeEmpty())
+			Expect(newChanges[0].RewrittenReference.Name()).To(Equal("harbor-repo.vmware.com/pwall/busybox:1.36"))
+			Expect(newChanges[1].AlreadyPushed).To(BeTrue())
+
+			Expect(templateRewrites(newChanges)).To(Equal([]*internal.TemplateRewrite{
+				{File: "templates/tests/test.yaml", Original: "busybox:1.36", Value: "harbor-repo.vmware.com/pwall/busybox:1.36"},
+			}))
+		})
 	})
 
 	Describe("pullOriginalImages", func() {
@@ -613,9 +803,12 @@ var _ = Describe("LoadImagePatterns", func() {
 		}
 	})
 
-	It("reads from given file first if present", func() {
+	It("reads the given file instead of the chart hints", func() {
+		chart, err := loader.Load(filepath.Join(fixturesRoot, "self-relok8ing-chart"))
+		Expect(err).ToNot(HaveOccurred())
+
 		imagefile := filepath.Join(fixturesRoot, "testchart.images.yaml")
-		contents, err := loadImageHints(imagefile, nil, logger)
+		contents, err := loadImageHints([]string{imagefile}, chart, false, logger)
 		Expect(err).ToNot(HaveOccurred())
 
 		expected, err := os.ReadFile(imagefile)
@@ -626,7 +819,7 @@ var _ = Describe("LoadImagePatterns", func() {
 		chart, err := loader.Load(filepath.Join(fixturesRoot, "self-relok8ing-chart"))
 		Expect(err).ToNot(HaveOccurred())
 
-		contents, err := loadImageHints("", chart, logger)
+		contents, err := loadImageHints(nil, chart, false, logger)
 		Expect(err).ToNot(HaveOccurred())
 
 		embeddedPatterns := filepath.Join(fixturesRoot, "self-relok8ing-chart/.relok8s-images.yaml")
@@ -640,7 +833,7 @@ var _ = Describe("LoadImagePatterns", func() {
 		chart, err := loader.Load(filepath.Join(fixturesRoot, "testchart"))
 		Expect(err).ToNot(HaveOccurred())
 
-		contents, err := loadImageHints("", chart, logger)
+		contents, err := loadImageHints(nil, chart, false, logger)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(contents).To(BeEmpty())
 	})
@@ -808,3 +1001,248 @@ func sortCharts(charts []*chart.Chart) {
 		return charts[i].Name() < charts[j].Name()
 	})
 }
+
+var _ = Describe("loadImageChanges", func() {
+	values := test.MakeChart(&test.ChartSeed{Values: map[string]interface{}{
+		"image":   "docker.io/bitnami/wordpress:5.8.0",
+		"metrics": map[string]interface{}{"enabled": false, "image": "docker.io/bitnami/apache-exporter:0.10.0"},
+		"arm":     map[string]interface{}{"image": "docker.io/bitnami/nginx:1.21"},
+	}})
+
+	It("skips disabled and unset optional images, loading the requested platform", func() {
+		patterns, err := internal.ParseImagePatterns([]byte(`version: 2
+images:
+- reference: .image
+- reference: .metrics.image
+  condition: .metrics.enabled
+- reference: .unset.image
+  optional: true
+- reference: .arm.image
+  platforms: [linux/arm64]
+`))
+		Expect(err).ToNot(HaveOccurred())
+
+		platforms := map[string]string{}
+		load := func(ref name.Reference, platform *v1.Platform) (v1.Image, string, error) {
+			platforms[ref.Name()] = ""
+			if platform != nil {
+				platforms[ref.Name()] = platform.String()
+			}
+			return &moverfakes.FakeImage{}, "sha256:" + ref.Identifier(), nil
+		}
+		changes, skipped, err := loadImageChanges(values, patterns, false, load)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changes).To(HaveLen(2))
+		Expect(platforms).To(Equal(map[string]string{
+			"index.docker.io/bitnami/wordpress:5.8.0": "",
+			"index.docker.io/bitnami/nginx:1.21":      "linux/arm64",
+		}))
+		Expect(skipped).To(HaveLen(2))
+		Expect(skipped[0].hint).To(Equal("{{ .metrics.image }}"))
+		Expect(skipped[0].reason).To(Equal("condition .metrics.enabled is false"))
+		Expect(skipped[1].hint).To(Equal("{{ .unset.image }}"))
+	})
+
+	It("skips the images of components and subcharts disabled in the values", func() {
+		wordpress := test.MakeChart(&test.ChartSeed{
+			Values: map[string]interface{}{
+				"image":   "docker.io/bitnami/wordpress:5.8.0",
+				"metrics": map[string]interface{}{"enabled": false, "image": ""},
+				"mariadb": map[string]interface{}{"enabled": false},
+				"tags":    map[string]interface{}{"cache": false},
+			},
+			Dependencies: []*test.ChartSeed{
+				{Name: "mariadb", Values: map[string]interface{}{"image": "docker.io/bitnami/mariadb:10.5"}},
+				{Name: "memcached", Values: map[string]interface{}{"image": "docker.io/bitnami/memcached:1.6"}},
+				{Name: "redis", Values: map[string]interface{}{"image": "docker.io/bitnami/redis:6.2"}},
+			},
+		})
+		wordpress.Metadata = &chart.Metadata{Name: "wordpress", Dependencies: []*chart.Dependency{
+			{Name: "mariadb", Condition: "mariadb.enabled"},
+			{Name: "memcached", Tags: []string{"cache"}},
+			{Name: "redis", Condition: "redis.enabled", Tags: []string{"cache"}},
+		}}
+		patterns, err := internal.ParseImagePatterns([]byte(`---
+- "{{ .image }}"
+- "{{ .metrics.image }}"
+- "{{ .mariadb.image }}"
+- "{{ .memcached.image }}"
+`))
+		Expect(err).ToNot(HaveOccurred())
+
+		load := func(ref name.Reference, _ *v1.Platform) (v1.Image, string, error) {
+			return &moverfakes.FakeImage{}, "sha256:" + ref.Identifier(), nil
+		}
+		changes, skipped, err := loadImageChanges(wordpress, patterns, false, load)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changes).To(HaveLen(1))
+		Expect(changes[0].ImageReference.Name()).To(Equal("index.docker.io/bitnami/wordpress:5.8.0"))
+		Expect(skipped).To(Equal([]*skippedImage{
+			{hint: "{{ .metrics.image }}", reason: ".metrics.enabled is false"},
+			{hint: "{{ .mariadb.image }}", reason: "subchart mariadb is disabled by its condition mariadb.enabled"},
+			{hint: "{{ .memcached.image }}", reason: "subchart memcached is disabled by its tags cache"},
+		}))
+
+		By("relocating the disabled images when requested, skipping those not set", func() {
+			changes, skipped, err := loadImageChanges(wordpress, patterns, true, load)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changes).To(HaveLen(3))
+			Expect(skipped).To(HaveLen(1))
+			Expect(skipped[0].hint).To(Equal("{{ .metrics.image }}"))
+			Expect(skipped[0].reason).To(HavePrefix(".metrics.enabled is false and its image is not set"))
+		})
+	})
+
+	It("skips the images of aliased subcharts disabled under their alias", func() {
+		app := test.MakeChart(&test.ChartSeed{
+			Values: map[string]interface{}{
+				"cache":   map[string]interface{}{"enabled": false},
+				"session": map[string]interface{}{"enabled": true},
+			},
+			Dependencies: []*test.ChartSeed{
+				{Name: "redis", Values: map[string]interface{}{"image": "docker.io/bitnami/redis:6.2"}},
+			},
+		})
+		app.Metadata = &chart.Metadata{Name: "app", Dependencies: []*chart.Dependency{
+			{Name: "redis", Alias: "cache", Condition: "cache.enabled"},
+			{Name: "redis", Alias: "session", Condition: "session.enabled"},
+		}}
+		patterns, err := internal.ParseImagePatterns([]byte(`---
+- "{{ .cache.image }}"
+- "{{ .session.image }}"
+`))
+		Expect(err).ToNot(HaveOccurred())
+
+		load := func(ref name.Reference, _ *v1.Platform) (v1.Image, string, error) {
+			return &moverfakes.FakeImage{}, "sha256:" + ref.Identifier(), nil
+		}
+		changes, skipped, err := loadImageChanges(app, patterns, false, load)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changes).To(HaveLen(1))
+		Expect(changes[0].Pattern.Raw).To(Equal("{{ .session.image }}"))
+		Expect(skipped).To(Equal([]*skippedImage{
+			{hint: "{{ .cache.image }}", reason: "subchart cache is disabled by its condition cache.enabled"},
+		}))
+
+		By("relocating the disabled images when requested", func() {
+			changes, skipped, err := loadImageChanges(app, patterns, true, load)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changes).To(HaveLen(2))
+			Expect(skipped).To(BeEmpty())
+		})
+	})
+
+	It("moves the images of aliased subcharts", func() {
+		dir, err := os.MkdirTemp("", "aliased-chart-*")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		files := map[string]string{
+			"app/Chart.yaml":                 "apiVersion: v2\nname: app\nversion: 1.0.0\ndependencies:\n- name: mariadb\n  version: 1.0.0\n  alias: db\n",
+			"app/values.yaml":                "db:\n  enabled: true\n",
+			"app/charts/mariadb/Chart.yaml":  "apiVersion: v2\nname: mariadb\nversion: 1.0.0\n",
+			"app/charts/mariadb/values.yaml": "image:\n  registry: docker.io\n  repository: bitnami/mariadb\n  tag: \"10.6\"\n",
+		}
+		for path, contents := range files {
+			Expect(os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, path), []byte(contents), 0644)).To(Succeed())
+		}
+		app, err := loader.Load(filepath.Join(dir, "app"))
+		Expect(err).ToNot(HaveOccurred())
+
+		patterns, err := internal.ParseImagePatterns([]byte(`- "{{ .db.image.registry }}/{{ .db.image.repository }}:{{ .db.image.tag }}"`))
+		Expect(err).ToNot(HaveOccurred())
+		const digest = "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		load := func(ref name.Reference, _ *v1.Platform) (v1.Image, string, error) {
+			return makeImage(digest), digest, nil
+		}
+		changes, _, err := loadImageChanges(app, patterns, false, load)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changes).To(HaveLen(1))
+
+		fakeRegistry := &internalfakes.FakeContainerRegistryInterface{}
+		fakeRegistry.CheckReturns(true, nil)
+		cm := testChartMover(fakeRegistry, NoLogger)
+		cm.chart = app
+		cm.chartDestination = filepath.Join(dir, "app-1.0.0.relocated.tgz")
+		cm.imageChanges, cm.chartChanges, err = cm.computeChanges(changes, &RewriteRules{Registry: "harbor-repo.vmware.com"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cm.chartChanges).To(Equal([]*internal.RewriteAction{{Path: ".db.image.registry", Value: "harbor-repo.vmware.com"}}))
+		Expect(cm.moveChart()).To(Succeed())
+
+		relocated, err := loader.Load(cm.chartDestination)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(relocated.Dependencies()[0].Values["image"]).To(HaveKeyWithValue("registry", "harbor-repo.vmware.com"))
+	})
+
+	It("fails to apply rewrites of values missing from the values file", func() {
+		dir, err := os.MkdirTemp("", "missing-value-*")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		c := test.MakeChart(&test.ChartSeed{Values: map[string]interface{}{}})
+		c.Metadata = &chart.Metadata{Name: "app", Version: "1.0.0"}
+		c.Raw = []*chart.File{{Name: chartutil.ValuesfileName, Data: []byte("image:\n  registry: docker.io\n")}}
+
+		err = modifyChart(c, []*internal.RewriteAction{{Path: ".db.image.registry", Value: "harbor-repo.vmware.com"}}, nil,
+			filepath.Join(dir, "app.tgz"), "")
+		Expect(err).To(MatchError("failed to apply modification to app: no value at .db.image.registry in its values.yaml"))
+	})
+
+	It("loads an image per list item of wildcard patterns", func() {
+		sidecars := test.MakeChart(&test.ChartSeed{Values: map[string]interface{}{
+			"sidecars": []interface{}{
+				map[string]interface{}{"image": "docker.io/envoyproxy/envoy:v1.22.0"},
+				map[string]interface{}{"image": "docker.io/fluent/fluent-bit:1.9"},
+			},
+		}})
+		patterns, err := internal.ParseImagePatterns([]byte(`- "{{ .sidecars[*].image }}"`))
+		Expect(err).ToNot(HaveOccurred())
+
+		load := func(ref name.Reference, _ *v1.Platform) (v1.Image, string, error) {
+			return &moverfakes.FakeImage{}, "sha256:" + ref.Identifier(), nil
+		}
+		changes, _, err := loadImageChanges(sidecars, patterns, false, load)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changes).To(HaveLen(2))
+		Expect(changes[0].Pattern.Raw).To(Equal("{{ .sidecars[0].image }}"))
+		Expect(changes[1].ImageReference.Name()).To(Equal("index.docker.io/fluent/fluent-bit:1.9"))
+	})
+
+	It("loads the images hardcoded in templates, skipping those of disabled subcharts", func() {
+		wordpress := test.MakeChart(&test.ChartSeed{
+			Values: map[string]interface{}{"mariadb": map[string]interface{}{"enabled": false}},
+			Dependencies: []*test.ChartSeed{
+				{Name: "mariadb", Values: map[string]interface{}{}},
+			},
+		})
+		wordpress.Metadata = &chart.Metadata{Name: "wordpress", Dependencies: []*chart.Dependency{
+			{Name: "mariadb", Condition: "mariadb.enabled"},
+		}}
+		wordpress.Templates = []*chart.File{{Name: "templates/tests/test.yaml", Data: []byte("image: busybox:1.36\n")}}
+		patterns, err := internal.ParseImagePatterns([]byte(`version: 2
+images:
+- template: templates/tests/test.yaml
+  image: busybox:1.36
+- template: charts/mariadb/templates/job.yaml
+  image: docker.io/bitnami/kubectl:1.24
+`))
+		Expect(err).ToNot(HaveOccurred())
+
+		load := func(ref name.Reference, _ *v1.Platform) (v1.Image, string, error) {
+			return &moverfakes.FakeImage{}, "sha256:" + ref.Identifier(), nil
+		}
+		changes, skipped, err := loadImageChanges(wordpress, patterns, false, load)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changes).To(HaveLen(1))
+		Expect(changes[0].ImageReference.Name()).To(Equal("index.docker.io/library/busybox:1.36"))
+		Expect(skipped).To(Equal([]*skippedImage{
+			{hint: "docker.io/bitnami/kubectl:1.24 in charts/mariadb/templates/job.yaml", reason: "subchart mariadb is disabled by its condition mariadb.enabled"},
+		}))
+	})
+
+	It("fails on unset images that are not optional", func() {
+		patterns, err := internal.ParseImagePatterns([]byte(`- "{{ .unset.image }}"`))
+		Expect(err).ToNot(HaveOccurred())
+		_, _, err = loadImageChanges(values, patterns, false, nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
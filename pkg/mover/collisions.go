@@ -0,0 +1,89 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+)
+
+// ErrTargetCollision when distinct images would be relocated to the same target reference
+var ErrTargetCollision = errors.New("distinct images would be relocated to the same target")
+
+// collisionSource is an original image relocated to a colliding target
+type collisionSource struct {
+	image  string
+	digest string
+}
+
+// detectCollisions fails if images with different digests are relocated to
+// the same reference, as only one of them would be pushed and the rest of the
+// rewritten references would point to the wrong content. The error reports
+// the sources of each colliding target
+func detectCollisions(imageChanges []*internal.ImageChange) error {
+	sources := map[string][]collisionSource{}
+	digests := map[string]map[string]bool{}
+	for _, change := range imageChanges {
+		if change.RewrittenReference == nil {
+			continue
+		}
+		source := collisionSource{image: change.ImageReference.Name(), digest: change.Digest}
+		for _, target := range collisionTargets(change) {
+			if digests[target] == nil {
+				digests[target] = map[string]bool{}
+			}
+			digests[target][change.Digest] = true
+			if !containsSource(sources[target], source) {
+				sources[target] = append(sources[target], source)
+			}
+		}
+	}
+
+	collisions := []string{}
+	for target, targetDigests := range digests {
+		if len(targetDigests) > 1 {
+			collisions = append(collisions, target)
+		}
+	}
+	if len(collisions) == 0 {
+		return nil
+	}
+	sort.Strings(collisions)
+
+	var report strings.Builder
+	for _, target := range collisions {
+		fmt.Fprintf(&report, "\n  %s <=", target)
+		for _, source := range sources[target] {
+			fmt.Fprintf(&report, "\n    %s (%s)", source.image, source.digest)
+		}
+	}
+	return fmt.Errorf("%w:%s", ErrTargetCollision, report.String())
+}
+
+// collisionTargets are the references the change is written to: the
+// rewritten reference and, when pushed under a tag, the repository and tag
+// the image is pushed to, even if the rewritten reference is a digest
+func collisionTargets(change *internal.ImageChange) []string {
+	targets := []string{change.RewrittenReference.Name()}
+	if change.Tag != "" {
+		pushed := change.RewrittenReference.Context().Name() + ":" + change.Tag
+		if pushed != targets[0] {
+			targets = append(targets, pushed)
+		}
+	}
+	return targets
+}
+
+func containsSource(sources []collisionSource, source collisionSource) bool {
+	for _, s := range sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
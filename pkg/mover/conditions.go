@@ -0,0 +1,202 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal/yamlops"
+)
+
+// skippedImage is an image hint left out of the relocation, and why
+type skippedImage struct {
+	hint   string
+	reason string
+}
+
+// imageSkipper tells which image hints refer to components the chart values
+// disable, so their images are not relocated
+type imageSkipper struct {
+	chart *chart.Chart
+	// disabledSubcharts maps the values prefix of each subchart Helm would
+	// not install to the reason it is disabled
+	disabledSubcharts map[string]string
+	// disabledDirs maps the directory of each vendored subchart Helm would
+	// not install under any of its aliases to the reason it is disabled
+	disabledDirs map[string]string
+}
+
+func newImageSkipper(c *chart.Chart) *imageSkipper {
+	skipper := &imageSkipper{chart: c, disabledSubcharts: map[string]string{}, disabledDirs: map[string]string{}}
+	skipper.collectDisabledSubcharts(c, "", "")
+	return skipper
+}
+
+// skipReason returns why the image of the template is not relocated, empty
+// if it is. Images are skipped when:
+//   - the hint condition is false
+//   - they belong to a subchart disabled by its dependency condition or tags,
+//     by their values or by their template file
+//   - with no hint condition, the enabled flag of a map holding them is false,
+//     as with metrics.enabled for metrics.image
+func (s *imageSkipper) skipReason(template *internal.ImageTemplate) string {
+	if !template.Enabled(s.chart) {
+		return fmt.Sprintf("condition %s is false", template.Condition)
+	}
+	for _, path := range template.Paths() {
+		for _, prefix := range sortedKeys(s.disabledSubcharts) {
+			if hasPathPrefix(path, prefix) {
+				return s.disabledSubcharts[prefix]
+			}
+		}
+	}
+	if template.TemplateFile != "" {
+		for _, dir := range sortedKeys(s.disabledDirs) {
+			if strings.HasPrefix(template.TemplateFile, dir+"/") {
+				return s.disabledDirs[dir]
+			}
+		}
+	}
+	if template.Condition != "" {
+		// An explicit condition replaces the enabled flags
+		return ""
+	}
+	for _, path := range template.Paths() {
+		if flag := s.disabledFlag(path); flag != "" {
+			return fmt.Sprintf("%s is false", flag)
+		}
+	}
+	return ""
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// disabledFlag returns the first enabled flag set to false along the values
+// path, if any
+func (s *imageSkipper) disabledFlag(path string) string {
+	keys, err := internal.ParseValuesPath(path)
+	if err != nil {
+		return ""
+	}
+	for i := 1; i < len(keys); i++ {
+		if _, isIndex := keys[i-1].(int); isIndex {
+			continue
+		}
+		flag := internal.FormatValuesPath(append(append([]interface{}{}, keys[:i]...), "enabled"))
+		if value, _ := internal.LookupValue(s.chart, flag); value == false {
+			return flag
+		}
+	}
+	return ""
+}
+
+// hasPathPrefix tells if the values path is below the prefix path
+func hasPathPrefix(path, prefix string) bool {
+	keys, err := internal.ParseValuesPath(path)
+	if err != nil {
+		return false
+	}
+	prefixKeys, err := internal.ParseValuesPath(prefix)
+	if err != nil || len(prefixKeys) >= len(keys) {
+		return false
+	}
+	for i, key := range prefixKeys {
+		if keys[i] != key {
+			return false
+		}
+	}
+	return true
+}
+
+// collectDisabledSubcharts evaluates the dependencies of the chart at prefix,
+// vendored in dir, as Helm does: the first condition path set to a boolean
+// wins and, with no such condition, the dependency is disabled if its tags are
+// only set to false in the root chart tags values. Aliased dependencies are
+// evaluated on their own, under their alias. Subcharts of disabled ones are
+// not evaluated
+func (s *imageSkipper) collectDisabledSubcharts(c *chart.Chart, prefix, dir string) {
+	for _, subchart := range c.Dependencies() {
+		subchartDir := path.Join(dir, "charts", subchart.Name())
+		reasons := []string{}
+		keys := internal.SubchartValuesKeys(c, subchart)
+		for _, key := range keys {
+			subchartPrefix := yamlops.JoinPath(prefix, key)
+			if dependency := chartDependency(c, subchart, key); dependency != nil {
+				if reason := s.dependencyDisabled(dependency, key, prefix); reason != "" {
+					s.disabledSubcharts[subchartPrefix] = reason
+					reasons = append(reasons, reason)
+					continue
+				}
+			}
+			s.collectDisabledSubcharts(subchart, subchartPrefix, subchartDir)
+		}
+		// Templates are rendered if any of the aliases is installed
+		if len(reasons) == len(keys) {
+			s.disabledDirs[subchartDir] = strings.Join(reasons, ", ")
+		}
+	}
+}
+
+// chartDependency returns the dependency of the chart installing the subchart
+// under the values key, if declared
+func chartDependency(c *chart.Chart, subchart *chart.Chart, key string) *chart.Dependency {
+	if c.Metadata == nil {
+		return nil
+	}
+	for _, dependency := range c.Metadata.Dependencies {
+		if dependency.Name == subchart.Name() && (dependency.Alias == key || dependency.Alias == "" && dependency.Name == key) {
+			return dependency
+		}
+	}
+	return nil
+}
+
+// dependencyDisabled returns why the dependency installed under the values
+// key is disabled, empty if it is not
+func (s *imageSkipper) dependencyDisabled(dependency *chart.Dependency, key, prefix string) string {
+	for _, condition := range strings.Split(dependency.Condition, ",") {
+		condition = strings.TrimSpace(condition)
+		if condition == "" {
+			continue
+		}
+		value, _ := internal.LookupValue(s.chart, prefix+"."+condition)
+		if enabled, ok := value.(bool); ok {
+			if enabled {
+				return ""
+			}
+			return fmt.Sprintf("subchart %s is disabled by its condition %s", key, condition)
+		}
+	}
+
+	tags, _ := internal.LookupValue(s.chart, ".tags")
+	tagValues, _ := tags.(map[string]interface{})
+	falseTags := []string{}
+	for _, tag := range dependency.Tags {
+		enabled, ok := tagValues[tag].(bool)
+		if !ok {
+			continue
+		}
+		if enabled {
+			return ""
+		}
+		falseTags = append(falseTags, tag)
+	}
+	if len(falseTags) > 0 {
+		return fmt.Sprintf("subchart %s is disabled by its tags %s", key, strings.Join(falseTags, ", "))
+	}
+	return ""
+}
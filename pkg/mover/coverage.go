@@ -0,0 +1,218 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal/yamlops"
+)
+
+// ErrHintsCoverageIncomplete when rendered workload images are not found by the image hints
+var ErrHintsCoverageIncomplete = errors.New("images missing from the image hints")
+
+// CoverageReport compares the images of the workloads rendered from the
+// chart templates with the images found by the image hints
+type CoverageReport struct {
+	// MissingImages are rendered in the chart workloads but no hint finds them
+	MissingImages []string
+	// UnusedHints find images that no rendered workload uses
+	UnusedHints []string
+	// MissingTestImages are rendered in helm test hooks but no hint finds
+	// them. They are not installed with the chart, so they do not make the
+	// report incomplete
+	MissingTestImages []string
+}
+
+// Complete tells if the hints find every image of the rendered workloads
+func (r *CoverageReport) Complete() bool {
+	return len(r.MissingImages) == 0
+}
+
+// Print shows the images missing from the hints and the unused hints
+func (r *CoverageReport) Print(log Logger) {
+	if len(r.MissingImages) > 0 {
+		log.Println("Images missing from the image hints:")
+		for _, image := range r.MissingImages {
+			log.Printf("  %s\n", image)
+		}
+	}
+	if len(r.UnusedHints) > 0 {
+		log.Println("Image hints not used by any rendered workload:")
+		for _, hint := range r.UnusedHints {
+			log.Printf("  %s\n", hint)
+		}
+	}
+	if len(r.MissingTestImages) > 0 {
+		log.Println("Images of helm test hooks missing from the image hints, not required:")
+		for _, image := range r.MissingTestImages {
+			log.Printf("  %s\n", image)
+		}
+	}
+	if len(r.MissingImages) == 0 && len(r.UnusedHints) == 0 {
+		log.Println("The image hints cover all the rendered workload images")
+	}
+	log.Println()
+}
+
+// ImageHintsCoverage loads the source chart and its image hints, as a chart
+// move does, and reports how the hints cover the images of the workloads
+// rendered from the chart with its default values
+func ImageHintsCoverage(src *Source, opts ...Option) (*CoverageReport, error) {
+	cm := &ChartMover{logger: defaultLogger{}, retries: DefaultRetries}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(cm)
+		}
+	}
+
+	if err := cm.loadChart(src); err != nil {
+		return nil, err
+	}
+	if err := cm.vendorDependencies(src); err != nil {
+		return nil, err
+	}
+	if err := cm.loadImageHints(src); err != nil {
+		return nil, fmt.Errorf("failed to load hints file: %w", err)
+	}
+	imagePatterns, err := internal.ParseImagePatterns(cm.rawHints)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image patterns: %w", err)
+	}
+	return hintsCoverage(cm.chart, imagePatterns)
+}
+
+// verifyCoverage prints the hints coverage report, failing if images are missing
+func (cm *ChartMover) verifyCoverage(patterns []*internal.ImageTemplate) error {
+	report, err := hintsCoverage(cm.chart, patterns)
+	if err != nil {
+		return err
+	}
+	report.Print(cm.logger)
+	if !report.Complete() {
+		return fmt.Errorf("%w: %s", ErrHintsCoverageIncomplete, strings.Join(report.MissingImages, ", "))
+	}
+	return nil
+}
+
+// hintsCoverage compares the rendered workload images with the hint images
+func hintsCoverage(c *chart.Chart, patterns []*internal.ImageTemplate) (*CoverageReport, error) {
+	skipper := newImageSkipper(c)
+	workloads, tests, err := renderedImages(c)
+	if err != nil {
+		return nil, err
+	}
+	patterns, err = internal.ExpandImagePatterns(c, patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CoverageReport{MissingImages: []string{}, UnusedHints: []string{}, MissingTestImages: []string{}}
+	hinted := map[string]bool{}
+	for _, pattern := range patterns {
+		if skipper.skipReason(pattern) != "" {
+			continue
+		}
+		ref, err := pattern.Render(c)
+		if err != nil || !(workloads[ref.Name()] || tests[ref.Name()]) {
+			report.UnusedHints = append(report.UnusedHints, pattern.Raw)
+			continue
+		}
+		hinted[ref.Name()] = true
+	}
+	for image := range workloads {
+		if !hinted[image] {
+			report.MissingImages = append(report.MissingImages, image)
+		}
+	}
+	for image := range tests {
+		if !hinted[image] && !workloads[image] {
+			report.MissingTestImages = append(report.MissingTestImages, image)
+		}
+	}
+	sort.Strings(report.MissingImages)
+	sort.Strings(report.MissingTestImages)
+	return report, nil
+}
+
+// renderedImages renders the chart templates with the Helm engine, as a
+// helm template would, and collects the container images of its workloads
+// and, apart, of its helm test hooks. Dependencies are processed as Helm does
+// first, so that disabled subcharts are left out and aliased ones are
+// rendered under their alias
+func renderedImages(c *chart.Chart) (map[string]bool, map[string]bool, error) {
+	// Processing the dependencies modifies the chart
+	c, err := copyChart(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := chartutil.ProcessDependenciesWithMerge(c, map[string]interface{}{}); err != nil {
+		return nil, nil, fmt.Errorf("failed to process the dependencies of chart %s: %w", c.Name(), err)
+	}
+	values, err := chartutil.ToRenderValues(c, map[string]interface{}{}, chartutil.ReleaseOptions{
+		Name:      c.Name(),
+		Namespace: "default",
+		IsInstall: true,
+	}, chartutil.DefaultCapabilities)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to compute the values of chart %s: %w", c.Name(), err)
+	}
+
+	// Lint mode does not fail on required values with no default
+	manifests, err := engine.Engine{LintMode: true}.Render(c, values)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to render chart %s: %w", c.Name(), err)
+	}
+
+	workloads, tests := map[string]bool{}, map[string]bool{}
+	for filename, manifest := range manifests {
+		if ext := path.Ext(filename); ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		for i, doc := range yamlops.SplitDocuments([]byte(manifest)) {
+			obj := map[string]interface{}{}
+			if err := yaml.Unmarshal(doc, &obj); err != nil {
+				return nil, nil, fmt.Errorf("failed to parse rendered %s document #%d: %w", filename, i+1, err)
+			}
+			images := workloads
+			if isTestHook(obj) {
+				images = tests
+			}
+			for _, container := range containerImages(obj, "") {
+				image := container.image
+				if ref, err := name.ParseReference(image); err == nil {
+					image = ref.Name()
+				}
+				images[image] = true
+			}
+		}
+	}
+	return workloads, tests, nil
+}
+
+// isTestHook tells if the rendered object is a helm test hook, only run by
+// helm test
+func isTestHook(obj map[string]interface{}) bool {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	hooks, _ := annotations["helm.sh/hook"].(string)
+	for _, hook := range strings.Split(hooks, ",") {
+		// test-success is the Helm 2 name of test hooks
+		if hook := strings.TrimSpace(hook); hook == "test" || hook == "test-success" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/chart/loader"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+)
+
+var _ = Describe("Image hints coverage", func() {
+	source := &Source{
+		Chart:          ChartSpec{Local: &LocalChart{Path: filepath.Join(fixturesRoot, "testchart")}},
+		ImageHintsFile: filepath.Join(fixturesRoot, "testchart.images.yaml"),
+	}
+
+	It("reports the test hook images the hints miss apart", func() {
+		report, err := ImageHintsCoverage(source, WithLogger(NoLogger))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.MissingImages).To(BeEmpty())
+		Expect(report.UnusedHints).To(BeEmpty())
+		// The helm test pod image is hardcoded in the template
+		Expect(report.MissingTestImages).To(Equal([]string{"index.docker.io/library/busybox:latest"}))
+		Expect(report.Complete()).To(BeTrue())
+	})
+
+	It("reports the hints no rendered workload uses", func() {
+		cm := &ChartMover{logger: NoLogger}
+		Expect(cm.loadChart(source)).To(Succeed())
+		patterns, err := internal.ParseImagePatterns([]byte(`
+- "{{ .image.repository }}:{{ .image.tag }}"
+- "{{ .sameImageButNoTagRequirement.image }}"
+- "{{ .singleImageReference.image }}"
+- "{{ .subchart.image.name }}:{{ .subchart.image.tag }}"
+- "{{ .unknown.image }}"
+`))
+		Expect(err).ToNot(HaveOccurred())
+
+		report, err := hintsCoverage(cm.chart, patterns)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.UnusedHints).To(Equal([]string{"{{ .unknown.image }}"}))
+
+		Expect(report.Complete()).To(BeTrue())
+
+		By("failing when the hints miss a workload image", func() {
+			patterns, err := internal.ParseImagePatterns([]byte(`
+- "{{ .image.repository }}:{{ .image.tag }}"
+- "{{ .subchart.image.name }}:{{ .subchart.image.tag }}"
+`))
+			Expect(err).ToNot(HaveOccurred())
+			err = cm.verifyCoverage(patterns)
+			Expect(errors.Is(err, ErrHintsCoverageIncomplete)).To(BeTrue())
+			Expect(err).To(MatchError(ContainSubstring("harbor-repo.vmware.com/dockerhub-proxy-cache/library/busybox:1.33.1")))
+		})
+	})
+
+	It("renders the dependencies as Helm processes them", func() {
+		dir, err := os.MkdirTemp("", "coverage-chart-*")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		pod := "apiVersion: v1\nkind: Pod\nmetadata:\n  name: {{ .Chart.Name }}\nspec:\n  containers:\n  - name: redis\n    image: {{ .Values.image }}\n"
+		files := map[string]string{
+			"app/Chart.yaml":                      "apiVersion: v2\nname: app\nversion: 1.0.0\ndependencies:\n- name: redis\n  version: 1.0.0\n  alias: cache\n  condition: cache.enabled\n- name: redis\n  version: 1.0.0\n  alias: session\n  condition: session.enabled\n",
+			"app/values.yaml":                     "cache:\n  enabled: false\n  image: docker.io/bitnami/redis:6.0\nsession:\n  enabled: true\n  image: docker.io/bitnami/redis:6.2\n",
+			"app/charts/redis/Chart.yaml":         "apiVersion: v2\nname: redis\nversion: 1.0.0\n",
+			"app/charts/redis/values.yaml":        "image: docker.io/bitnami/redis:latest\n",
+			"app/charts/redis/templates/pod.yaml": pod,
+		}
+		for path, contents := range files {
+			Expect(os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, path), []byte(contents), 0644)).To(Succeed())
+		}
+		app, err := loader.Load(filepath.Join(dir, "app"))
+		Expect(err).ToNot(HaveOccurred())
+		patterns, err := internal.ParseImagePatterns([]byte(`
+- "{{ .cache.image }}"
+- "{{ .session.image }}"
+`))
+		Expect(err).ToNot(HaveOccurred())
+
+		report, err := hintsCoverage(app, patterns)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.MissingImages).To(BeEmpty())
+		Expect(report.UnusedHints).To(BeEmpty())
+		Expect(report.Complete()).To(BeTrue())
+		Expect(app.Dependencies()).To(HaveLen(1), "the loaded chart is left as is")
+	})
+})
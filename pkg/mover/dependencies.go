@@ -0,0 +1,330 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+// vendorDependencies fetches the dependencies declared in the chart
+// Chart.yaml that are missing from its charts/ directory and adds them to the
+// chart, recursively. Locked versions from Chart.lock take precedence over
+// the Chart.yaml version constraints.
+//
+// Only dependencies from Helm HTTP repositories and OCI registries can be
+// resolved, OCI registries are reached with the source containers auth.
+func vendorDependencies(c *chart.Chart, auth *ContainersAuth, log Logger) error {
+	missing := missingDependencies(c)
+	if len(missing) > 0 {
+		if err := validateLock(c); err != nil {
+			return fmt.Errorf("failed to resolve dependencies of chart %s: %w", c.Name(), err)
+		}
+
+		tmpDir, err := os.MkdirTemp("", "chart-dependencies-*")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary directory to download dependencies: %w", err)
+		}
+		defer os.RemoveAll(tmpDir)
+
+		for _, dep := range missing {
+			locked, err := lockedDependency(c.Lock, dep)
+			if err != nil {
+				return fmt.Errorf("failed to resolve dependency %s of chart %s: %w", dep.Name, c.Name(), err)
+			}
+			log.Printf("Fetching dependency %s %s from %s...\n", dep.Name, locked.Version, dep.Repository)
+			if err := vendorDependency(c, locked, auth, tmpDir); err != nil {
+				return fmt.Errorf("failed to resolve dependency %s of chart %s from %q: %w",
+					dep.Name, c.Name(), dep.Repository, err)
+			}
+		}
+	}
+
+	for _, sub := range c.Dependencies() {
+		if err := vendorDependencies(sub, auth, log); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missingDependencies returns the dependencies declared in Chart.yaml that
+// have no matching subchart loaded from charts/
+func missingDependencies(c *chart.Chart) []*chart.Dependency {
+	missing := []*chart.Dependency{}
+	for _, dep := range c.Metadata.Dependencies {
+		if subchart(c, dep.Name) == nil {
+			missing = append(missing, dep)
+		}
+	}
+	return missing
+}
+
+// validateLock checks Chart.lock, if present, still matches the dependencies
+// declared in Chart.yaml, the same way helm dependency build does
+func validateLock(c *chart.Chart) error {
+	if c.Lock == nil {
+		return nil
+	}
+	digest, err := hashDependencies(c.Metadata.Dependencies, c.Lock.Dependencies)
+	if err != nil {
+		return err
+	}
+	if digest != c.Lock.Digest {
+		return fmt.Errorf("Chart.lock is out of sync with Chart.yaml, run helm dependency update")
+	}
+	return nil
+}
+
+// hashDependencies computes the Chart.lock digest of the declared and locked
+// dependencies, as Helm does
+func hashDependencies(declared, locked []*chart.Dependency) (string, error) {
+	data, err := json.Marshal([2][]*chart.Dependency{declared, locked})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash dependencies: %w", err)
+	}
+	digest, err := provenance.Digest(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to hash dependencies: %w", err)
+	}
+	return "sha256:" + digest, nil
+}
+
+// lockedDependency returns the dependency to fetch, that is the Chart.lock
+// entry if the chart has a lock or the Chart.yaml declaration otherwise
+func lockedDependency(lock *chart.Lock, dep *chart.Dependency) (*chart.Dependency, error) {
+	if dep.Repository == "" {
+		return nil, fmt.Errorf("it is not vendored in charts/ and declares no repository")
+	}
+	if lock == nil {
+		return dep, nil
+	}
+	for _, locked := range lock.Dependencies {
+		if locked.Name == dep.Name {
+			return &chart.Dependency{Name: dep.Name, Version: locked.Version, Repository: dep.Repository}, nil
+		}
+	}
+	return nil, fmt.Errorf("it is missing from Chart.lock")
+}
+
+// vendorDependency downloads the dependency and adds it to the parent chart
+// both as a loaded subchart and as a charts/ raw file, so that intermediate
+// bundles carry it too
+func vendorDependency(parent *chart.Chart, dep *chart.Dependency, auth *ContainersAuth, dir string) error {
+	data, err := fetchDependency(dep, auth, dir)
+	if err != nil {
+		return err
+	}
+
+	sub, err := loader.LoadArchive(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to load dependency: %w", err)
+	}
+	if sub.Name() != dep.Name {
+		return fmt.Errorf("fetched chart %s does not match the dependency name", sub.Name())
+	}
+	if err := checkDependencyVersion(dep.Version, sub.Metadata.Version); err != nil {
+		return err
+	}
+
+	parent.AddDependency(sub)
+	parent.Raw = append(parent.Raw, &chart.File{
+		Name: path.Join("charts", fmt.Sprintf("%s-%s.tgz", sub.Name(), sub.Metadata.Version)),
+		Data: data,
+	})
+	return nil
+}
+
+// fetchDependency returns the dependency chart tarball contents
+func fetchDependency(dep *chart.Dependency, auth *ContainersAuth, dir string) ([]byte, error) {
+	switch {
+	case IsOCIChart(dep.Repository):
+		repository := strings.TrimSuffix(dep.Repository, "/") + "/" + dep.Name
+		version, err := resolveOCIChartVersion(repository, dep.Version, auth)
+		if err != nil {
+			return nil, err
+		}
+		return pullOCIChart(repository+":"+version, auth)
+	case strings.HasPrefix(dep.Repository, "http://"), strings.HasPrefix(dep.Repository, "https://"):
+		chartPath, err := downloadRepositoryChart(&RepositoryChart{URL: dep.Repository, Name: dep.Name, Version: dep.Version}, dir)
+		if err != nil {
+			return nil, err
+		}
+		return os.ReadFile(chartPath)
+	default:
+		return nil, fmt.Errorf("unsupported repository, only http(s):// and oci:// repositories can be fetched")
+	}
+}
+
+// resolveOCIChartVersion returns the latest chart version in the OCI
+// repository matching the constraint, or the version itself if exact
+func resolveOCIChartVersion(repository, version string, auth *ContainersAuth) (string, error) {
+	if _, err := semver.StrictNewVersion(version); err == nil {
+		return version, nil
+	}
+	constraint, err := semver.NewConstraint(version)
+	if err != nil {
+		return "", fmt.Errorf("invalid version constraint %q: %w", version, err)
+	}
+
+	ociRef := strings.TrimPrefix(repository, fmt.Sprintf("%s://", registry.OCIScheme))
+	client, cleanup, err := newHelmRegistryClient(ociRef, auth)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	tags, err := client.Tags(ociRef)
+	if err != nil {
+		return "", fmt.Errorf("failed to list versions of %s: %w", repository, err)
+	}
+	// tags come sorted from the latest version
+	for _, tag := range tags {
+		if v, err := semver.NewVersion(tag); err == nil && constraint.Check(v) {
+			return tag, nil
+		}
+	}
+	return "", fmt.Errorf("no version of %s matches %q", repository, version)
+}
+
+// checkDependencyVersion fails if the fetched version does not satisfy the
+// declared version or constraint
+func checkDependencyVersion(declared, fetched string) error {
+	if declared == "" {
+		return nil
+	}
+	constraint, err := semver.NewConstraint(declared)
+	if err != nil {
+		return fmt.Errorf("invalid version constraint %q: %w", declared, err)
+	}
+	v, err := semver.NewVersion(fetched)
+	if err != nil || !constraint.Check(v) {
+		return fmt.Errorf("fetched version %s does not match %q", fetched, declared)
+	}
+	return nil
+}
+
+// ErrDependencyRepositoryMissing indicates that the chart dependencies cannot
+// be kept as there is no repository to point them to
+var ErrDependencyRepositoryMissing = errors.New("a dependency repository, OCI chart target, repository directory URL or ChartMuseum target is required to keep the chart dependencies")
+
+// dependencyRepository returns the repository the relocated dependencies are
+// referenced from and whether the subcharts have to be published there along
+// with the chart
+func dependencyRepository(deps *RelocatedDependencies, target *ChartSpec, ociChartBase string) (string, bool, error) {
+	switch {
+	case deps.Repository != "":
+		return strings.TrimSuffix(deps.Repository, "/"), false, nil
+	case ociChartBase != "":
+		return ociChartBase, true, nil
+	case target.RepositoryDir != nil && target.RepositoryDir.URL != "":
+		return strings.TrimSuffix(target.RepositoryDir.URL, "/"), true, nil
+	case target.ChartMuseum != nil:
+		return strings.TrimSuffix(target.ChartMuseum.URL, "/"), true, nil
+	}
+	return "", false, ErrDependencyRepositoryMissing
+}
+
+// relocateDependencyRefs points the vendored dependencies of the chart, and
+// its subcharts recursively, to the given repository and regenerates
+// Chart.lock with the vendored versions.
+// Dependencies without a vendored subchart are left untouched.
+func relocateDependencyRefs(c *chart.Chart, repository string) error {
+	for _, sub := range c.Dependencies() {
+		if err := relocateDependencyRefs(sub, repository); err != nil {
+			return err
+		}
+	}
+	if len(c.Metadata.Dependencies) == 0 {
+		return nil
+	}
+
+	locked := []*chart.Dependency{}
+	for _, dep := range c.Metadata.Dependencies {
+		sub := subchart(c, dep.Name)
+		if sub == nil {
+			if c.Lock != nil {
+				if lockedDep, err := lockedDependency(c.Lock, dep); err == nil {
+					locked = append(locked, &chart.Dependency{
+						Name: dep.Name, Version: lockedDep.Version, Repository: dep.Repository,
+					})
+				}
+			}
+			continue
+		}
+		dep.Repository = repository
+		locked = append(locked, &chart.Dependency{Name: dep.Name, Version: sub.Metadata.Version, Repository: repository})
+	}
+
+	digest, err := hashDependencies(c.Metadata.Dependencies, locked)
+	if err != nil {
+		return err
+	}
+	c.Lock = &chart.Lock{Generated: time.Now(), Digest: digest, Dependencies: locked}
+	return nil
+}
+
+// subchart returns the loaded subchart with the given name, if any
+func subchart(c *chart.Chart, name string) *chart.Chart {
+	for _, sub := range c.Dependencies() {
+		if sub.Name() == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// relocatedSubcharts returns all the chart subcharts, recursively, once per
+// name and version
+func relocatedSubcharts(c *chart.Chart) []*chart.Chart {
+	subcharts := []*chart.Chart{}
+	seen := map[string]bool{}
+	var walk func(*chart.Chart)
+	walk = func(c *chart.Chart) {
+		for _, sub := range c.Dependencies() {
+			walk(sub)
+			key := sub.Name() + "-" + sub.Metadata.Version
+			if !seen[key] {
+				seen[key] = true
+				subcharts = append(subcharts, sub)
+			}
+		}
+	}
+	walk(c)
+	return subcharts
+}
+
+// publishDependencies publishes every relocated subchart to the chart
+// targets, so that the relocated dependency references can be resolved
+func (cm *ChartMover) publishDependencies(dir string) error {
+	for _, sub := range relocatedSubcharts(cm.chart) {
+		filename := filepath.Join(dir, fmt.Sprintf("%s-%s.tgz", sub.Name(), sub.Metadata.Version))
+		if err := saveChart(sub, filename); err != nil {
+			return fmt.Errorf("failed to save relocated subchart %s: %w", sub.Name(), err)
+		}
+		if cm.targetOCIChartBase != "" {
+			ref := ociChartRef(cm.targetOCIChartBase, sub.Name(), sub.Metadata.Version)
+			if err := cm.pushChart(filename, ref); err != nil {
+				return err
+			}
+		}
+		if err := cm.publishChart(filename, sub.Metadata); err != nil {
+			return err
+		}
+	}
+	return nil
+}
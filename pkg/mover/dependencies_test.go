@@ -0,0 +1,220 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// parentChart returns a chart declaring the given dependencies without any
+// of them vendored in charts/
+func parentChart(deps ...*chart.Dependency) *chart.Chart {
+	return &chart.Chart{
+		Metadata: &chart.Metadata{
+			APIVersion:   chart.APIVersionV2,
+			Name:         "parent",
+			Version:      "1.0.0",
+			Dependencies: deps,
+		},
+	}
+}
+
+var _ = Describe("Chart dependencies", func() {
+	var subchartPath = filepath.Join(fixturesRoot, "3-levels-chart", "charts", "subchart-2")
+
+	Describe("from a Helm HTTP repository", func() {
+		var (
+			repoDir string
+			server  *httptest.Server
+		)
+
+		BeforeEach(func() {
+			var err error
+			repoDir, err = os.MkdirTemp("", "dependencies-test-*")
+			Expect(err).ToNot(HaveOccurred())
+			server = newTestRepository(repoDir, subchartPath, "0.1.0", "0.2.0")
+		})
+
+		AfterEach(func() {
+			server.Close()
+			os.RemoveAll(repoDir)
+		})
+
+		It("vendors the missing dependency", func() {
+			c := parentChart(&chart.Dependency{Name: "subchart-2", Version: "0.x", Repository: server.URL})
+			Expect(vendorDependencies(c, nil, NoLogger)).To(Succeed())
+
+			Expect(c.Dependencies()).To(HaveLen(1))
+			Expect(c.Dependencies()[0].Name()).To(Equal("subchart-2"))
+			Expect(c.Dependencies()[0].Metadata.Version).To(Equal("0.2.0"))
+			Expect(c.Raw).To(HaveLen(1))
+			Expect(c.Raw[0].Name).To(Equal("charts/subchart-2-0.2.0.tgz"))
+		})
+
+		It("fetches the version locked in Chart.lock", func() {
+			deps := []*chart.Dependency{{Name: "subchart-2", Version: "0.x", Repository: server.URL}}
+			c := parentChart(deps...)
+			c.Lock = &chart.Lock{Dependencies: []*chart.Dependency{{Name: "subchart-2", Version: "0.1.0", Repository: server.URL}}}
+			digest, err := hashDependencies(deps, c.Lock.Dependencies)
+			Expect(err).ToNot(HaveOccurred())
+			c.Lock.Digest = digest
+
+			Expect(vendorDependencies(c, nil, NoLogger)).To(Succeed())
+			Expect(c.Dependencies()).To(HaveLen(1))
+			Expect(c.Dependencies()[0].Metadata.Version).To(Equal("0.1.0"))
+		})
+
+		It("fails if Chart.lock is out of sync", func() {
+			c := parentChart(&chart.Dependency{Name: "subchart-2", Version: "0.x", Repository: server.URL})
+			c.Lock = &chart.Lock{
+				Digest:       "sha256:0000",
+				Dependencies: []*chart.Dependency{{Name: "subchart-2", Version: "0.1.0", Repository: server.URL}},
+			}
+			err := vendorDependencies(c, nil, NoLogger)
+			Expect(err).To(MatchError(ContainSubstring("Chart.lock is out of sync with Chart.yaml")))
+		})
+
+		It("fails if the dependency version is not found", func() {
+			c := parentChart(&chart.Dependency{Name: "subchart-2", Version: "1.x", Repository: server.URL})
+			err := vendorDependencies(c, nil, NoLogger)
+			Expect(err).To(MatchError(ContainSubstring(`failed to resolve dependency subchart-2 of chart parent from "` + server.URL + `"`)))
+			Expect(err).To(MatchError(ContainSubstring(`chart subchart-2 version "1.x" not found`)))
+		})
+	})
+
+	Describe("from an OCI registry", func() {
+		var (
+			server *httptest.Server
+			host   string
+		)
+
+		BeforeEach(func() {
+			server = httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+			u, err := url.Parse(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+			host = u.Host
+			pushTestChart(host, subchartPath)
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("vendors the missing dependency", func() {
+			c := parentChart(&chart.Dependency{Name: "subchart-2", Version: "0.1.0", Repository: "oci://" + host + "/charts"})
+			Expect(vendorDependencies(c, nil, NoLogger)).To(Succeed())
+			Expect(c.Dependencies()).To(HaveLen(1))
+			Expect(c.Dependencies()[0].Name()).To(Equal("subchart-2"))
+		})
+
+		It("resolves a version constraint", func() {
+			c := parentChart(&chart.Dependency{Name: "subchart-2", Version: "~0.1", Repository: "oci://" + host + "/charts"})
+			Expect(vendorDependencies(c, nil, NoLogger)).To(Succeed())
+			Expect(c.Dependencies()[0].Metadata.Version).To(Equal("0.1.0"))
+		})
+
+		It("publishes the relocated subcharts along with the chart", func() {
+			testChart, err := loader.Load(filepath.Join(fixturesRoot, "3-levels-chart"))
+			Expect(err).ToNot(HaveOccurred())
+
+			base := "oci://" + host + "/relocated"
+			cm := &ChartMover{
+				chart:                      testChart,
+				logger:                     NoLogger,
+				retries:                    testRetries,
+				targetOCIChartBase:         base,
+				targetOCIChart:             ociChartRef(base, testChart.Name(), testChart.Metadata.Version),
+				targetDependencyRepository: base,
+				publishSubcharts:           true,
+			}
+			Expect(cm.moveChart()).To(Succeed())
+
+			for _, name := range []string{"3-levels-chart", "subchart-1", "subchart-2", "subchart-3"} {
+				pulled := &ChartMover{}
+				err := pulled.loadChart(&Source{Chart: ChartSpec{OCI: &OCIChart{Reference: ociChartRef(base, name, "0.1.0")}}})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(validateLock(pulled.chart)).To(Succeed())
+				for _, dep := range pulled.chart.Metadata.Dependencies {
+					Expect(dep.Repository).To(Equal(base))
+				}
+			}
+		})
+	})
+
+	Describe("relocateDependencyRefs", func() {
+		It("points the dependencies to the repository and regenerates Chart.lock", func() {
+			c, err := loader.Load(filepath.Join(fixturesRoot, "3-levels-chart"))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(relocateDependencyRefs(c, "https://charts.example.com")).To(Succeed())
+
+			for _, parent := range []*chart.Chart{c, subchart(c, "subchart-1")} {
+				Expect(parent.Metadata.Dependencies).ToNot(BeEmpty())
+				for _, dep := range parent.Metadata.Dependencies {
+					Expect(dep.Repository).To(Equal("https://charts.example.com"))
+				}
+				Expect(parent.Lock.Dependencies).To(HaveLen(len(parent.Metadata.Dependencies)))
+				for _, locked := range parent.Lock.Dependencies {
+					Expect(locked.Repository).To(Equal("https://charts.example.com"))
+					Expect(locked.Version).To(Equal("0.1.0"))
+				}
+				Expect(validateLock(parent)).To(Succeed())
+			}
+		})
+	})
+
+	Describe("dependencyRepository", func() {
+		It("prefers the explicit repository", func() {
+			repository, publish, err := dependencyRepository(&RelocatedDependencies{Repository: "https://charts.example.com/"},
+				&ChartSpec{}, "oci://registry.example.com/charts")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repository).To(Equal("https://charts.example.com"))
+			Expect(publish).To(BeFalse())
+		})
+
+		It("publishes the subcharts to the chart target", func() {
+			repository, publish, err := dependencyRepository(&RelocatedDependencies{},
+				&ChartSpec{ChartMuseum: &ChartMuseum{URL: "https://museum.example.com"}}, "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repository).To(Equal("https://museum.example.com"))
+			Expect(publish).To(BeTrue())
+		})
+
+		It("requires a repository", func() {
+			_, _, err := dependencyRepository(&RelocatedDependencies{}, &ChartSpec{RepositoryDir: &RepositoryDir{Path: "repo"}}, "")
+			Expect(err).To(MatchError(ErrDependencyRepositoryMissing))
+		})
+	})
+
+	It("fails if the dependency declares no repository", func() {
+		c := parentChart(&chart.Dependency{Name: "subchart-2", Version: "0.1.0"})
+		err := vendorDependencies(c, nil, NoLogger)
+		Expect(err).To(MatchError(ContainSubstring("it is not vendored in charts/ and declares no repository")))
+	})
+
+	It("fails on unsupported repositories", func() {
+		c := parentChart(&chart.Dependency{Name: "subchart-2", Version: "0.1.0", Repository: "@stable"})
+		err := vendorDependencies(c, nil, NoLogger)
+		Expect(err).To(MatchError(ContainSubstring("unsupported repository")))
+	})
+
+	It("leaves already vendored dependencies alone", func() {
+		c, err := loader.Load(filepath.Join(fixturesRoot, "3-levels-chart"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(validateLock(c)).To(Succeed())
+		Expect(vendorDependencies(c, nil, NoLogger)).To(Succeed())
+		Expect(c.Dependencies()).To(HaveLen(2))
+	})
+})
@@ -0,0 +1,68 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+)
+
+// globalRegistryAction returns the action rewriting the chart global
+// imageRegistry to the registry every image moves to, at its location, nil if
+// only the image registries are rewritten. The global registry is rewritten
+// when asked to or when it already overrides the image registries, as
+// rewriting them would have no effect at install time on the templates
+// reading the global. Unless asked to, the image registries are rewritten too,
+// since templates may not read the global
+func (cm *ChartMover) globalRegistryAction(imageChanges []*internal.ImageChange, locations []*internal.OCIImageLocation, useGlobal bool) (*internal.RewriteAction, error) {
+	registries := map[string]bool{}
+	for i, change := range imageChanges {
+		if change.Pattern.RegistryTemplate == "" {
+			continue
+		}
+		if change.Pattern.GlobalImageRegistry(cm.chart) != "" {
+			useGlobal = true
+		}
+		relocated, err := internal.RelocateReference(change.ImageReference.Context(), change.Digest, locations[i])
+		if err != nil {
+			return nil, err
+		}
+		registries[relocated.Context().RegistryStr()] = true
+	}
+	if !useGlobal || len(registries) == 0 {
+		return nil, nil
+	}
+
+	if _, ok := internal.LookupValue(cm.chart, internal.GlobalImageRegistryPath); !ok {
+		return nil, fmt.Errorf("can't rewrite the global registry, the chart has no %s value", internal.GlobalImageRegistryPath)
+	}
+	if len(registries) > 1 {
+		names := make([]string, 0, len(registries))
+		for registry := range registries {
+			names = append(names, registry)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("can't rewrite the global registry, the images move to several registries: %s", strings.Join(names, ", "))
+	}
+
+	for registry := range registries {
+		return &internal.RewriteAction{Path: internal.GlobalImageRegistryPath, Value: registry}, nil
+	}
+	return nil, nil
+}
+
+// withoutRegistryAction drops the action rewriting the image registry, as the
+// global registry overrides it
+func withoutRegistryAction(actions []*internal.RewriteAction, pattern *internal.ImageTemplate) []*internal.RewriteAction {
+	result := []*internal.RewriteAction{}
+	for _, action := range actions {
+		if pattern.RegistryTemplate == "" || action.Path != pattern.RegistryTemplate {
+			result = append(result, action)
+		}
+	}
+	return result
+}
@@ -0,0 +1,376 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal/yamlops"
+)
+
+// ArtifactHubImagesAnnotation lists the chart images in Chart.yaml, as published in Artifact Hub
+const ArtifactHubImagesAnnotation = "artifacthub.io/images"
+
+// hintPathRegex matches the values paths generated image hints refer to, made
+// of plain or quoted keys and list items
+var hintPathRegex = regexp.MustCompile(`^((\.[A-Za-z0-9_-]+|\.?\["(?:[^"\\]|\\.)*"\])(\[\d+\])*)+$`)
+
+// GenerateImageHints loads the source chart, fetching its missing
+// dependencies, and returns an image hints file with the images found in the
+// chart and subcharts values. Both image maps, with registry, repository or
+// name, tag and digest keys, and plain image strings are detected
+func GenerateImageHints(src *Source, opts ...Option) ([]byte, error) {
+	cm := &ChartMover{logger: defaultLogger{}, retries: DefaultRetries}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(cm)
+		}
+	}
+
+	if err := cm.loadChart(src); err != nil {
+		return nil, err
+	}
+	if src.Chart.IntermediateBundle == nil {
+		if err := vendorDependencies(cm.chart, src.ContainersAuth, cm.logger); err != nil {
+			return nil, err
+		}
+	}
+
+	patterns, err := chartImagePatterns(cm.chart, "")
+	if err != nil {
+		return nil, err
+	}
+	hints := encodeImageHints(patterns)
+
+	// Make sure the generated file is usable as is
+	if _, err := internal.ParseImagePatterns(hints); err != nil {
+		return nil, fmt.Errorf("generated invalid image hints: %w", err)
+	}
+	return hints, nil
+}
+
+// ConvertImageHints rewrites an image hints file, in any format, in the
+// legacy list of patterns format (version 1) or the structured one (version 2)
+func ConvertImageHints(rawHints []byte, version int) ([]byte, error) {
+	templates, err := internal.ParseImagePatterns(rawHints)
+	if err != nil {
+		return nil, err
+	}
+	return internal.EncodeImagePatterns(templates, version)
+}
+
+// chartImagePatterns returns the image patterns of the chart values followed
+// by those of its subcharts, prefixed by their values keys
+func chartImagePatterns(c *chart.Chart, prefix string) ([]string, error) {
+	patterns := []string{}
+	for _, file := range c.Raw {
+		if file.Name != chartutil.ValuesfileName {
+			continue
+		}
+		found, err := valuesImagePatterns(file.Data, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan values of chart %s: %w", c.Name(), err)
+		}
+		patterns = append(patterns, found...)
+	}
+
+	dependencies := append([]*chart.Chart{}, c.Dependencies()...)
+	sort.Slice(dependencies, func(i, j int) bool {
+		return dependencies[i].Name() < dependencies[j].Name()
+	})
+	for _, dependency := range dependencies {
+		for _, key := range internal.SubchartValuesKeys(c, dependency) {
+			found, err := chartImagePatterns(dependency, yamlops.JoinPath(prefix, key))
+			if err != nil {
+				return nil, err
+			}
+			patterns = append(patterns, found...)
+		}
+	}
+	return uniquePatterns(patterns), nil
+}
+
+// valuesImagePatterns scans the values document for image maps and image
+// strings, returning their patterns in document order
+func valuesImagePatterns(values []byte, prefix string) ([]string, error) {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(values, doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	rootPath := prefix
+	if rootPath == "" {
+		rootPath = "."
+	}
+	patterns := []string{}
+	scanner := yamlops.NewNodeScanner(doc.Content[0], rootPath)
+	for scanner.Next() {
+		node, path := scanner.Current()
+		if node == doc.Content[0] || !hintPathRegex.MatchString(path) {
+			continue
+		}
+		switch node.Kind {
+		case yaml.MappingNode:
+			if pattern, ok := imageMapPattern(node, path); ok {
+				patterns = append(patterns, pattern)
+			}
+		case yaml.ScalarNode:
+			if strings.HasSuffix(path, ".image") && isImageString(node) {
+				patterns = append(patterns, fmt.Sprintf("{{ %s }}", path))
+			}
+		}
+	}
+	return patterns, nil
+}
+
+// imageMapPattern returns the pattern of a map splitting the image in
+// registry, repository (or name), tag and digest keys
+func imageMapPattern(node *yaml.Node, path string) (string, bool) {
+	fields := map[string]*yaml.Node{}
+	for i := 0; i < len(node.Content); i += 2 {
+		if value := node.Content[i+1]; value.Kind == yaml.ScalarNode {
+			fields[node.Content[i].Value] = value
+		}
+	}
+
+	repositoryKey := "repository"
+	if fields[repositoryKey] == nil {
+		repositoryKey = "name"
+	}
+	repository := fields[repositoryKey]
+	if repository == nil || repository.Tag != "!!str" || repository.Value == "" {
+		return "", false
+	}
+	registry, tag, digest := fields["registry"], fields["tag"], fields["digest"]
+	if registry == nil && tag == nil && digest == nil {
+		// A lone repository or name is not enough to tell it is an image
+		return "", false
+	}
+
+	pattern := fmt.Sprintf("{{ %s.%s }}", path, repositoryKey)
+	if registry != nil {
+		pattern = fmt.Sprintf("{{ %s.registry }}/%s", path, pattern)
+	}
+	// Digests are preferred when set, as they are immutable
+	if digest != nil && (digest.Value != "" || tag == nil) {
+		pattern += fmt.Sprintf("@{{ %s.digest }}", path)
+	} else if tag != nil {
+		pattern += fmt.Sprintf(":{{ %s.tag }}", path)
+	}
+	return pattern, true
+}
+
+// isImageString tells if the scalar is a non empty string parsing as an image
+func isImageString(node *yaml.Node) bool {
+	if node.Tag != "!!str" || node.Value == "" {
+		return false
+	}
+	_, err := name.ParseReference(node.Value)
+	return err == nil
+}
+
+func uniquePatterns(patterns []string) []string {
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		if !seen[pattern] {
+			seen[pattern] = true
+			unique = append(unique, pattern)
+		}
+	}
+	return unique
+}
+
+// encodeImageHints writes the patterns in the image hints file format
+func encodeImageHints(patterns []string) []byte {
+	out := bytes.Buffer{}
+	out.WriteString("---\n")
+	for _, pattern := range patterns {
+		fmt.Fprintf(&out, "- %q\n", pattern)
+	}
+	return out.Bytes()
+}
+
+// hintsSource is an image hints document whose patterns refer to the values
+// of the subchart at prefix, vendored in the dir of the root chart
+type hintsSource struct {
+	data   []byte
+	prefix string
+	dir    string
+}
+
+// chartHintsSources returns the hints the chart and its subcharts carry.
+// Annotation images are matched against the images found in the values,
+// rendered with the root chart values. Subcharts vendored once but installed
+// under several aliases have their hints for each of them
+func chartHintsSources(root, c *chart.Chart, prefix, dir string, log Logger) ([]*hintsSource, error) {
+	sources := []*hintsSource{}
+
+	embeddedLog := log
+	if prefix != "" {
+		embeddedLog = noLogger{}
+	}
+	rawHints, err := loadImageHintsFromChart(c, embeddedLog)
+	if err != nil {
+		return nil, err
+	}
+	if rawHints != nil {
+		if prefix != "" {
+			log.Printf("%s hints file found in subchart %s\n", EmbeddedHintsFilename, strings.TrimPrefix(prefix, "."))
+		}
+		sources = append(sources, &hintsSource{data: rawHints, prefix: prefix, dir: dir})
+	}
+
+	annotationHints, err := annotationImagePatterns(root, c, prefix, log)
+	if err != nil {
+		return nil, err
+	}
+	if len(annotationHints) > 0 {
+		sources = append(sources, &hintsSource{data: encodeImageHints(annotationHints)})
+	}
+
+	for _, dependency := range c.Dependencies() {
+		dependencyDir := path.Join(dir, "charts", dependency.Name())
+		for _, key := range internal.SubchartValuesKeys(c, dependency) {
+			dependencySources, err := chartHintsSources(root, dependency, yamlops.JoinPath(prefix, key), dependencyDir, log)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, dependencySources...)
+		}
+	}
+	return sources, nil
+}
+
+// annotationImage is an entry of the artifacthub.io/images annotation
+type annotationImage struct {
+	Name  string `yaml:"name"`
+	Image string `yaml:"image"`
+}
+
+// annotationImagePatterns turns the images listed in the chart
+// artifacthub.io/images annotation into the patterns of the values they are
+// set in. Images not found in the values are reported and skipped
+func annotationImagePatterns(root, c *chart.Chart, prefix string, log Logger) ([]string, error) {
+	if c.Metadata == nil || c.Metadata.Annotations[ArtifactHubImagesAnnotation] == "" {
+		return nil, nil
+	}
+	images := []*annotationImage{}
+	if err := yaml.Unmarshal([]byte(c.Metadata.Annotations[ArtifactHubImagesAnnotation]), &images); err != nil {
+		return nil, fmt.Errorf("failed to parse the %s annotation of chart %s: %w", ArtifactHubImagesAnnotation, c.Name(), err)
+	}
+	log.Printf("%s annotation found in chart %s\n", ArtifactHubImagesAnnotation, c.Name())
+
+	candidates, err := chartImagePatterns(c, prefix)
+	if err != nil {
+		return nil, err
+	}
+	byImage := map[string][]string{}
+	for _, candidate := range candidates {
+		template, err := internal.NewFromString(candidate)
+		if err != nil {
+			continue
+		}
+		if ref, err := template.Render(root); err == nil {
+			byImage[ref.Name()] = append(byImage[ref.Name()], candidate)
+		}
+	}
+
+	patterns := []string{}
+	for _, image := range images {
+		ref, err := name.ParseReference(image.Image)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image %q in the %s annotation of chart %s: %w", image.Image, ArtifactHubImagesAnnotation, c.Name(), err)
+		}
+		if len(byImage[ref.Name()]) == 0 {
+			log.Printf("Warning: image %s of the %s annotation of chart %s was not found in its values\n",
+				image.Image, ArtifactHubImagesAnnotation, c.Name())
+			continue
+		}
+		patterns = append(patterns, byImage[ref.Name()]...)
+	}
+	return uniquePatterns(patterns), nil
+}
+
+// mergeHintsSources merges the hints into a single deduplicated hints
+// document, in the structured format if any hint needs it
+func mergeHintsSources(sources []*hintsSource) ([]byte, error) {
+	templates := []*internal.ImageTemplate{}
+	seen := map[string]bool{}
+	version := 1
+	for _, source := range sources {
+		sourceTemplates, err := internal.ParseImagePatterns(source.data)
+		if err != nil {
+			return nil, err
+		}
+		for _, template := range sourceTemplates {
+			if template, err = prefixTemplate(template, source.prefix, source.dir); err != nil {
+				return nil, err
+			}
+			if seen[template.Raw] {
+				continue
+			}
+			seen[template.Raw] = true
+			if template.Structured() {
+				version = internal.ImageHintsV2
+			}
+			templates = append(templates, template)
+		}
+	}
+	return internal.EncodeImagePatterns(templates, version)
+}
+
+// prefixTemplate makes the template values paths, condition included, and
+// template file relative to the root chart of the subchart at prefix,
+// vendored in dir
+func prefixTemplate(template *internal.ImageTemplate, prefix, dir string) (*internal.ImageTemplate, error) {
+	if prefix == "" {
+		return template, nil
+	}
+	var prefixed *internal.ImageTemplate
+	var err error
+	if template.TemplateImage != "" {
+		prefixed, err = internal.NewFromTemplateImage(path.Join(dir, template.TemplateFile), template.TemplateImage)
+	} else {
+		prefixed, err = internal.NewFromString(prefixPattern(template.Raw, prefix))
+	}
+	if err != nil {
+		return nil, err
+	}
+	prefixed.Optional = template.Optional
+	prefixed.Platforms = template.Platforms
+	if template.Condition != "" {
+		prefixed.Condition = prefix + template.Condition
+	}
+	return prefixed, nil
+}
+
+// prefixPattern makes the values paths of the pattern relative to the parent
+// chart of the subchart at prefix
+func prefixPattern(pattern, prefix string) string {
+	if prefix == "" {
+		return pattern
+	}
+	return internal.TemplateRegex.ReplaceAllStringFunc(pattern, func(placeholder string) string {
+		path := prefix + internal.TemplateRegex.FindStringSubmatch(placeholder)[1]
+		if keys, err := internal.ParseValuesPath(path); err == nil {
+			path = internal.FormatValuesPath(keys)
+		}
+		return fmt.Sprintf("{{ %s }}", path)
+	})
+}
@@ -0,0 +1,185 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+	"helm.sh/helm/v3/pkg/chart"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+)
+
+var _ = Describe("Image hints generation", func() {
+	Describe("valuesImagePatterns", func() {
+		It("finds image maps and image strings, list items and quoted keys included", func() {
+			patterns, err := valuesImagePatterns([]byte(`
+image:
+  registry: docker.io
+  repository: bitnami/wordpress
+  tag: 5.8.0
+  digest: ""
+metrics:
+  image:
+    repository: bitnami/apache-exporter
+    digest: sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa
+    tag: 0.10.0
+sidecar:
+  image: busybox:1.33.1
+serviceAccount:
+  name: wordpress
+persistence:
+  image: true
+extraContainers:
+- image: nginx:1.21
+app.kubernetes.io/proxy:
+  image: envoyproxy/envoy:v1.22.0
+`), ".wordpress")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(patterns).To(Equal([]string{
+				"{{ .wordpress.image.registry }}/{{ .wordpress.image.repository }}:{{ .wordpress.image.tag }}",
+				"{{ .wordpress.metrics.image.repository }}@{{ .wordpress.metrics.image.digest }}",
+				"{{ .wordpress.sidecar.image }}",
+				"{{ .wordpress.extraContainers[0].image }}",
+				`{{ .wordpress["app.kubernetes.io/proxy"].image }}`,
+			}))
+		})
+	})
+
+	It("generates the hints of the chart and its subcharts", func() {
+		hints, err := GenerateImageHints(&Source{Chart: ChartSpec{Local: &LocalChart{Path: filepath.Join(fixturesRoot, "testchart")}}},
+			WithLogger(NoLogger))
+		Expect(err).ToNot(HaveOccurred())
+		patterns, err := internal.ParseImagePatterns(hints)
+		Expect(err).ToNot(HaveOccurred())
+
+		data, err := os.ReadFile(filepath.Join(fixturesRoot, "testchart.images.yaml"))
+		Expect(err).ToNot(HaveOccurred())
+		expected, err := internal.ParseImagePatterns(data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(patterns).To(HaveLen(len(expected)))
+		for i := range expected {
+			Expect(patterns[i].Raw).To(Equal(expected[i].Raw))
+		}
+	})
+})
+
+var _ = Describe("Image hints sources", func() {
+	subchart := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "mariadb"},
+		Values: map[string]interface{}{
+			"image": map[string]interface{}{"repository": "bitnami/mariadb", "tag": "10.6"},
+		},
+		Files: []*chart.File{{Name: EmbeddedHintsFilename, Data: []byte(`- "{{ .image.repository }}:{{ .image.tag }}"`)}},
+	}
+	parent := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "wordpress", Annotations: map[string]string{
+			ArtifactHubImagesAnnotation: `
+- name: wordpress
+  image: docker.io/bitnami/wordpress:5.8.0
+- name: unknown
+  image: docker.io/bitnami/unknown:1.0.0
+`}},
+		Values: map[string]interface{}{
+			"image": map[string]interface{}{"registry": "docker.io", "repository": "bitnami/wordpress", "tag": "5.8.0"},
+			"metrics": map[string]interface{}{
+				"image": map[string]interface{}{"registry": "docker.io", "repository": "bitnami/apache-exporter", "tag": "0.10.0"},
+			},
+		},
+		Raw: []*chart.File{{Name: "values.yaml", Data: []byte(`
+image:
+  registry: docker.io
+  repository: bitnami/wordpress
+  tag: 5.8.0
+metrics:
+  image:
+    registry: docker.io
+    repository: bitnami/apache-exporter
+    tag: 0.10.0
+`)}},
+	}
+	parent.SetDependencies(subchart)
+
+	It("prefixes the values paths of subchart patterns", func() {
+		Expect(prefixPattern("{{ .image.repository }}:{{.image.tag}}", ".mariadb")).
+			To(Equal("{{ .mariadb.image.repository }}:{{ .mariadb.image.tag }}"))
+		Expect(prefixPattern(`{{ .["app.kubernetes.io/proxy"].image }}`, ".mariadb")).
+			To(Equal(`{{ .mariadb["app.kubernetes.io/proxy"].image }}`))
+	})
+
+	It("merges the hints files, the annotation and the subcharts hints", func() {
+		logger := &FakeLogger{Output: NewBuffer()}
+		hintsFile := filepath.Join(fixturesRoot, "testchart.images.yaml")
+
+		hints, err := loadImageHints([]string{hintsFile, hintsFile}, parent, true, logger)
+		Expect(err).ToNot(HaveOccurred())
+		patterns, err := internal.ParseImagePatterns(hints)
+		Expect(err).ToNot(HaveOccurred())
+
+		raw := []string{}
+		for _, pattern := range patterns {
+			raw = append(raw, pattern.Raw)
+		}
+		Expect(raw).To(Equal([]string{
+			"{{ .image.repository }}:{{ .image.tag }}",
+			"{{ .sameImageButNoTagRequirement.image }}",
+			"{{ .singleImageReference.image }}",
+			"{{ .subchart.image.name }}:{{ .subchart.image.tag }}",
+			"{{ .image.registry }}/{{ .image.repository }}:{{ .image.tag }}",
+			"{{ .mariadb.image.repository }}:{{ .mariadb.image.tag }}",
+		}))
+		Expect(logger.Output).To(Say("docker.io/bitnami/unknown:1.0.0 of the artifacthub.io/images annotation of chart wordpress was not found"))
+		Expect(logger.Output).To(Say(".relok8s-images.yaml hints file found in subchart mariadb"))
+
+		By("replacing the chart hints with the hints files unless merging them", func() {
+			hints, err := loadImageHints([]string{hintsFile}, parent, false, logger)
+			Expect(err).ToNot(HaveOccurred())
+			expected, err := os.ReadFile(hintsFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hints).To(Equal(expected))
+		})
+	})
+
+	It("prefixes the hints of aliased subcharts with their aliases", func() {
+		redis := &chart.Chart{
+			Metadata: &chart.Metadata{Name: "redis"},
+			Values: map[string]interface{}{
+				"image": map[string]interface{}{"repository": "bitnami/redis", "tag": "6.2"},
+			},
+			Files: []*chart.File{{Name: EmbeddedHintsFilename, Data: []byte(`version: 2
+images:
+- repository: .image.repository
+  tag: .image.tag
+- template: templates/job.yaml
+  image: docker.io/bitnami/kubectl:1.24
+`)}},
+		}
+		app := &chart.Chart{
+			Metadata: &chart.Metadata{Name: "app", Dependencies: []*chart.Dependency{
+				{Name: "redis", Alias: "cache"},
+				{Name: "redis", Alias: "session"},
+			}},
+		}
+		app.SetDependencies(redis)
+
+		hints, err := loadImageHints(nil, app, false, NoLogger)
+		Expect(err).ToNot(HaveOccurred())
+		patterns, err := internal.ParseImagePatterns(hints)
+		Expect(err).ToNot(HaveOccurred())
+
+		raw := []string{}
+		for _, pattern := range patterns {
+			raw = append(raw, pattern.Raw)
+		}
+		Expect(raw).To(Equal([]string{
+			"{{ .cache.image.repository }}:{{ .cache.image.tag }}",
+			"docker.io/bitnami/kubectl:1.24 in charts/redis/templates/job.yaml",
+			"{{ .session.image.repository }}:{{ .session.image.tag }}",
+		}))
+	})
+})
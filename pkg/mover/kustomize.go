@@ -0,0 +1,150 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"gopkg.in/yaml.v3"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+)
+
+// KustomizationFilename is the overlay file written to the KustomizeOverlay directory
+const KustomizationFilename = "kustomization.yaml"
+
+// KustomizeOverlay is a directory where a Kustomize overlay relocating the
+// chart images is written, leaving the chart untouched. An existing
+// kustomization.yaml gets its images replaced, keeping the rest of it
+type KustomizeOverlay struct {
+	Path string
+}
+
+// kustomizeImage is an entry of the Kustomize images transformer
+type kustomizeImage struct {
+	Name    string `yaml:"name"`
+	NewName string `yaml:"newName,omitempty"`
+	NewTag  string `yaml:"newTag,omitempty"`
+	Digest  string `yaml:"digest,omitempty"`
+}
+
+// kustomizeImages turns the image changes into Kustomize images entries,
+// matching the images as rendered by the chart and pointing them to the same
+// references the rewritten chart would use
+func kustomizeImages(changes []*internal.ImageChange) []*kustomizeImage {
+	images := []*kustomizeImage{}
+	byName := map[string]*kustomizeImage{}
+	for _, change := range changes {
+		image := &kustomizeImage{
+			Name:    imageName(change.ImageReference),
+			NewName: change.RewrittenReference.Context().Name(),
+		}
+		if _, ok := change.RewrittenReference.(name.Digest); ok {
+			image.Digest = change.RewrittenReference.Identifier()
+			image.NewTag = referenceTag(change.RewrittenReference)
+		} else {
+			image.NewTag = change.RewrittenReference.Identifier()
+		}
+
+		if previous, ok := byName[image.Name]; ok {
+			if previous.NewTag != image.NewTag || previous.Digest != image.Digest {
+				// Kustomize matches images by name only, so differently tagged
+				// images just get their new name and keep their original tags
+				previous.NewTag = ""
+				previous.Digest = ""
+			}
+			continue
+		}
+		byName[image.Name] = image
+		images = append(images, image)
+	}
+	return images
+}
+
+// imageName returns the image as written in the chart, without tag nor digest
+func imageName(ref name.Reference) string {
+	image := ref.String()
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// writeKustomizeOverlay sets the images of the kustomization.yaml in dir
+func writeKustomizeOverlay(dir string, images []*kustomizeImage) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create Kustomize overlay directory: %w", err)
+	}
+	filename := filepath.Join(dir, KustomizationFilename)
+
+	doc := &yaml.Node{}
+	data, err := os.ReadFile(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := yaml.Unmarshal(data, doc); err != nil {
+			return "", fmt.Errorf("failed to parse %s: %w", filename, err)
+		}
+	}
+	if len(doc.Content) == 0 {
+		doc = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+		setMapValue(doc.Content[0], "apiVersion", &yaml.Node{Kind: yaml.ScalarNode, Value: "kustomize.config.k8s.io/v1beta1"})
+		setMapValue(doc.Content[0], "kind", &yaml.Node{Kind: yaml.ScalarNode, Value: "Kustomization"})
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return "", fmt.Errorf("failed to parse %s: expected a map", filename)
+	}
+
+	imagesNode, err := yamlNode(images)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode Kustomize images: %w", err)
+	}
+	setMapValue(root, "images", imagesNode)
+
+	out := bytes.Buffer{}
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return "", fmt.Errorf("failed to encode %s: %w", filename, err)
+	}
+	if err := os.WriteFile(filename, out.Bytes(), defaultPerm); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+	return filename, nil
+}
+
+// yamlNode encodes the value as a YAML node
+func yamlNode(value interface{}) (*yaml.Node, error) {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, err
+	}
+	return doc.Content[0], nil
+}
+
+// setMapValue replaces the value of the key in the map node, adding it if missing
+func setMapValue(node *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = value
+			return
+		}
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+)
+
+var _ = Describe("Kustomize overlay", func() {
+	const digest = "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+
+	changes := []*internal.ImageChange{
+		{
+			ImageReference:     name.MustParseReference("docker.io/bitnami/wordpress:1.2.3"),
+			RewrittenReference: name.MustParseReference("harbor-repo.vmware.com/pwall/wordpress@" + digest),
+		},
+		{
+			ImageReference:     name.MustParseReference("docker.io/bitnami/wavefront:5.6.7"),
+			RewrittenReference: name.MustParseReference("harbor-repo.vmware.com/pwall/wavefront:5.6.7"),
+		},
+		{
+			ImageReference:     name.MustParseReference("docker.io/bitnami/wavefront:5.6.7"),
+			RewrittenReference: name.MustParseReference("harbor-repo.vmware.com/pwall/wavefront:5.6.7"),
+		},
+		{
+			ImageReference:     name.MustParseReference("busybox:1.0"),
+			RewrittenReference: name.MustParseReference("harbor-repo.vmware.com/pwall/busybox:1.0"),
+		},
+		{
+			ImageReference:     name.MustParseReference("busybox:1.1"),
+			RewrittenReference: name.MustParseReference("harbor-repo.vmware.com/pwall/busybox:1.1"),
+		},
+	}
+
+	Describe("kustomizeImages", func() {
+		It("points the images as written in the chart to their rewritten references", func() {
+			Expect(kustomizeImages(changes)).To(Equal([]*kustomizeImage{
+				{Name: "docker.io/bitnami/wordpress", NewName: "harbor-repo.vmware.com/pwall/wordpress", Digest: digest},
+				{Name: "docker.io/bitnami/wavefront", NewName: "harbor-repo.vmware.com/pwall/wavefront", NewTag: "5.6.7"},
+				{Name: "busybox", NewName: "harbor-repo.vmware.com/pwall/busybox"},
+			}))
+		})
+	})
+
+	Describe("writeKustomizeOverlay", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "kustomize-test-*")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("creates the kustomization", func() {
+			filename, err := writeKustomizeOverlay(filepath.Join(dir, "overlay"), kustomizeImages(changes[:2]))
+			Expect(err).ToNot(HaveOccurred())
+			data, err := os.ReadFile(filename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal(`apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+images:
+- name: docker.io/bitnami/wordpress
+  newName: harbor-repo.vmware.com/pwall/wordpress
+  digest: ` + digest + `
+- name: docker.io/bitnami/wavefront
+  newName: harbor-repo.vmware.com/pwall/wavefront
+  newTag: 5.6.7
+`))
+		})
+
+		It("replaces the images of an existing kustomization", func() {
+			filename := filepath.Join(dir, KustomizationFilename)
+			Expect(os.WriteFile(filename, []byte(`# wordpress overlay
+resources:
+  - ../base
+images:
+  - name: old
+`), 0644)).To(Succeed())
+
+			_, err := writeKustomizeOverlay(dir, kustomizeImages(changes[1:2]))
+			Expect(err).ToNot(HaveOccurred())
+			data, err := os.ReadFile(filename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal(`# wordpress overlay
+resources:
+- ../base
+images:
+- name: docker.io/bitnami/wavefront
+  newName: harbor-repo.vmware.com/pwall/wavefront
+  newTag: 5.6.7
+`))
+		})
+	})
+
+	It("cannot be combined with other chart targets", func() {
+		err := validateTarget(&Target{
+			Chart: ChartSpec{KustomizeOverlay: &KustomizeOverlay{Path: "overlay"}, Local: &LocalChart{Path: "%s-%s.tgz"}},
+			Rules: RewriteRules{Registry: "harbor-repo.vmware.com"},
+		})
+		Expect(err).To(MatchError("kustomize overlays and values override files leave the chart untouched, they cannot be combined with other chart targets"))
+	})
+})
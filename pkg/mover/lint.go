@@ -0,0 +1,290 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chart"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+)
+
+// ErrImageHintsInvalid when linting the image hints finds errors
+var ErrImageHintsInvalid = errors.New("invalid image hints")
+
+// HintFinding is an issue found linting an image hints file
+type HintFinding struct {
+	File string
+	// Line of the hint in the file
+	Line int
+	Hint string
+	// Warning findings do not break the relocation, errors do
+	Warning bool
+	Message string
+}
+
+func (f *HintFinding) String() string {
+	severity := "error"
+	if f.Warning {
+		severity = "warning"
+	}
+	return fmt.Sprintf("%s:%d: %s: %s: %s", f.File, f.Line, severity, f.Hint, f.Message)
+}
+
+// lintedHint is a hint of the file along with what linting found out about it
+type lintedHint struct {
+	line     int
+	raw      string
+	template *internal.ImageTemplate
+	// image is the rendered reference name, empty if it does not render
+	image string
+}
+
+// LintImageHints loads the source chart and checks its image hints files, or
+// its embedded hints file when none is given, against it. Findings are
+// returned in file and line order
+func LintImageHints(src *Source, opts ...Option) ([]*HintFinding, error) {
+	cm := &ChartMover{logger: defaultLogger{}, retries: DefaultRetries}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(cm)
+		}
+	}
+
+	if err := cm.loadChart(src); err != nil {
+		return nil, err
+	}
+	if src.Chart.IntermediateBundle == nil {
+		if err := vendorDependencies(cm.chart, src.ContainersAuth, cm.logger); err != nil {
+			return nil, err
+		}
+	}
+
+	findings := []*HintFinding{}
+	files := src.imageHintsFiles()
+	if len(files) == 0 {
+		rawHints, err := loadImageHintsFromChart(cm.chart, cm.logger)
+		if err != nil {
+			return nil, err
+		}
+		if rawHints == nil {
+			return nil, ErrImageHintsMissing
+		}
+		return lintImageHints(EmbeddedHintsFilename, rawHints, cm.chart)
+	}
+	for _, file := range files {
+		rawHints, err := loadImageHintsFromFile(file)
+		if err != nil {
+			return nil, err
+		}
+		fileFindings, err := lintImageHints(file, rawHints, cm.chart)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, fileFindings...)
+	}
+	return findings, nil
+}
+
+// lintImageHints checks each hint of the file against the chart: the
+// template must parse, its values paths must be set to strings and it must
+// render to a valid image. Wildcard hints are checked for each list item.
+// Hints are also checked against each other
+func lintImageHints(file string, rawHints []byte, c *chart.Chart) ([]*HintFinding, error) {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(rawHints, doc); err != nil {
+		return nil, fmt.Errorf("image pattern file %s is not in the correct format: %w", file, err)
+	}
+	if len(doc.Content) == 0 {
+		return []*HintFinding{}, nil
+	}
+	nodes, structured, err := hintNodes(doc.Content[0])
+	if err != nil {
+		return nil, fmt.Errorf("image pattern file %s is not in the correct format: %w", file, err)
+	}
+
+	findings := []*HintFinding{}
+	report := func(hint *lintedHint, warning bool, format string, args ...interface{}) {
+		findings = append(findings, &HintFinding{
+			File: file, Line: hint.line, Hint: hint.raw, Warning: warning, Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	skipper := newImageSkipper(c)
+	hints := []*lintedHint{}
+	for _, node := range nodes {
+		hint := &lintedHint{line: node.Line, raw: node.Value}
+		hints = append(hints, hint)
+
+		template, err := hintTemplate(node, structured)
+		if err != nil {
+			report(hint, false, "invalid template: %v", err)
+			continue
+		}
+		hint.template = template
+		hint.raw = template.Raw
+
+		expanded, err := template.Expand(c)
+		if err != nil {
+			report(hint, false, "%v", err)
+			continue
+		}
+		if template.HasWildcard() && len(expanded) == 0 {
+			report(hint, true, "the wildcard matches no list items")
+			continue
+		}
+		reportItem := func(warning bool, format string, args ...interface{}) {
+			report(hint, warning, format, args...)
+		}
+		for _, item := range expanded {
+			// Images of disabled components are not relocated, their values may be unset
+			if skipper.skipReason(item) != "" {
+				continue
+			}
+			image := lintTemplate(c, item, reportItem)
+			if len(expanded) == 1 {
+				hint.image = image
+			}
+		}
+	}
+
+	for i, hint := range hints {
+		if message := compareHint(hint, hints[:i]); message != "" {
+			report(hint, true, "%s", message)
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Line < findings[j].Line
+	})
+	return findings, nil
+}
+
+// lintTemplate checks the values paths of the template and renders it,
+// returning the image name, empty if it does not render
+func lintTemplate(c *chart.Chart, template *internal.ImageTemplate, report func(warning bool, format string, args ...interface{})) string {
+	valid := true
+	for _, path := range template.Paths() {
+		value, ok := internal.LookupValue(c, path)
+		switch {
+		case !ok:
+			report(template.Optional, "values path %s not found", path)
+			valid = false
+		case value == nil:
+			report(template.Optional, "values path %s is null", path)
+			valid = false
+		default:
+			if _, isString := value.(string); !isString {
+				report(false, "values path %s is a %T, expected a string", path, value)
+				valid = false
+			}
+		}
+	}
+	if !valid {
+		return ""
+	}
+	ref, err := template.Render(c)
+	if err != nil {
+		report(template.Optional, "%v", err)
+		return ""
+	}
+	return ref.Name()
+}
+
+// hintNodes returns the hint nodes of the document, the pattern strings of a
+// legacy document or the image maps of a structured (v2) one
+func hintNodes(root *yaml.Node) ([]*yaml.Node, bool, error) {
+	switch root.Kind {
+	case yaml.SequenceNode:
+		return root.Content, false, nil
+	case yaml.MappingNode:
+		for i := 0; i < len(root.Content); i += 2 {
+			if root.Content[i].Value == "images" && root.Content[i+1].Kind == yaml.SequenceNode {
+				return root.Content[i+1].Content, true, nil
+			}
+		}
+	}
+	return nil, false, errors.New("expected a list of patterns or a structured hints document")
+}
+
+// hintTemplate parses the template of a hint node
+func hintTemplate(node *yaml.Node, structured bool) (*internal.ImageTemplate, error) {
+	if structured {
+		hint := &internal.ImageHint{}
+		if err := node.Decode(hint); err != nil {
+			return nil, err
+		}
+		return internal.NewFromHint(hint)
+	}
+	if node.Kind != yaml.ScalarNode {
+		return nil, errors.New("expected a pattern string")
+	}
+	return internal.NewFromString(node.Value)
+}
+
+// compareHint checks the hint against the previous ones, returning how it
+// relates to the first one it duplicates, overlaps or renders the same as
+func compareHint(hint *lintedHint, previousHints []*lintedHint) string {
+	if hint.template == nil {
+		return ""
+	}
+	for _, previous := range previousHints {
+		if previous.template == nil {
+			continue
+		}
+		if normalizedPattern(previous.raw) == normalizedPattern(hint.raw) {
+			return fmt.Sprintf("duplicate of the hint at line %d", previous.line)
+		}
+		if path := sharedPath(previous.template, hint.template); path != "" {
+			return fmt.Sprintf("overlaps the hint at line %d on values path %s", previous.line, path)
+		}
+		if hint.image != "" && hint.image == previous.image {
+			return fmt.Sprintf("produces the same image %s as the hint at line %d", hint.image, previous.line)
+		}
+	}
+	return ""
+}
+
+// normalizedPattern drops the spaces of the pattern placeholders
+func normalizedPattern(pattern string) string {
+	return internal.TemplateRegex.ReplaceAllString(pattern, "{{$1}}")
+}
+
+// sharedPath returns a values path both templates refer to, if any
+func sharedPath(a, b *internal.ImageTemplate) string {
+	for _, pathA := range a.Paths() {
+		for _, pathB := range b.Paths() {
+			if pathA == pathB {
+				return pathA
+			}
+		}
+	}
+	return ""
+}
+
+// PrintHintFindings shows the findings, one per line
+func PrintHintFindings(findings []*HintFinding, log Logger) {
+	for _, finding := range findings {
+		log.Println(finding.String())
+	}
+}
+
+// HintFindingsError returns an error counting the findings that are not
+// warnings, nil if there are none
+func HintFindingsError(findings []*HintFinding) error {
+	count := 0
+	for _, finding := range findings {
+		if !finding.Warning {
+			count++
+		}
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %d errors found", ErrImageHintsInvalid, count)
+	}
+	return nil
+}
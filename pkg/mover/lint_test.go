@@ -0,0 +1,54 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+var _ = Describe("Image hints lint", func() {
+	It("reports each finding with the hint line", func() {
+		c, err := loader.Load(filepath.Join(fixturesRoot, "testchart"))
+		Expect(err).ToNot(HaveOccurred())
+
+		findings, err := lintImageHints("hints.yaml", []byte(`---
+- "{{ .image.repository }}:{{ .image.tag }}"
+- "{{ .missing.image }}"
+- "{{ .replicaCount }}"
+- "{{.image.repository}}:{{.image.tag}}"
+- "{{ .image.repository }}@{{ .image.digest }}"
+- "{{ .sameImageButNoTagRequirement.image }}"
+- "not a template"
+`), c)
+		Expect(err).ToNot(HaveOccurred())
+
+		lines := []string{}
+		for _, finding := range findings {
+			lines = append(lines, finding.String())
+		}
+		Expect(lines).To(Equal([]string{
+			"hints.yaml:3: error: {{ .missing.image }}: values path .missing.image not found",
+			"hints.yaml:4: error: {{ .replicaCount }}: values path .replicaCount is a float64, expected a string",
+			"hints.yaml:5: warning: {{.image.repository}}:{{.image.tag}}: duplicate of the hint at line 2",
+			"hints.yaml:6: error: {{ .image.repository }}@{{ .image.digest }}: values path .image.digest not found",
+			"hints.yaml:6: warning: {{ .image.repository }}@{{ .image.digest }}: overlaps the hint at line 2 on values path .image.repository",
+			"hints.yaml:7: warning: {{ .sameImageButNoTagRequirement.image }}: produces the same image harbor-repo.vmware.com/tanzu_isv_engineering/tiny:tiniest as the hint at line 2",
+			`hints.yaml:8: error: not a template: invalid template: failed to parse image template "not a template": missing repo or a registry fragment`,
+		}))
+		Expect(HintFindingsError(findings)).To(MatchError(ErrImageHintsInvalid))
+	})
+
+	It("finds no errors in valid hints", func() {
+		findings, err := LintImageHints(&Source{
+			Chart:          ChartSpec{Local: &LocalChart{Path: filepath.Join(fixturesRoot, "testchart")}},
+			ImageHintsFile: filepath.Join(fixturesRoot, "testchart.images.yaml"),
+		}, WithLogger(NoLogger))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(HintFindingsError(findings)).To(Succeed())
+	})
+})
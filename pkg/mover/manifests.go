@@ -0,0 +1,304 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"gopkg.in/yaml.v3"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal/yamlops"
+)
+
+// podSpecPaths locates the pod spec of each supported workload kind
+var podSpecPaths = map[string][]string{
+	"Pod":         {"spec"},
+	"Deployment":  {"spec", "template", "spec"},
+	"ReplicaSet":  {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"Job":         {"spec", "template", "spec"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// containerFields lists the pod spec fields holding containers
+var containerFields = []string{"initContainers", "containers", "ephemeralContainers"}
+
+// ManifestsMoveRequest defines the relocation of the images used in plain
+// Kubernetes manifests, which are rewritten in place
+type ManifestsMoveRequest struct {
+	// Files are multi-document YAML manifests
+	Files                []string
+	Rules                RewriteRules
+	SourceContainersAuth *ContainersAuth
+	TargetContainersAuth *ContainersAuth
+}
+
+// ManifestsMover represents the relocation of the images in Kubernetes
+// manifests. Its initialization must be done via NewManifestsMover
+type ManifestsMover struct {
+	files        []*manifestFile
+	imageChanges []*internal.ImageChange
+	// mover holds the registries and options, shared with chart moves
+	mover *ChartMover
+}
+
+type manifestFile struct {
+	path   string
+	docs   [][]byte
+	images []*manifestImage
+}
+
+// manifestImage is a container image field found in a manifest document
+type manifestImage struct {
+	doc int
+	// path of the container map, i.e .spec.template.spec.containers[0]
+	path   string
+	change *internal.ImageChange
+}
+
+// NewManifestsMover creates a ManifestsMover to relocate the images of the
+// Pod templates found in the manifest files following the given rules
+func NewManifestsMover(req *ManifestsMoveRequest, opts ...Option) (*ManifestsMover, error) {
+	if req.Rules.empty() {
+		return nil, ErrOCIRewritesMissing
+	}
+	if len(req.Files) == 0 {
+		return nil, errors.New("no manifest files to relocate")
+	}
+	if req.Rules.TagStrategy == TagStrategyChartVersion {
+		return nil, fmt.Errorf("the %s tag strategy can't be used with manifests, they have no chart version", TagStrategyChartVersion)
+	}
+
+	cm := &ChartMover{logger: defaultLogger{}, retries: DefaultRetries}
+	var err error
+	if cm.sourceContainerRegistry, err = newContainerRegistryClient(req.SourceContainersAuth); err != nil {
+		return nil, err
+	}
+	if cm.targetContainerRegistry, err = newContainerRegistryClient(req.TargetContainersAuth); err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(cm)
+		}
+	}
+	mm := &ManifestsMover{mover: cm}
+
+	for _, path := range req.Files {
+		file, err := loadManifestFile(path)
+		if err != nil {
+			return nil, err
+		}
+		mm.files = append(mm.files, file)
+	}
+
+	cm.logger.Println("Computing relocation...\n")
+	if err := mm.computeChanges(&req.Rules); err != nil {
+		return nil, err
+	}
+	return mm, nil
+}
+
+// loadManifestFile reads the manifest documents and finds their container images
+func loadManifestFile(path string) (*manifestFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest file: %w", err)
+	}
+
+	file := &manifestFile{path: path, docs: yamlops.SplitDocuments(data)}
+	for i, doc := range file.docs {
+		obj := map[string]interface{}{}
+		if err := yaml.Unmarshal(doc, &obj); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest %s document #%d: %w", path, i+1, err)
+		}
+		for _, container := range containerImages(obj, "") {
+			ref, err := name.ParseReference(container.image)
+			if err != nil {
+				return nil, fmt.Errorf("invalid image %q at %s in manifest %s document #%d: %w",
+					container.image, container.path, path, i+1, err)
+			}
+			file.images = append(file.images, &manifestImage{
+				doc:    i,
+				path:   container.path,
+				change: &internal.ImageChange{ImageReference: ref},
+			})
+		}
+	}
+	return file, nil
+}
+
+type containerImage struct {
+	// path of the container map
+	path  string
+	image string
+}
+
+// containerImages returns the images of the object containers, in document
+// order. List items are searched too
+func containerImages(obj map[string]interface{}, path string) []containerImage {
+	images := []containerImage{}
+	kind, _ := obj["kind"].(string)
+	if kind == "List" {
+		items, _ := obj["items"].([]interface{})
+		for i, item := range items {
+			if itemObj, ok := item.(map[string]interface{}); ok {
+				images = append(images, containerImages(itemObj, fmt.Sprintf("%s.items[%d]", path, i))...)
+			}
+		}
+		return images
+	}
+
+	keys, ok := podSpecPaths[kind]
+	if !ok {
+		return images
+	}
+	spec := obj
+	specPath := path
+	for _, key := range keys {
+		if spec, ok = spec[key].(map[string]interface{}); !ok {
+			return images
+		}
+		specPath += "." + key
+	}
+
+	for _, field := range containerFields {
+		containers, _ := spec[field].([]interface{})
+		for i, container := range containers {
+			containerMap, ok := container.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if image, ok := containerMap["image"].(string); ok && image != "" {
+				images = append(images, containerImage{path: fmt.Sprintf("%s.%s[%d]", specPath, field, i), image: image})
+			}
+		}
+	}
+	return images
+}
+
+// computeChanges pulls each original image once and works out where it is
+// pushed to, checking for collisions and the target registry as chart moves do
+func (mm *ManifestsMover) computeChanges(rules *RewriteRules) error {
+	cm := mm.mover
+	pulled := map[string]*internal.ImageChange{}
+	checked := map[string]bool{}
+
+	for _, file := range mm.files {
+		for _, image := range file.images {
+			change := image.change
+			original := change.ImageReference
+			if pulled[original.Name()] == nil {
+				img, digest, err := cm.sourceContainerRegistry.Pull(original)
+				if err != nil {
+					return fmt.Errorf("failed to pull original images: %w", err)
+				}
+				change.Image = img
+				change.Digest = digest
+				pulled[original.Name()] = change
+			} else {
+				change.Image = pulled[original.Name()].Image
+				change.Digest = pulled[original.Name()].Digest
+			}
+
+			location, rule, err := rules.location(original, "")
+			if err != nil {
+				return err
+			}
+			change.Rule = rule
+			change.Tag = location.Tag
+
+			rewritten, err := internal.RelocateReference(original.Context(), change.Digest, location)
+			if err != nil {
+				return err
+			}
+			change.RewrittenReference = rewritten
+			mm.imageChanges = append(mm.imageChanges, change)
+		}
+	}
+
+	if err := detectCollisions(mm.imageChanges); err != nil {
+		return err
+	}
+
+	for _, change := range mm.imageChanges {
+		if !change.ShouldPush() {
+			continue
+		}
+		if checked[change.RewrittenReference.Name()] {
+			change.AlreadyPushed = true
+			continue
+		}
+		if !rules.ForcePush {
+			needToPush, err := cm.targetContainerRegistry.Check(change.Digest, change.RewrittenReference)
+			if err != nil {
+				return fmt.Errorf("failed check, use forcePush option to override :%w", err)
+			}
+			change.AlreadyPushed = !needToPush
+		}
+		checked[change.RewrittenReference.Name()] = true
+	}
+	return nil
+}
+
+// Print shows the image copies and the rewrites to be applied to each manifest
+func (mm *ManifestsMover) Print() {
+	log := mm.mover.logger
+	mm.mover.printImageCopies(mm.imageChanges)
+	for _, file := range mm.files {
+		if len(file.images) == 0 {
+			continue
+		}
+		log.Printf("\nChanges to be applied to %s:\n", file.path)
+		for _, image := range file.images {
+			log.Printf("  document #%d %s.image: %s\n", image.doc+1, image.path, referenceName(image.change.RewrittenReference))
+		}
+	}
+	log.Println()
+}
+
+// Move pushes the images to their new location and rewrites the manifests
+// in place, preserving their formatting and comments
+func (mm *ManifestsMover) Move() error {
+	if err := mm.mover.pushRewrittenImages(mm.imageChanges); err != nil {
+		return err
+	}
+
+	for _, file := range mm.files {
+		if len(file.images) == 0 {
+			continue
+		}
+		if err := file.rewrite(); err != nil {
+			return err
+		}
+		mm.mover.logger.Println("Done moving", file.path)
+	}
+	return nil
+}
+
+// rewrite updates the image fields of the manifest and saves it
+func (file *manifestFile) rewrite() error {
+	for _, image := range file.images {
+		value := map[string]string{"image": referenceName(image.change.RewrittenReference)}
+		doc, err := yamlops.UpdateMap(file.docs[image.doc], image.path, "", nil, value)
+		if err != nil {
+			return fmt.Errorf("failed to rewrite %s in manifest %s: %w", image.path, file.path, err)
+		}
+		file.docs[image.doc] = doc
+	}
+
+	info, err := os.Stat(file.path)
+	if err != nil {
+		return fmt.Errorf("failed to save manifest %s: %w", file.path, err)
+	}
+	if err := os.WriteFile(file.path, yamlops.JoinDocuments(file.docs), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to save manifest %s: %w", file.path, err)
+	}
+	return nil
+}
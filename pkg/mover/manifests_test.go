@@ -0,0 +1,87 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal/internalfakes"
+)
+
+var _ = Describe("ManifestsMover", func() {
+	const digest = "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+
+	var (
+		fakeRegistry *internalfakes.FakeContainerRegistryInterface
+		dir          string
+		manifestPath string
+	)
+
+	BeforeEach(func() {
+		fakeRegistry = &internalfakes.FakeContainerRegistryInterface{}
+		fakeRegistry.PullReturns(makeImage(digest), digest, nil)
+		fakeRegistry.CheckReturns(true, nil)
+
+		data, err := os.ReadFile(filepath.Join(fixturesRoot, "manifests", "workloads.yaml"))
+		Expect(err).ToNot(HaveOccurred())
+		dir, err = os.MkdirTemp("", "manifests-test-*")
+		Expect(err).ToNot(HaveOccurred())
+		manifestPath = filepath.Join(dir, "workloads.yaml")
+		Expect(os.WriteFile(manifestPath, data, 0644)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	newTestManifestsMover := func() *ManifestsMover {
+		file, err := loadManifestFile(manifestPath)
+		Expect(err).ToNot(HaveOccurred())
+		mm := &ManifestsMover{
+			files: []*manifestFile{file},
+			mover: testChartMover(fakeRegistry, NoLogger),
+		}
+		Expect(mm.computeChanges(&RewriteRules{Registry: "harbor-repo.vmware.com", RepositoryPrefix: "pwall"})).To(Succeed())
+		return mm
+	}
+
+	It("finds the images of the pod templates", func() {
+		mm := newTestManifestsMover()
+		paths := []string{}
+		for _, image := range mm.files[0].images {
+			paths = append(paths, image.path)
+		}
+		Expect(paths).To(Equal([]string{
+			".spec.template.spec.initContainers[0]",
+			".spec.template.spec.containers[0]",
+			".spec.jobTemplate.spec.template.spec.containers[0]",
+		}))
+
+		By("pulling and checking each image once", func() {
+			Expect(fakeRegistry.PullCallCount()).To(Equal(2))
+			Expect(fakeRegistry.CheckCallCount()).To(Equal(2))
+			Expect(mm.imageChanges[2].AlreadyPushed).To(BeTrue())
+		})
+	})
+
+	It("rewrites the manifests in place preserving their contents", func() {
+		mm := newTestManifestsMover()
+		Expect(mm.Move()).To(Succeed())
+		Expect(fakeRegistry.PushCallCount()).To(Equal(2))
+		_, pushed := fakeRegistry.PushArgsForCall(0)
+		Expect(pushed.Name()).To(Equal("harbor-repo.vmware.com/pwall/busybox:1.36"))
+
+		data, err := os.ReadFile(manifestPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("image: harbor-repo.vmware.com/pwall/busybox@" + digest + " # wait for the database\n"))
+		Expect(string(data)).To(ContainSubstring("image: harbor-repo.vmware.com/pwall/nginx@" + digest + "\n"))
+		Expect(string(data)).To(ContainSubstring("          ports:\n"))
+		Expect(string(data)).To(ContainSubstring("  image: not-an-image:1.0\n"))
+		Expect(string(data)).To(HavePrefix("# Sample workloads relocated by relok8s manifests move\n"))
+	})
+})
@@ -0,0 +1,164 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"gopkg.in/yaml.v2"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+)
+
+// MappingRule moves the images whose source repository, i.e
+// docker.io/bitnami/wordpress, matches it to the Target repository. Match is
+// a glob whose * matches any characters, slashes included, and fills the *
+// of the Target in order. Regex is a regular expression on the whole source
+// repository whose capture groups fill the $1 or ${name} of the Target
+type MappingRule struct {
+	Match  string `yaml:"match,omitempty"`
+	Regex  string `yaml:"regex,omitempty"`
+	Target string `yaml:"target"`
+
+	regex    *regexp.Regexp
+	template string
+}
+
+// RulesFile is the document of a rules file, its rules evaluated in order
+type RulesFile struct {
+	Rules []*MappingRule `yaml:"rules"`
+}
+
+// LoadRulesFile reads the mapping rules of the rules file
+func LoadRulesFile(filename string) ([]*MappingRule, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the rules file: %w", err)
+	}
+	doc := &RulesFile{}
+	if err := yaml.UnmarshalStrict(data, doc); err != nil {
+		return nil, fmt.Errorf("rules file %s is not in the correct format: %w", filename, err)
+	}
+	if len(doc.Rules) == 0 {
+		return nil, fmt.Errorf("rules file %s has no rules", filename)
+	}
+	for i, rule := range doc.Rules {
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("rules file %s: rule #%d: %w", filename, i+1, err)
+		}
+	}
+	return doc.Rules, nil
+}
+
+func (r *MappingRule) String() string {
+	source := r.Match
+	if r.Regex != "" {
+		source = r.Regex
+	}
+	return fmt.Sprintf("%s => %s", source, r.Target)
+}
+
+// compile builds the regular expression and the target template of the rule
+func (r *MappingRule) compile() error {
+	switch {
+	case r.Match != "" && r.Regex != "":
+		return errors.New("match and regex cannot be combined")
+	case r.Target == "":
+		return errors.New("a target is required")
+	case r.Regex != "":
+		regex, err := regexp.Compile("^(?:" + r.Regex + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+		r.regex = regex
+		r.template = r.Target
+	case r.Match != "":
+		parts := strings.Split(r.Match, "*")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		r.regex = regexp.MustCompile("^" + strings.Join(parts, "(.*)") + "$")
+
+		targetParts := strings.Split(r.Target, "*")
+		if len(targetParts) > len(parts) {
+			return fmt.Errorf("target %s has more * than match %s", r.Target, r.Match)
+		}
+		r.template = strings.ReplaceAll(targetParts[0], "$", "$$")
+		for i, part := range targetParts[1:] {
+			r.template += fmt.Sprintf("${%d}", i+1) + strings.ReplaceAll(part, "$", "$$")
+		}
+	default:
+		return errors.New("either match or regex is required")
+	}
+	return nil
+}
+
+// apply returns the target repository of the source repository, if it matches
+func (r *MappingRule) apply(source string) (string, bool) {
+	if r.regex == nil {
+		if err := r.compile(); err != nil {
+			return "", false
+		}
+	}
+	match := r.regex.FindStringSubmatchIndex(source)
+	if match == nil {
+		return "", false
+	}
+	return string(r.regex.ExpandString(nil, r.template, source, match)), true
+}
+
+// sourceRepository is the repository of the image that rules match, with
+// Docker Hub images named docker.io/ as they are usually written
+func sourceRepository(image name.Reference) string {
+	repository := image.Context()
+	registry := repository.RegistryStr()
+	if registry == name.DefaultRegistry {
+		registry = "docker.io"
+	}
+	return registry + "/" + repository.RepositoryStr()
+}
+
+// location returns where the image is moved to, described along if chosen by
+// a mapping rule, with the tag it is pushed under and how it is referenced
+func (r *RewriteRules) location(image name.Reference, chartVersion string) (*internal.OCIImageLocation, string, error) {
+	location, rule, err := r.repositoryLocation(image)
+	if err != nil {
+		return nil, "", err
+	}
+	location.Tag = r.pushTag(image, chartVersion)
+	location.ReferenceStrategy = r.referenceStrategy()
+	location.Retagged = r.TagStrategy != "" && r.TagStrategy != TagStrategyOriginal
+	return location, rule, nil
+}
+
+// repositoryLocation returns the repository the image is moved to: the target
+// of the first mapping rule it matches, described along, or the registry and
+// repository prefix rules otherwise
+func (r *RewriteRules) repositoryLocation(image name.Reference) (*internal.OCIImageLocation, string, error) {
+	source := sourceRepository(image)
+	for i, rule := range r.Mappings {
+		target, ok := rule.apply(source)
+		if !ok {
+			continue
+		}
+		if _, err := name.NewRepository(target, name.StrictValidation); err != nil {
+			return nil, "", fmt.Errorf("rule #%d %s maps image %s to an invalid repository %q: %w", i+1, rule, image.Name(), target, err)
+		}
+		return &internal.OCIImageLocation{Repository: target}, fmt.Sprintf("rule #%d %s", i+1, rule), nil
+	}
+	if r.Registry == "" && r.RepositoryPrefix == "" {
+		return nil, "", fmt.Errorf("image %s matches no rule", image.Name())
+	}
+	return &internal.OCIImageLocation{
+		Registry:         r.Registry,
+		RepositoryPrefix: r.RepositoryPrefix,
+		PathStrategy:     r.PathStrategy,
+		PathSeparator:    r.PathSeparator,
+	}, "", nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal/internalfakes"
+)
+
+var _ = Describe("Mapping rules", func() {
+	const rulesYAML = `rules:
+- match: docker.io/bitnami/*
+  target: mirror.example.com/bitnami/*
+- regex: quay\.io/(?P<path>.+)
+  target: mirror.example.com/quay/${path}
+- match: "*/library/*"
+  target: mirror.example.com/library/*/*
+`
+	var (
+		dir   string
+		rules *RewriteRules
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "mapping-rules-test-*")
+		Expect(err).ToNot(HaveOccurred())
+		rulesFile := filepath.Join(dir, "rules.yaml")
+		Expect(os.WriteFile(rulesFile, []byte(rulesYAML), 0644)).To(Succeed())
+
+		mappings, err := LoadRulesFile(rulesFile)
+		Expect(err).ToNot(HaveOccurred())
+		rules = &RewriteRules{Mappings: mappings}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("moves each image to the target of the first rule it matches", func() {
+		location, rule, err := rules.repositoryLocation(name.MustParseReference("bitnami/wordpress:5.8.0"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(location).To(Equal(&internal.OCIImageLocation{Repository: "mirror.example.com/bitnami/wordpress"}))
+		Expect(rule).To(Equal("rule #1 docker.io/bitnami/* => mirror.example.com/bitnami/*"))
+
+		location, rule, err = rules.repositoryLocation(name.MustParseReference("quay.io/prometheus/node-exporter:v1.3.1"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(location.Repository).To(Equal("mirror.example.com/quay/prometheus/node-exporter"))
+		Expect(rule).To(HavePrefix("rule #2 "))
+
+		location, _, err = rules.repositoryLocation(name.MustParseReference("busybox:1.36"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(location.Repository).To(Equal("mirror.example.com/library/docker.io/busybox"))
+	})
+
+	It("falls back to the registry and repository prefix rules", func() {
+		_, _, err := rules.repositoryLocation(name.MustParseReference("gcr.io/distroless/static:nonroot"))
+		Expect(err).To(MatchError("image gcr.io/distroless/static:nonroot matches no rule"))
+
+		rules.Registry = "harbor-repo.vmware.com"
+		location, rule, err := rules.repositoryLocation(name.MustParseReference("gcr.io/distroless/static:nonroot"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(location).To(Equal(&internal.OCIImageLocation{Registry: "harbor-repo.vmware.com"}))
+		Expect(rule).To(BeEmpty())
+	})
+
+	It("rejects invalid rules", func() {
+		invalid := []*MappingRule{
+			{Match: "docker.io/*", Regex: "docker.io/(.*)", Target: "mirror.example.com/*"},
+			{Match: "docker.io/*"},
+			{Regex: "docker.io/(", Target: "mirror.example.com/$1"},
+			{Match: "docker.io/bitnami/*", Target: "mirror.example.com/*/*"},
+		}
+		for _, rule := range invalid {
+			Expect((&RewriteRules{Mappings: []*MappingRule{rule}}).Validate()).ToNot(Succeed(), rule.String())
+		}
+
+		_, _, err := (&RewriteRules{Mappings: []*MappingRule{{Match: "docker.io/*", Target: "mirror.example.com/UPPER/*"}}}).
+			repositoryLocation(name.MustParseReference("bitnami/wordpress"))
+		Expect(err).To(MatchError(ContainSubstring(`maps image index.docker.io/bitnami/wordpress:latest to an invalid repository "mirror.example.com/UPPER/bitnami/wordpress"`)))
+	})
+
+	It("shows the chosen rule of each image in the plan", func() {
+		fakeRegistry := &internalfakes.FakeContainerRegistryInterface{}
+		fakeRegistry.CheckReturns(true, nil)
+		printer := &testPrinter{out: NewBuffer()}
+		cm := testChartMover(fakeRegistry, printer)
+		changes := []*internal.ImageChange{
+			{
+				Pattern:        newPattern("{{.image.registry}}/{{.image.repository}}"),
+				ImageReference: name.MustParseReference("index.docker.io/bitnami/wordpress:1.2.3"),
+				Image:          makeImage("sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"),
+				Digest:         "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+			},
+		}
+
+		newChanges, actions, err := cm.computeChanges(changes, rules)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actions).To(Equal([]*internal.RewriteAction{
+			{Path: ".image.registry", Value: "mirror.example.com"},
+			{Path: ".image.repository", Value: "bitnami/wordpress@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+		}))
+
+		cm.printImageCopies(newChanges)
+		Expect(printer.out).To(Say(`index.docker.io/bitnami/wordpress:1.2.3 => mirror.example.com/bitnami/wordpress@sha256:a+ \(sha256:a+\) \(push required\) \(rule #1 docker.io/bitnami/\* => mirror.example.com/bitnami/\*\)`))
+	})
+})
@@ -0,0 +1,154 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+)
+
+// ErrMultiTargetMoveFailed when the chart failed to be relocated to any of its targets
+var ErrMultiTargetMoveFailed = errors.New("failed to relocate the chart to some targets")
+
+// TargetMoveResult reports the outcome of relocating the chart to one of its targets
+type TargetMoveResult struct {
+	// Target as its position in the request and the registry it moves to
+	Target string
+	// Err is nil if the chart was relocated to the target
+	Err error
+}
+
+// MultiTargetMover relocates a chart to several targets at once, each with its
+// own rules, credentials and output. Images are pulled, and their layers
+// downloaded, once for all the targets and then pushed to each of them. Its
+// initialization must be done via NewMultiTargetMover
+type MultiTargetMover struct {
+	movers []*ChartMover
+	// results, in target order. Targets failing to prepare already have their error
+	results []*TargetMoveResult
+	// settings holds the options common to all the targets, used for the output,
+	// and the source chart they copy, loaded once
+	settings *ChartMover
+}
+
+// NewMultiTargetMover creates a MultiTargetMover for the targets of the move
+// request. The chart, its dependencies and its image hints are loaded once,
+// each target then rewrites its own copy of the chart. Targets failing to
+// compute their relocation are reported in the move results instead of
+// aborting the others.
+func NewMultiTargetMover(req *ChartMoveRequest, opts ...Option) (*MultiTargetMover, error) {
+	if len(req.Targets) == 0 {
+		return nil, errors.New("no targets to relocate the chart to")
+	}
+
+	tm := &MultiTargetMover{settings: &ChartMover{logger: defaultLogger{}, retries: DefaultRetries}}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(tm.settings)
+		}
+	}
+	log := tm.settings.logger
+
+	log.Printf("Loading %s...\n", sourceName(&req.Source))
+	source := tm.settings
+	if err := source.loadChart(&req.Source); err != nil {
+		return nil, err
+	}
+	if err := source.vendorDependencies(&req.Source); err != nil {
+		return nil, err
+	}
+	if err := source.loadImageHints(&req.Source); err != nil {
+		return nil, fmt.Errorf("failed to load hints file: %w", err)
+	}
+
+	cache := newRegistryCache()
+	destinations := map[string]string{}
+	for i, target := range req.Targets {
+		result := &TargetMoveResult{Target: targetName(i, target)}
+		tm.results = append(tm.results, result)
+
+		log.Printf("Preparing %s...\n", result.Target)
+		targetReq := &ChartMoveRequest{Source: req.Source, Target: *target}
+		cm, err := newChartMover(targetReq, source, append(opts, withRegistryCache(cache))...)
+		if err == nil && cm.chartDestination != "" {
+			if previous, ok := destinations[cm.chartDestination]; ok {
+				err = fmt.Errorf("the relocated chart %s is already written by %s", cm.chartDestination, previous)
+			}
+			destinations[cm.chartDestination] = result.Target
+		}
+		if err != nil {
+			result.Err = err
+			tm.movers = append(tm.movers, nil)
+			continue
+		}
+		tm.movers = append(tm.movers, cm)
+	}
+	return tm, nil
+}
+
+// Print shows the changes to be performed for each of the targets
+func (tm *MultiTargetMover) Print() {
+	log := tm.settings.logger
+	for i, cm := range tm.movers {
+		result := tm.results[i]
+		if cm == nil {
+			log.Printf("\nSkipping %s: %s\n", result.Target, result.Err)
+			continue
+		}
+		log.Printf("\nRelocation to %s:\n", result.Target)
+		cm.Print()
+	}
+}
+
+// Move relocates the chart to each of the targets, in order. A target
+// failing to be relocated does not stop the others. It returns the result of
+// each target, and ErrMultiTargetMoveFailed if any of them failed.
+func (tm *MultiTargetMover) Move() ([]*TargetMoveResult, error) {
+	// The image layers downloaded when pushing to the first target are read
+	// from the local cache when pushing to the next ones
+	layersDir, err := os.MkdirTemp("", "relok8s-layers-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the image layers cache: %w", err)
+	}
+	defer os.RemoveAll(layersDir)
+	for _, cm := range tm.movers {
+		if cm == nil {
+			continue
+		}
+		for _, change := range cm.imageChanges {
+			change.Image = internal.NewCachedImage(change.Image, layersDir)
+		}
+	}
+
+	failed := false
+	for i, cm := range tm.movers {
+		result := tm.results[i]
+		if cm != nil {
+			tm.settings.logger.Printf("\nMoving to %s...\n", result.Target)
+			result.Err = cm.Move()
+		}
+		if result.Err != nil {
+			failed = true
+		}
+	}
+
+	if failed {
+		return tm.results, ErrMultiTargetMoveFailed
+	}
+	return tm.results, nil
+}
+
+// targetName describes the target by its position and the registry and
+// repository prefix it moves to, if any
+func targetName(i int, target *Target) string {
+	name := fmt.Sprintf("target #%d", i+1)
+	if location := strings.Trim(target.Rules.Registry+"/"+target.Rules.RepositoryPrefix, "/"); location != "" {
+		name += " " + location
+	}
+	return name
+}
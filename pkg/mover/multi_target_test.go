@@ -0,0 +1,151 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal/internalfakes"
+)
+
+var _ = Describe("MultiTargetMover", func() {
+	const digest = "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+
+	var (
+		fakeRegistry *internalfakes.FakeContainerRegistryInterface
+		outDir       string
+		req          *ChartMoveRequest
+	)
+
+	BeforeEach(func() {
+		fakeRegistry = &internalfakes.FakeContainerRegistryInterface{}
+		fakeRegistry.PullReturns(makeImage(digest), digest, nil)
+		fakeRegistry.CheckReturns(true, nil)
+
+		var err error
+		outDir, err = os.MkdirTemp("", "multi-target-test-*")
+		Expect(err).ToNot(HaveOccurred())
+
+		target := func(registry, out string) *Target {
+			return &Target{
+				Chart: ChartSpec{Local: &LocalChart{Path: filepath.Join(outDir, out)}},
+				Rules: RewriteRules{Registry: registry},
+			}
+		}
+		req = &ChartMoveRequest{
+			Source: Source{
+				Chart:          ChartSpec{Local: &LocalChart{Path: filepath.Join(fixturesRoot, "testchart")}},
+				ImageHintsFile: filepath.Join(fixturesRoot, "testchart.images.yaml"),
+			},
+			Targets: []*Target{
+				target("eu.registry.example.com", "eu-%s-%s.tgz"),
+				target("us.registry.example.com", "us-%s-%s.tgz"),
+				target("ap.registry.example.com", "eu-%s-%s.tgz"),
+			},
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(outDir)
+	})
+
+	withFakeRegistry := func(cm *ChartMover) {
+		cm.sourceContainerRegistry = fakeRegistry
+		cm.targetContainerRegistry = fakeRegistry
+	}
+
+	It("pulls the images once and relocates the chart to every target", func() {
+		tm, err := NewMultiTargetMover(req, withFakeRegistry, WithLogger(NoLogger))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fakeRegistry.PullCallCount()).To(Equal(2))
+
+		results, err := tm.Move()
+		Expect(err).To(MatchError(ErrMultiTargetMoveFailed))
+		Expect(results[0].Err).ToNot(HaveOccurred())
+		Expect(results[1].Err).ToNot(HaveOccurred())
+		Expect(results[2].Target).To(Equal("target #3 ap.registry.example.com"))
+		Expect(results[2].Err).To(MatchError(ContainSubstring("is already written by target #1 eu.registry.example.com")))
+
+		Expect(fakeRegistry.PushCallCount()).To(Equal(6))
+		registries := map[string]int{}
+		for i := 0; i < fakeRegistry.PushCallCount(); i++ {
+			_, ref := fakeRegistry.PushArgsForCall(i)
+			registries[ref.Context().RegistryStr()]++
+		}
+		Expect(registries).To(Equal(map[string]int{"eu.registry.example.com": 3, "us.registry.example.com": 3}))
+		Expect(filepath.Join(outDir, "eu-testchart-0.1.0.tgz")).To(BeAnExistingFile())
+		Expect(filepath.Join(outDir, "us-testchart-0.1.0.tgz")).To(BeAnExistingFile())
+	})
+
+	It("keeps relocating to the other targets when one of them fails", func() {
+		req.Targets = req.Targets[:2]
+		fakeRegistry.PushStub = func(_ v1.Image, ref name.Reference) error {
+			if ref.Context().RegistryStr() == "eu.registry.example.com" {
+				return errors.New("push failed")
+			}
+			return nil
+		}
+		tm, err := NewMultiTargetMover(req, withFakeRegistry, WithLogger(NoLogger))
+		Expect(err).ToNot(HaveOccurred())
+
+		results, err := tm.Move()
+		Expect(err).To(MatchError(ErrMultiTargetMoveFailed))
+		Expect(results[0].Err).To(MatchError(ContainSubstring("push failed")))
+		Expect(results[1].Err).ToNot(HaveOccurred())
+		Expect(filepath.Join(outDir, "eu-testchart-0.1.0.tgz")).ToNot(BeAnExistingFile())
+		Expect(filepath.Join(outDir, "us-testchart-0.1.0.tgz")).To(BeAnExistingFile())
+	})
+
+	It("loads the chart and fetches its dependencies once for all the targets", func() {
+		repoDir, err := os.MkdirTemp("", "multi-target-repo-*")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(repoDir)
+		server := newTestRepository(repoDir, filepath.Join(fixturesRoot, "3-levels-chart", "charts", "subchart-2"), "0.1.0")
+		defer server.Close()
+		var downloads int32
+		files := server.Config.Handler
+		server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, ".tgz") {
+				atomic.AddInt32(&downloads, 1)
+			}
+			files.ServeHTTP(w, r)
+		})
+
+		chartDir := filepath.Join(outDir, "parent")
+		Expect(os.MkdirAll(chartDir, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte(
+			"apiVersion: v2\nname: parent\nversion: 1.0.0\ndependencies:\n- name: subchart-2\n  version: 0.1.0\n  repository: "+server.URL+"\n",
+		), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(chartDir, "values.yaml"), []byte("image:\n  repository: docker.io/library/nginx\n  tag: \"1.21\"\n"), 0644)).To(Succeed())
+		hintsFile := filepath.Join(outDir, "parent.images.yaml")
+		Expect(os.WriteFile(hintsFile, []byte(`- "{{ .image.repository }}:{{ .image.tag }}"`), 0644)).To(Succeed())
+		req.Source = Source{Chart: ChartSpec{Local: &LocalChart{Path: chartDir}}, ImageHintsFile: hintsFile}
+		req.Targets = req.Targets[:2]
+
+		tm, err := NewMultiTargetMover(req, withFakeRegistry, WithLogger(NoLogger))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(atomic.LoadInt32(&downloads)).To(Equal(int32(1)))
+		Expect(tm.movers[0].chart).ToNot(BeIdenticalTo(tm.movers[1].chart))
+		for _, cm := range tm.movers {
+			Expect(cm.chart.Dependencies()).To(HaveLen(1))
+		}
+
+		results, err := tm.Move()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(results).To(HaveLen(2))
+		Expect(filepath.Join(outDir, "eu-parent-1.0.0.tgz")).To(BeAnExistingFile())
+		Expect(filepath.Join(outDir, "us-parent-1.0.0.tgz")).To(BeAnExistingFile())
+		Expect(atomic.LoadInt32(&downloads)).To(Equal(int32(1)))
+	})
+})
@@ -0,0 +1,192 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
+	"github.com/google/go-containerregistry/pkg/name"
+	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+// helmRegistryConfigEnv overrides the default location of Helm's registry
+// credentials file, same as in the Helm CLI
+const helmRegistryConfigEnv = "HELM_REGISTRY_CONFIG"
+
+// ErrOCIChartTargetMissing indicates that the chart cannot be pushed as no
+// target registry nor OCI reference was provided
+var ErrOCIChartTargetMissing = errors.New("a registry rule or a target OCI reference is required to push the chart")
+
+// IsOCIChart returns true if the given chart reference uses the oci:// scheme,
+// i.e oci://registry.example.com/charts/mariadb:11.0.4
+func IsOCIChart(ref string) bool {
+	return registry.IsOCI(ref)
+}
+
+// loadChartFromOCI pulls the chart from an OCI registry into a temporary
+// tarball and loads it from there
+func (cm *ChartMover) loadChartFromOCI(ref string, auth *ContainersAuth) error {
+	data, err := pullOCIChart(ref, auth)
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "oci-chart-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory to download chart %s: %w", ref, err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	chartPath := filepath.Join(tmpDir, "chart.tgz")
+	if err := os.WriteFile(chartPath, data, defaultPerm); err != nil {
+		return fmt.Errorf("failed to save chart %s: %w", ref, err)
+	}
+
+	return cm.loadChartFromPath(chartPath)
+}
+
+// pushOCIChart uploads the chart tarball contents to the given OCI reference
+// using the Helm registry client. It returns the digest of the pushed chart.
+func pushOCIChart(data []byte, ref string, auth *ContainersAuth) (string, error) {
+	ociRef := strings.TrimPrefix(ref, fmt.Sprintf("%s://", registry.OCIScheme))
+
+	client, cleanup, err := newHelmRegistryClient(ociRef, auth)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	result, err := client.Push(data, ociRef)
+	if err != nil {
+		return "", fmt.Errorf("failed to push chart %s: %w", ref, err)
+	}
+	return result.Manifest.Digest, nil
+}
+
+// targetOCIChartRef returns the oci:// reference the chart will be pushed to.
+// As in helm push, the target reference is the base repository path where the
+// chart is placed as name:version. If no reference is given, the base is
+// computed from the target registry and repository prefix rules.
+func targetOCIChartRef(target *OCIChart, rules *RewriteRules, chartName, chartVersion string) (string, error) {
+	base, err := targetOCIChartBase(target, rules)
+	if err != nil {
+		return "", err
+	}
+	return ociChartRef(base, chartName, chartVersion), nil
+}
+
+// targetOCIChartBase returns the oci:// base repository path charts are pushed to
+func targetOCIChartBase(target *OCIChart, rules *RewriteRules) (string, error) {
+	base := strings.TrimPrefix(target.Reference, fmt.Sprintf("%s://", registry.OCIScheme))
+	if target.Reference == "" {
+		if rules.Registry == "" {
+			return "", ErrOCIChartTargetMissing
+		}
+		base = path.Join(rules.Registry, rules.RepositoryPrefix)
+	} else if !IsOCIChart(target.Reference) {
+		return "", fmt.Errorf("target chart reference %q is missing the oci:// scheme", target.Reference)
+	}
+	return fmt.Sprintf("%s://%s", registry.OCIScheme, strings.TrimSuffix(base, "/")), nil
+}
+
+// ociChartRef places the chart name and version under the oci:// base path
+func ociChartRef(base, chartName, chartVersion string) string {
+	return fmt.Sprintf("%s/%s:%s", base, chartName, chartVersion)
+}
+
+// pullOCIChart downloads the chart tarball contents using the Helm registry client
+func pullOCIChart(ref string, auth *ContainersAuth) ([]byte, error) {
+	if !IsOCIChart(ref) {
+		return nil, fmt.Errorf("chart reference %q is missing the oci:// scheme", ref)
+	}
+	ociRef := strings.TrimPrefix(ref, fmt.Sprintf("%s://", registry.OCIScheme))
+
+	client, cleanup, err := newHelmRegistryClient(ociRef, auth)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	result, err := client.Pull(ociRef, registry.PullOptWithChart(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull chart %s: %w", ref, err)
+	}
+	return result.Chart.Data, nil
+}
+
+// newHelmRegistryClient returns a Helm registry client able to reach the
+// registry of the given reference.
+//
+// Explicit credentials are handed over to the client as a temporary
+// credentials file, otherwise Helm's registry config is used which, in turn,
+// falls back to the local docker config.
+// The returned cleanup function must be called once the client is not needed.
+func newHelmRegistryClient(ociRef string, auth *ContainersAuth) (*registry.Client, func(), error) {
+	cleanup := func() {}
+	// Only the registry is parsed here, chart versions might not be valid tags
+	// until the Helm client converts them
+	host := strings.SplitN(ociRef, "/", 2)[0]
+	reg, err := name.NewRegistry(host)
+	if err != nil {
+		return nil, cleanup, fmt.Errorf("invalid OCI chart reference %q: %w", ociRef, err)
+	}
+
+	credentialsFile := helmRegistryConfig()
+	if auth != nil && auth.Credentials != nil {
+		tmpDir, err := os.MkdirTemp("", "helm-registry-config-*")
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("failed to create temporary registry config: %w", err)
+		}
+		cleanup = func() { os.RemoveAll(tmpDir) }
+		credentialsFile = filepath.Join(tmpDir, registry.CredentialsFileBasename)
+		if err := writeRegistryConfig(credentialsFile, auth.Credentials); err != nil {
+			cleanup()
+			return nil, func() {}, err
+		}
+	}
+
+	opts := []registry.ClientOption{registry.ClientOptCredentialsFile(credentialsFile)}
+	// Follow go-containerregistry defaults so that charts and images are
+	// reached the same way, i.e plain HTTP for localhost registries
+	if reg.Scheme() == "http" {
+		opts = append(opts, registry.ClientOptPlainHTTP())
+	}
+
+	client, err := registry.NewClient(opts...)
+	if err != nil {
+		cleanup()
+		return nil, func() {}, fmt.Errorf("failed to create Helm registry client: %w", err)
+	}
+	return client, cleanup, nil
+}
+
+// helmRegistryConfig returns the path of Helm's registry credentials file
+func helmRegistryConfig() string {
+	if config := os.Getenv(helmRegistryConfigEnv); config != "" {
+		return config
+	}
+	return helmpath.ConfigPath(registry.CredentialsFileBasename)
+}
+
+// writeRegistryConfig saves the credentials in docker config format
+func writeRegistryConfig(filename string, creds *OCICredentials) error {
+	config := configfile.New(filename)
+	config.AuthConfigs[creds.Server] = types.AuthConfig{
+		ServerAddress: creds.Server,
+		Username:      creds.Username,
+		Password:      creds.Password,
+	}
+	if err := config.Save(); err != nil {
+		return fmt.Errorf("failed to write registry config %s: %w", filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	helmregistry "helm.sh/helm/v3/pkg/registry"
+)
+
+// pushTestChart packages the chart at chartPath and pushes it to the given
+// registry host, returning its oci:// reference
+func pushTestChart(host, chartPath string) string {
+	testChart, err := loader.Load(chartPath)
+	Expect(err).ToNot(HaveOccurred())
+
+	tmpDir, err := os.MkdirTemp("", "oci-chart-test-*")
+	Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	tgz, err := chartutil.Save(testChart, tmpDir)
+	Expect(err).ToNot(HaveOccurred())
+	data, err := os.ReadFile(tgz)
+	Expect(err).ToNot(HaveOccurred())
+
+	ref := host + "/charts/" + testChart.Name() + ":" + testChart.Metadata.Version
+	client, cleanup, err := newHelmRegistryClient(ref, nil)
+	Expect(err).ToNot(HaveOccurred())
+	defer cleanup()
+	_, err = client.Push(data, ref)
+	Expect(err).ToNot(HaveOccurred())
+
+	return "oci://" + ref
+}
+
+var _ = Describe("OCI charts", func() {
+	var (
+		server *httptest.Server
+		host   string
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+		u, err := url.Parse(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+		host = u.Host
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("IsOCIChart", func() {
+		It("detects the oci:// scheme", func() {
+			Expect(IsOCIChart("oci://registry.example.com/charts/mariadb:1.2.3")).To(BeTrue())
+			Expect(IsOCIChart("registry.example.com/charts/mariadb:1.2.3")).To(BeFalse())
+			Expect(IsOCIChart(filepath.Join(fixturesRoot, "testchart"))).To(BeFalse())
+		})
+	})
+
+	Describe("loadChart", func() {
+		It("pulls the chart from the registry", func() {
+			ref := pushTestChart(host, filepath.Join(fixturesRoot, "self-relok8ing-chart"))
+
+			cm := &ChartMover{}
+			err := cm.loadChart(&Source{Chart: ChartSpec{OCI: &OCIChart{Reference: ref}}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cm.chart.Name()).To(Equal("testchart"))
+
+			By("keeping the embedded hints file", func() {
+				hints, err := loadImageHintsFromChart(cm.chart, NoLogger)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hints).ToNot(BeEmpty())
+			})
+		})
+
+		It("uses the given credentials", func() {
+			ref := pushTestChart(host, filepath.Join(fixturesRoot, "testchart"))
+
+			// The same registry, rejecting anonymous requests
+			authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+					w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				server.Config.Handler.ServeHTTP(w, r)
+			}))
+			defer authServer.Close()
+			authURL, err := url.Parse(authServer.URL)
+			Expect(err).ToNot(HaveOccurred())
+			authRef := strings.Replace(ref, host, authURL.Host, 1)
+
+			cm := &ChartMover{}
+			err = cm.loadChart(&Source{Chart: ChartSpec{OCI: &OCIChart{Reference: authRef}}})
+			Expect(err).To(MatchError(ContainSubstring("failed to pull chart")))
+
+			err = cm.loadChart(&Source{
+				Chart: ChartSpec{OCI: &OCIChart{Reference: authRef}},
+				ContainersAuth: &ContainersAuth{
+					Credentials: &OCICredentials{Server: authURL.Host, Username: "user", Password: "wrong"},
+				},
+			})
+			Expect(err).To(MatchError(ContainSubstring("failed to pull chart")))
+
+			err = cm.loadChart(&Source{
+				Chart: ChartSpec{OCI: &OCIChart{Reference: authRef}},
+				ContainersAuth: &ContainersAuth{
+					Credentials: &OCICredentials{Server: authURL.Host, Username: "user", Password: "pass"},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cm.chart.Name()).To(Equal("testchart"))
+		})
+
+		It("fails if the chart does not exist", func() {
+			cm := &ChartMover{}
+			err := cm.loadChart(&Source{Chart: ChartSpec{OCI: &OCIChart{Reference: "oci://" + host + "/charts/missing:1.0.0"}}})
+			Expect(err).To(MatchError(ContainSubstring("failed to pull chart")))
+		})
+	})
+
+	Describe("pushing the relocated chart", func() {
+		It("pushes the chart to the target reference", func() {
+			testChart, err := loader.Load(filepath.Join(fixturesRoot, "testchart"))
+			Expect(err).ToNot(HaveOccurred())
+
+			logger := &FakeLogger{Output: NewBuffer()}
+			ref, err := targetOCIChartRef(&OCIChart{}, &RewriteRules{Registry: host, RepositoryPrefix: "relocated"},
+				testChart.Name(), testChart.Metadata.Version)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ref).To(Equal("oci://" + host + "/relocated/testchart:0.1.0"))
+
+			cm := &ChartMover{
+				chart:          testChart,
+				logger:         logger,
+				retries:        testRetries,
+				targetOCIChart: ref,
+				chartChanges: []*internal.RewriteAction{
+					{Path: ".image.repository", Value: "relocated/nginx"},
+				},
+			}
+			Expect(cm.moveChart()).To(Succeed())
+			Expect(logger.Output).To(Say(`Done moving oci://%s/relocated/testchart:0.1.0 \(sha256:[a-f0-9]{64}\)`, host))
+
+			By("pulling back the relocated chart", func() {
+				pulled := &ChartMover{}
+				err := pulled.loadChart(&Source{Chart: ChartSpec{OCI: &OCIChart{Reference: ref}}})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(pulled.chart.Values["image"]).To(HaveKeyWithValue("repository", "relocated/nginx"))
+			})
+		})
+	})
+
+	Describe("targetOCIChartRef", func() {
+		It("places the chart in the target registry and repository prefix", func() {
+			ref, err := targetOCIChartRef(&OCIChart{}, &RewriteRules{Registry: "myregistry.io", RepositoryPrefix: "/myteam"}, "mariadb", "1.2.3")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ref).To(Equal("oci://myregistry.io/myteam/mariadb:1.2.3"))
+		})
+		It("places the chart under an explicit reference", func() {
+			ref, err := targetOCIChartRef(&OCIChart{Reference: "oci://myregistry.io/charts/"}, &RewriteRules{RepositoryPrefix: "myteam"}, "mariadb", "1.2.3")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ref).To(Equal("oci://myregistry.io/charts/mariadb:1.2.3"))
+		})
+		It("requires a target registry", func() {
+			_, err := targetOCIChartRef(&OCIChart{}, &RewriteRules{RepositoryPrefix: "myteam"}, "mariadb", "1.2.3")
+			Expect(err).To(MatchError(ErrOCIChartTargetMissing))
+		})
+	})
+
+	Describe("writeRegistryConfig", func() {
+		It("saves the credentials in docker config format", func() {
+			tmpDir, err := os.MkdirTemp("", "registry-config-*")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpDir)
+
+			filename := filepath.Join(tmpDir, helmregistry.CredentialsFileBasename)
+			err = writeRegistryConfig(filename, &OCICredentials{Server: "myregistry.io", Username: "user", Password: "pass"})
+			Expect(err).ToNot(HaveOccurred())
+
+			contents, err := os.ReadFile(filename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring(`"myregistry.io"`))
+			Expect(string(contents)).To(ContainSubstring(`"auth": "dXNlcjpwYXNz"`))
+		})
+	})
+})
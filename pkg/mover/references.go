@@ -0,0 +1,48 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// referenceTag returns the tag of a reference by tag and digest, that
+// name.Digest drops from its name, or an empty string
+func referenceTag(ref name.Reference) string {
+	digest, ok := ref.(name.Digest)
+	if !ok {
+		return ""
+	}
+	base := strings.TrimSuffix(digest.String(), "@"+digest.DigestStr())
+	if !strings.Contains(base[strings.LastIndex(base, "/")+1:], ":") {
+		return ""
+	}
+	tag, err := name.NewTag(base)
+	if err != nil {
+		return ""
+	}
+	return tag.TagStr()
+}
+
+// referenceName returns the full name of the reference, keeping the tag of
+// references by tag and digest
+func referenceName(ref name.Reference) string {
+	if tag := referenceTag(ref); tag != "" {
+		return fmt.Sprintf("%s:%s@%s", ref.Context().Name(), tag, ref.Identifier())
+	}
+	return ref.Name()
+}
+
+// contains tells if the value is one of the values
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,228 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+const (
+	// repositoryName is the local name given to the source chart repository
+	repositoryName = "relok8s-source"
+
+	indexFilename = "index.yaml"
+
+	chartMuseumUploadPath = "/api/charts"
+)
+
+// chartMuseumClient uploads charts to ChartMuseum, its timeout bounds each
+// upload attempt
+var chartMuseumClient = &http.Client{Timeout: 5 * time.Minute}
+
+// httpGetters are the getters used to download indexes and charts from Helm HTTP repositories
+var httpGetters = getter.Providers{
+	{Schemes: []string{"http", "https"}, New: getter.NewHTTPGetter},
+}
+
+// loadChartFromRepository downloads the chart from a Helm HTTP repository
+// into a temporary directory and loads it from there
+func (cm *ChartMover) loadChartFromRepository(rc *RepositoryChart) error {
+	tmpDir, err := os.MkdirTemp("", "repo-chart-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory to download chart %s: %w", rc.Name, err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	chartPath, err := downloadRepositoryChart(rc, tmpDir)
+	if err != nil {
+		return err
+	}
+
+	return cm.loadChartFromPath(chartPath)
+}
+
+// downloadRepositoryChart resolves the chart version from the repository
+// index, downloads its tarball into dir and verifies its digest.
+// It returns the path of the downloaded tarball.
+func downloadRepositoryChart(rc *RepositoryChart, dir string) (string, error) {
+	chartVersion, err := findRepositoryChart(rc, dir)
+	if err != nil {
+		return "", err
+	}
+	if len(chartVersion.URLs) == 0 {
+		return "", fmt.Errorf("chart %s-%s has no downloadable URLs in %s", rc.Name, chartVersion.Version, rc.URL)
+	}
+
+	chartURL, err := repo.ResolveReferenceURL(rc.URL, chartVersion.URLs[0])
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve chart %s-%s URL: %w", rc.Name, chartVersion.Version, err)
+	}
+	u, err := url.Parse(chartURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid chart URL %q: %w", chartURL, err)
+	}
+	g, err := httpGetters.ByScheme(u.Scheme)
+	if err != nil {
+		return "", fmt.Errorf("unsupported chart URL %q: %w", chartURL, err)
+	}
+
+	data, err := g.Get(chartURL, getter.WithURL(rc.URL))
+	if err != nil {
+		return "", fmt.Errorf("failed to download chart %s: %w", chartURL, err)
+	}
+
+	if err := verifyChartDigest(data.Bytes(), chartVersion.Digest); err != nil {
+		return "", fmt.Errorf("failed to verify chart %s: %w", chartURL, err)
+	}
+
+	chartPath := filepath.Join(dir, path.Base(u.Path))
+	if err := os.WriteFile(chartPath, data.Bytes(), defaultPerm); err != nil {
+		return "", fmt.Errorf("failed to save chart %s: %w", chartURL, err)
+	}
+	return chartPath, nil
+}
+
+// findRepositoryChart downloads the repository index into dir and returns
+// the latest chart version matching the requested version or constraint
+func findRepositoryChart(rc *RepositoryChart, dir string) (*repo.ChartVersion, error) {
+	chartRepo, err := repo.NewChartRepository(&repo.Entry{Name: repositoryName, URL: rc.URL}, httpGetters)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chart repository %q: %w", rc.URL, err)
+	}
+	chartRepo.CachePath = dir
+
+	indexFile, err := chartRepo.DownloadIndexFile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to download index of chart repository %s: %w", rc.URL, err)
+	}
+
+	index, err := repo.LoadIndexFile(indexFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index of chart repository %s: %w", rc.URL, err)
+	}
+
+	chartVersion, err := index.Get(rc.Name, rc.Version)
+	if err != nil {
+		return nil, fmt.Errorf("chart %s version %q not found in %s: %w", rc.Name, rc.Version, rc.URL, err)
+	}
+	return chartVersion, nil
+}
+
+// verifyChartDigest checks the data sha256 sum matches the digest, if
+// the repository index provides one
+func verifyChartDigest(data []byte, digest string) error {
+	if digest == "" {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	if got, want := hex.EncodeToString(sum[:]), strings.TrimPrefix(digest, "sha256:"); got != want {
+		return fmt.Errorf("digest mismatch, expected %s got %s", want, got)
+	}
+	return nil
+}
+
+// publishToRepositoryDir copies the chart tarball into the repository
+// directory and merges it into the directory index.yaml, creating it if needed.
+// Any previous entry for the same chart version is replaced.
+func publishToRepositoryDir(chartFilename string, md *chart.Metadata, target *RepositoryDir) (string, error) {
+	if err := os.MkdirAll(target.Path, 0755); err != nil {
+		return "", fmt.Errorf("failed to create repository directory %s: %w", target.Path, err)
+	}
+
+	data, err := os.ReadFile(chartFilename)
+	if err != nil {
+		return "", fmt.Errorf("failed to read relocated chart %s: %w", chartFilename, err)
+	}
+	filename := fmt.Sprintf("%s-%s.tgz", md.Name, md.Version)
+	if err := os.WriteFile(filepath.Join(target.Path, filename), data, defaultPerm); err != nil {
+		return "", fmt.Errorf("failed to copy chart into repository directory %s: %w", target.Path, err)
+	}
+
+	indexFile := filepath.Join(target.Path, indexFilename)
+	index := repo.NewIndexFile()
+	if _, err := os.Stat(indexFile); err == nil {
+		if index, err = repo.LoadIndexFile(indexFile); err != nil {
+			return "", fmt.Errorf("failed to load repository index %s: %w", indexFile, err)
+		}
+	}
+	removeIndexEntry(index, md.Name, md.Version)
+
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	if err := index.MustAdd(md, filename, target.URL, digest); err != nil {
+		return "", fmt.Errorf("failed to add chart to repository index: %w", err)
+	}
+	index.SortEntries()
+	index.Generated = time.Now()
+	if err := index.WriteFile(indexFile, defaultPerm); err != nil {
+		return "", fmt.Errorf("failed to write repository index %s: %w", indexFile, err)
+	}
+	return digest, nil
+}
+
+// removeIndexEntry drops the given chart version from the index, if present
+func removeIndexEntry(index *repo.IndexFile, name, version string) {
+	versions := repo.ChartVersions{}
+	for _, cv := range index.Entries[name] {
+		if cv.Version != version {
+			versions = append(versions, cv)
+		}
+	}
+	index.Entries[name] = versions
+}
+
+// chartMuseumResponse is the body returned by the ChartMuseum API
+type chartMuseumResponse struct {
+	Saved bool   `json:"saved"`
+	Error string `json:"error"`
+}
+
+// uploadToChartMuseum uploads the chart tarball using the ChartMuseum API,
+// see https://github.com/helm/chartmuseum#uploading-a-chart-package
+func uploadToChartMuseum(chartFilename string, target *ChartMuseum) error {
+	data, err := os.ReadFile(chartFilename)
+	if err != nil {
+		return fmt.Errorf("failed to read relocated chart %s: %w", chartFilename, err)
+	}
+
+	uploadURL := strings.TrimSuffix(target.URL, "/") + chartMuseumUploadPath
+	req, err := http.NewRequest(http.MethodPost, uploadURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to prepare upload to %s: %w", uploadURL, err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if target.Username != "" || target.Password != "" {
+		req.SetBasicAuth(target.Username, target.Password)
+	}
+
+	resp, err := chartMuseumClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload chart to %s: %w", uploadURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		body := chartMuseumResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error == "" {
+			return fmt.Errorf("failed to upload chart to %s: %s", uploadURL, resp.Status)
+		}
+		return fmt.Errorf("failed to upload chart to %s: %s: %s", uploadURL, resp.Status, body.Error)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// newTestRepository serves a Helm HTTP repository from dir with the given
+// chart packaged at each of the versions
+func newTestRepository(dir, chartPath string, versions ...string) *httptest.Server {
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+
+	index := repo.NewIndexFile()
+	for _, version := range versions {
+		testChart, err := loader.Load(chartPath)
+		Expect(err).ToNot(HaveOccurred())
+		testChart.Metadata.Version = version
+
+		tgz, err := chartutil.Save(testChart, dir)
+		Expect(err).ToNot(HaveOccurred())
+		digest, err := provenance.DigestFile(tgz)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(index.MustAdd(testChart.Metadata, filepath.Base(tgz), server.URL, digest)).To(Succeed())
+	}
+	index.SortEntries()
+	Expect(index.WriteFile(filepath.Join(dir, "index.yaml"), defaultPerm)).To(Succeed())
+
+	return server
+}
+
+var _ = Describe("Repository charts", func() {
+	var (
+		repoDir string
+		server  *httptest.Server
+	)
+
+	BeforeEach(func() {
+		var err error
+		repoDir, err = os.MkdirTemp("", "repo-chart-test-*")
+		Expect(err).ToNot(HaveOccurred())
+		server = newTestRepository(repoDir, filepath.Join(fixturesRoot, "testchart"), "1.0.0", "1.2.0", "2.0.0")
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(repoDir)
+	})
+
+	Describe("loadChart", func() {
+		It("downloads the latest version by default", func() {
+			cm := &ChartMover{}
+			err := cm.loadChart(&Source{Chart: ChartSpec{Repository: &RepositoryChart{URL: server.URL, Name: "testchart"}}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cm.chart.Name()).To(Equal("testchart"))
+			Expect(cm.chart.Metadata.Version).To(Equal("2.0.0"))
+		})
+
+		It("downloads an exact version", func() {
+			cm := &ChartMover{}
+			err := cm.loadChart(&Source{Chart: ChartSpec{Repository: &RepositoryChart{URL: server.URL, Name: "testchart", Version: "1.0.0"}}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cm.chart.Metadata.Version).To(Equal("1.0.0"))
+		})
+
+		It("resolves a semver constraint", func() {
+			cm := &ChartMover{}
+			err := cm.loadChart(&Source{Chart: ChartSpec{Repository: &RepositoryChart{URL: server.URL, Name: "testchart", Version: "1.x"}}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cm.chart.Metadata.Version).To(Equal("1.2.0"))
+		})
+
+		It("fails if the version is not found", func() {
+			cm := &ChartMover{}
+			err := cm.loadChart(&Source{Chart: ChartSpec{Repository: &RepositoryChart{URL: server.URL, Name: "testchart", Version: "3.x"}}})
+			Expect(err).To(MatchError(ContainSubstring(`chart testchart version "3.x" not found`)))
+		})
+
+		It("fails if the chart does not match the index digest", func() {
+			tgz := filepath.Join(repoDir, "testchart-2.0.0.tgz")
+			Expect(os.WriteFile(tgz, []byte("tampered"), defaultPerm)).To(Succeed())
+
+			cm := &ChartMover{}
+			err := cm.loadChart(&Source{Chart: ChartSpec{Repository: &RepositoryChart{URL: server.URL, Name: "testchart"}}})
+			Expect(err).To(MatchError(ContainSubstring("digest mismatch")))
+		})
+	})
+
+	Describe("publishToRepositoryDir", func() {
+		var chartFilename string
+
+		BeforeEach(func() {
+			chartFilename = filepath.Join(repoDir, "testchart-2.0.0.tgz")
+		})
+
+		It("creates the repository index", func() {
+			targetDir := filepath.Join(repoDir, "target")
+			md := &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "testchart", Version: "2.0.0"}
+			digest, err := publishToRepositoryDir(chartFilename, md, &RepositoryDir{Path: targetDir, URL: "https://charts.example.com"})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(filepath.Join(targetDir, "testchart-2.0.0.tgz")).To(BeARegularFile())
+			index, err := repo.LoadIndexFile(filepath.Join(targetDir, "index.yaml"))
+			Expect(err).ToNot(HaveOccurred())
+			cv, err := index.Get("testchart", "2.0.0")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cv.Digest).To(Equal(digest))
+			Expect(cv.URLs).To(Equal([]string{"https://charts.example.com/testchart-2.0.0.tgz"}))
+		})
+
+		It("merges into the existing repository index", func() {
+			md := &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "testchart", Version: "2.0.0", Description: "relocated"}
+			_, err := publishToRepositoryDir(chartFilename, md, &RepositoryDir{Path: repoDir, URL: server.URL})
+			Expect(err).ToNot(HaveOccurred())
+
+			index, err := repo.LoadIndexFile(filepath.Join(repoDir, "index.yaml"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(index.Entries["testchart"]).To(HaveLen(3))
+			cv, err := index.Get("testchart", "2.0.0")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cv.Description).To(Equal("relocated"))
+			_, err = index.Get("testchart", "1.0.0")
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Describe("uploadToChartMuseum", func() {
+		It("posts the chart to the ChartMuseum API", func() {
+			var uploaded []byte
+			museum := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.Method).To(Equal(http.MethodPost))
+				Expect(r.URL.Path).To(Equal("/api/charts"))
+				user, pass, ok := r.BasicAuth()
+				Expect(ok).To(BeTrue())
+				Expect(user + ":" + pass).To(Equal("user:pass"))
+				uploaded, _ = io.ReadAll(r.Body)
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write([]byte(`{"saved":true}`))
+			}))
+			defer museum.Close()
+
+			chartFilename := filepath.Join(repoDir, "testchart-2.0.0.tgz")
+			err := uploadToChartMuseum(chartFilename, &ChartMuseum{URL: museum.URL + "/", Username: "user", Password: "pass"})
+			Expect(err).ToNot(HaveOccurred())
+
+			expected, err := os.ReadFile(chartFilename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(uploaded).To(Equal(expected))
+		})
+
+		It("times out and retries the uploads", func() {
+			defaultClient := chartMuseumClient
+			chartMuseumClient = &http.Client{Timeout: 50 * time.Millisecond}
+			defer func() { chartMuseumClient = defaultClient }()
+
+			var attempts int32
+			museum := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&attempts, 1) < 3 {
+					time.Sleep(200 * time.Millisecond)
+				}
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer museum.Close()
+
+			chartFilename := filepath.Join(repoDir, "testchart-2.0.0.tgz")
+			err := uploadToChartMuseum(chartFilename, &ChartMuseum{URL: museum.URL})
+			Expect(err).To(MatchError(ContainSubstring("Client.Timeout exceeded")))
+
+			logger := &FakeLogger{Output: NewBuffer()}
+			cm := &ChartMover{logger: logger, retries: testRetries, targetChartMuseum: &ChartMuseum{URL: museum.URL}}
+			Expect(cm.publishChart(chartFilename, nil)).To(Succeed())
+			Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(3)))
+			Expect(logger.Output).To(Say("Attempt #1 failed"))
+			Expect(logger.Output).To(Say("Done moving " + museum.URL))
+		})
+
+		It("reports the API error", func() {
+			museum := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusConflict)
+				_, _ = w.Write([]byte(`{"error":"testchart-2.0.0.tgz already exists"}`))
+			}))
+			defer museum.Close()
+
+			err := uploadToChartMuseum(filepath.Join(repoDir, "testchart-2.0.0.tgz"), &ChartMuseum{URL: museum.URL})
+			Expect(err).To(MatchError(ContainSubstring("409 Conflict: testchart-2.0.0.tgz already exists")))
+		})
+	})
+})
@@ -8,6 +8,24 @@ import (
 	"strings"
 
 	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+)
+
+// Repository path strategies, telling what of the original repository path is
+// kept under the RepositoryPrefix
+const (
+	// PathStrategyLastSegment keeps the image name only, i.e bitnami/redis
+	// becomes prefix/redis. It is the default with a RepositoryPrefix
+	PathStrategyLastSegment = internal.PathStrategyLastSegment
+	// PathStrategyFull keeps the whole path, i.e prefix/bitnami/redis
+	PathStrategyFull = internal.PathStrategyFull
+	// PathStrategyRegistry keeps the whole path under the original registry
+	// host, i.e prefix/docker.io/bitnami/redis
+	PathStrategyRegistry = internal.PathStrategyRegistry
+	// PathStrategyFlat joins the whole path with the PathSeparator, i.e
+	// prefix/bitnami-redis, for registries limiting the path depth
+	PathStrategyFlat = internal.PathStrategyFlat
 )
 
 // RewriteRules indicate What kind of target registry overrides we want to apply to the found images
@@ -16,8 +34,32 @@ type RewriteRules struct {
 	Registry string
 	// RepositoryPrefix will override the image path by being prepended before the image name
 	RepositoryPrefix string
+	// PathStrategy tells what of the original repository path is kept under
+	// the RepositoryPrefix, the image name by default. Path segments are
+	// sanitized to what registries accept
+	PathStrategy string
+	// PathSeparator joins the path segments of the flat strategy, - by default
+	PathSeparator string
+	// TagStrategy tells the tag the images are pushed under, the original tag
+	// by default, and TagSuffix follows the original tag for the suffix strategy
+	TagStrategy string
+	TagSuffix   string
+	// ReferenceStrategy tells how the rewritten chart references the images,
+	// by digest unless the hint has a tag or digest placeholder by default
+	ReferenceStrategy string
 	// Push the image even if there is already an image with a different digest
 	ForcePush bool
+	// GlobalImageRegistry rewrites the chart global.imageRegistry, once, to
+	// the registry all the images move to, instead of each image registry
+	GlobalImageRegistry bool
+	// Mappings move each image to the target of the first rule it matches,
+	// falling back to the Registry and RepositoryPrefix rules
+	Mappings []*MappingRule
+}
+
+// empty tells if no rule moves the images anywhere
+func (r *RewriteRules) empty() bool {
+	return r.Registry == "" && r.RepositoryPrefix == "" && len(r.Mappings) == 0
 }
 
 func (r *RewriteRules) Validate() error {
@@ -42,5 +84,31 @@ func (r *RewriteRules) Validate() error {
 		}
 	}
 
+	if r.PathStrategy != "" && !validPathStrategy(r.PathStrategy) {
+		return fmt.Errorf("repository path strategy %q is not valid, expected one of %s", r.PathStrategy, strings.Join(internal.PathStrategies, ", "))
+	}
+	if r.PathSeparator != "" && !internal.ValidPathSeparator(r.PathSeparator) {
+		return fmt.Errorf("repository path separator %q is not valid, expected ., _, __ or dashes", r.PathSeparator)
+	}
+
+	if err := r.validateStrategies(); err != nil {
+		return err
+	}
+
+	for i, rule := range r.Mappings {
+		if err := rule.compile(); err != nil {
+			return fmt.Errorf("mapping rule #%d is not valid: %w", i+1, err)
+		}
+	}
+
 	return nil
 }
+
+func validPathStrategy(strategy string) bool {
+	for _, valid := range internal.PathStrategies {
+		if strategy == valid {
+			return true
+		}
+	}
+	return false
+}
@@ -92,4 +92,23 @@ var _ = Describe("RewriteRules", func() {
 			Expect(err.Error()).To(Equal("registry rule is not valid: registries must be valid RFC 3986 URI authorities: a.domain.with.an.invalid.port:lolwut"))
 		})
 	})
+
+	Context("repository path strategy", func() {
+		It("accepts the known strategies and separators", func() {
+			rules := mover.RewriteRules{
+				RepositoryPrefix: "myprojects",
+				PathStrategy:     mover.PathStrategyFlat,
+				PathSeparator:    "__",
+			}
+			Expect(rules.Validate()).To(Succeed())
+		})
+
+		It("rejects unknown strategies and separators", func() {
+			rules := mover.RewriteRules{PathStrategy: "deep"}
+			Expect(rules.Validate()).To(MatchError(`repository path strategy "deep" is not valid, expected one of last-segment, full, registry, flat`))
+
+			rules = mover.RewriteRules{PathStrategy: mover.PathStrategyFlat, PathSeparator: "+"}
+			Expect(rules.Validate()).To(MatchError(`repository path separator "+" is not valid, expected ., _, __ or dashes`))
+		})
+	})
 })
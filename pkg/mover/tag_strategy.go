@@ -0,0 +1,136 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"helm.sh/helm/v3/pkg/chart"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+)
+
+// Tag strategies, telling the tag the relocated images are pushed under
+const (
+	// TagStrategyOriginal pushes the image under its original tag, if known.
+	// It is the default
+	TagStrategyOriginal = "original"
+	// TagStrategyChartVersion pushes the image under the chart version
+	TagStrategyChartVersion = "chart-version"
+	// TagStrategySuffix pushes the image under its original tag followed by
+	// the TagSuffix, i.e 6.2-relocated
+	TagStrategySuffix = "suffix"
+	// TagStrategyDigestOnly pushes the image by digest, with no tag
+	TagStrategyDigestOnly = "digest-only"
+)
+
+// TagStrategies lists the tag strategies
+var TagStrategies = []string{TagStrategyOriginal, TagStrategyChartVersion, TagStrategySuffix, TagStrategyDigestOnly}
+
+// Reference strategies, telling how the rewritten chart references the
+// relocated images. By default, images are referenced by digest unless their
+// hint has a tag or digest placeholder
+const (
+	// ReferenceStrategyTag references the image by its pushed tag only
+	ReferenceStrategyTag = internal.ReferenceStrategyTag
+	// ReferenceStrategyDigest references the image by digest only
+	ReferenceStrategyDigest = internal.ReferenceStrategyDigest
+	// ReferenceStrategyTagAndDigest references the image by its pushed tag
+	// and digest, i.e repository:tag@digest
+	ReferenceStrategyTagAndDigest = internal.ReferenceStrategyTagAndDigest
+)
+
+// tagSuffixRegex matches the characters tags allow
+var tagSuffixRegex = regexp.MustCompile(`^[\w.-]+$`)
+
+// validateStrategies checks the tag and reference strategies and that they
+// can be used together
+func (r *RewriteRules) validateStrategies() error {
+	if r.TagStrategy != "" && !contains(TagStrategies, r.TagStrategy) {
+		return fmt.Errorf("tag strategy %q is not valid, expected one of %s", r.TagStrategy, strings.Join(TagStrategies, ", "))
+	}
+	if r.TagStrategy == TagStrategySuffix && r.TagSuffix == "" {
+		return fmt.Errorf("the %s tag strategy requires a tag suffix", TagStrategySuffix)
+	}
+	if r.TagSuffix != "" {
+		if r.TagStrategy != TagStrategySuffix {
+			return fmt.Errorf("a tag suffix is only used by the %s tag strategy", TagStrategySuffix)
+		}
+		if !tagSuffixRegex.MatchString(r.TagSuffix) {
+			return fmt.Errorf("tag suffix %q is not valid, expected letters, digits, _, . or -", r.TagSuffix)
+		}
+	}
+
+	if r.ReferenceStrategy != "" && !contains(internal.ReferenceStrategies, r.ReferenceStrategy) {
+		return fmt.Errorf("reference strategy %q is not valid, expected one of %s", r.ReferenceStrategy, strings.Join(internal.ReferenceStrategies, ", "))
+	}
+	if r.TagStrategy == TagStrategyDigestOnly && (r.ReferenceStrategy == ReferenceStrategyTag || r.ReferenceStrategy == ReferenceStrategyTagAndDigest) {
+		return fmt.Errorf("the %s reference strategy requires a pushed tag, not the %s tag strategy", r.ReferenceStrategy, TagStrategyDigestOnly)
+	}
+	return nil
+}
+
+// pushTag returns the tag the image is pushed under following the tag
+// strategy, empty to push it by digest only. Images referenced by digest have
+// no original tag
+func (r *RewriteRules) pushTag(image name.Reference, chartVersion string) string {
+	originalTag := ""
+	if tag, ok := image.(name.Tag); ok {
+		originalTag = tag.TagStr()
+	}
+
+	switch r.TagStrategy {
+	case TagStrategyChartVersion:
+		// As Helm does for OCI charts, since tags do not allow + signs
+		return strings.ReplaceAll(chartVersion, "+", "_")
+	case TagStrategySuffix:
+		if originalTag == "" {
+			return ""
+		}
+		return originalTag + r.TagSuffix
+	case TagStrategyDigestOnly:
+		return ""
+	}
+	return originalTag
+}
+
+// referenceStrategy returns how the rewritten chart references the images.
+// Images pushed by digest only can't be referenced by tag
+func (r *RewriteRules) referenceStrategy() string {
+	if r.ReferenceStrategy == "" && r.TagStrategy == TagStrategyDigestOnly {
+		return ReferenceStrategyDigest
+	}
+	return r.ReferenceStrategy
+}
+
+// chartVersion returns the version of the chart, empty if unknown
+func chartVersion(c *chart.Chart) string {
+	if c == nil || c.Metadata == nil {
+		return ""
+	}
+	return c.Metadata.Version
+}
+
+// customStrategies tells if a tag or reference strategy other than the
+// defaults is set
+func (r *RewriteRules) customStrategies() bool {
+	return (r.TagStrategy != "" && r.TagStrategy != TagStrategyOriginal) || r.ReferenceStrategy != ""
+}
+
+// changedValueActions drops the actions setting values to what they already
+// are, such as the tag placeholders of images pushed under their original
+// tag. Only used along custom strategies
+func changedValueActions(c *chart.Chart, actions []*internal.RewriteAction) []*internal.RewriteAction {
+	changed := []*internal.RewriteAction{}
+	for _, action := range actions {
+		if value, ok := internal.LookupValue(c, action.Path); ok && fmt.Sprint(value) == action.Value {
+			continue
+		}
+		changed = append(changed, action)
+	}
+	return changed
+}
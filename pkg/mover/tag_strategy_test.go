@@ -0,0 +1,179 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"errors"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+	"helm.sh/helm/v3/pkg/chart"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal/internalfakes"
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/test"
+)
+
+var _ = Describe("Tag and reference strategies", func() {
+	const digest = "sha256:1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+
+	It("pushes the images under the tag of the strategy", func() {
+		image := name.MustParseReference("bitnami/wavefront:5.6.7")
+		Expect((&RewriteRules{}).pushTag(image, "1.0.0+build.1")).To(Equal("5.6.7"))
+		Expect((&RewriteRules{TagStrategy: TagStrategyChartVersion}).pushTag(image, "1.0.0+build.1")).To(Equal("1.0.0_build.1"))
+		Expect((&RewriteRules{TagStrategy: TagStrategySuffix, TagSuffix: "-relocated"}).pushTag(image, "")).To(Equal("5.6.7-relocated"))
+		Expect((&RewriteRules{TagStrategy: TagStrategyDigestOnly}).pushTag(image, "")).To(BeEmpty())
+
+		By("pushing images referenced by digest by digest", func() {
+			image := name.MustParseReference("bitnami/wavefront@" + digest)
+			Expect((&RewriteRules{TagStrategy: TagStrategySuffix, TagSuffix: "-relocated"}).pushTag(image, "")).To(BeEmpty())
+		})
+	})
+
+	It("rejects invalid strategies", func() {
+		invalid := []*RewriteRules{
+			{TagStrategy: "latest"},
+			{TagStrategy: TagStrategySuffix},
+			{TagStrategy: TagStrategySuffix, TagSuffix: "+relocated"},
+			{TagSuffix: "-relocated"},
+			{ReferenceStrategy: "name"},
+			{TagStrategy: TagStrategyDigestOnly, ReferenceStrategy: ReferenceStrategyTag},
+		}
+		for _, rules := range invalid {
+			Expect(rules.Validate()).ToNot(Succeed(), "%+v", rules)
+		}
+	})
+
+	Describe("computeChanges", func() {
+		var (
+			fakeRegistry *internalfakes.FakeContainerRegistryInterface
+			cm           *ChartMover
+			changes      []*internal.ImageChange
+		)
+
+		BeforeEach(func() {
+			fakeRegistry = &internalfakes.FakeContainerRegistryInterface{}
+			fakeRegistry.CheckReturns(true, nil)
+			versionedChart := test.MakeChart(&test.ChartSeed{Values: testchart.Values})
+			versionedChart.Metadata = &chart.Metadata{Name: "testchart", Version: "1.0.0"}
+			cm = testChartMover(fakeRegistry, NoLogger)
+			cm.chart = versionedChart
+			changes = []*internal.ImageChange{
+				{
+					Pattern:        newPattern("{{.observability.image.registry}}/{{.observability.image.repository}}:{{.observability.image.tag}}"),
+					ImageReference: name.MustParseReference("index.docker.io/bitnami/wavefront:5.6.7"),
+					Image:          makeImage(digest),
+					Digest:         digest,
+				},
+			}
+		})
+
+		It("leaves the tag as it is when pushing under the original tag", func() {
+			newChanges, actions, err := cm.computeChanges(changes, &RewriteRules{Registry: "harbor-repo.vmware.com"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actions).To(Equal([]*internal.RewriteAction{{Path: ".observability.image.registry", Value: "harbor-repo.vmware.com"}}))
+			Expect(newChanges[0].Tag).To(Equal("5.6.7"))
+		})
+
+		It("keeps the actions setting values to what they are without custom strategies", func() {
+			_, actions, err := cm.computeChanges(changes, &RewriteRules{Registry: "docker.io"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actions).To(Equal([]*internal.RewriteAction{{Path: ".observability.image.registry", Value: "docker.io"}}))
+
+			By("dropping them along custom strategies", func() {
+				_, actions, err := cm.computeChanges(changes, &RewriteRules{Registry: "docker.io", ReferenceStrategy: ReferenceStrategyTag})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(actions).To(BeEmpty())
+			})
+		})
+
+		It("points the tag to the chart version", func() {
+			newChanges, actions, err := cm.computeChanges(changes, &RewriteRules{Registry: "harbor-repo.vmware.com", TagStrategy: TagStrategyChartVersion})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actions).To(ContainElement(&internal.RewriteAction{Path: ".observability.image.tag", Value: "1.0.0"}))
+			Expect(newChanges[0].Tag).To(Equal("1.0.0"))
+			Expect(newChanges[0].RewrittenReference.Name()).To(Equal("harbor-repo.vmware.com/bitnami/wavefront:1.0.0"))
+		})
+
+		It("references the image by its pushed tag and digest", func() {
+			newChanges, actions, err := cm.computeChanges(changes, &RewriteRules{
+				Registry:          "harbor-repo.vmware.com",
+				TagStrategy:       TagStrategySuffix,
+				TagSuffix:         "-relocated",
+				ReferenceStrategy: ReferenceStrategyTagAndDigest,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actions).To(ContainElement(&internal.RewriteAction{Path: ".observability.image.tag", Value: "5.6.7-relocated@" + digest}))
+			Expect(newChanges[0].Tag).To(Equal("5.6.7-relocated"))
+			Expect(referenceName(newChanges[0].RewrittenReference)).To(Equal("harbor-repo.vmware.com/bitnami/wavefront:5.6.7-relocated@" + digest))
+		})
+
+		It("detects distinct images referenced by digest pushed under the same tag", func() {
+			const otherDigest = "sha256:2bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+			image := func(registry, repository, digest string) map[string]interface{} {
+				return map[string]interface{}{
+					"image": map[string]interface{}{"registry": registry, "repository": repository, "digest": digest},
+				}
+			}
+			cm.chart = test.MakeChart(&test.ChartSeed{Values: map[string]interface{}{
+				"observability":    image("docker.io", "bitnami/redis", digest),
+				"observabilitytoo": image("quay.io", "x/redis", otherDigest),
+			}})
+			cm.chart.Metadata = &chart.Metadata{Name: "testchart", Version: "1.0.0"}
+			changes = []*internal.ImageChange{
+				{
+					Pattern:        newPattern("{{.observability.image.registry}}/{{.observability.image.repository}}@{{.observability.image.digest}}"),
+					ImageReference: name.MustParseReference("index.docker.io/bitnami/redis@" + digest),
+					Image:          makeImage(digest),
+					Digest:         digest,
+				},
+				{
+					Pattern:        newPattern("{{.observabilitytoo.image.registry}}/{{.observabilitytoo.image.repository}}@{{.observabilitytoo.image.digest}}"),
+					ImageReference: name.MustParseReference("quay.io/x/redis@" + otherDigest),
+					Image:          makeImage(otherDigest),
+					Digest:         otherDigest,
+				},
+			}
+			_, _, err := cm.computeChanges(changes, &RewriteRules{Registry: "harbor-repo.vmware.com", RepositoryPrefix: "pwall", TagStrategy: TagStrategyChartVersion})
+			Expect(errors.Is(err, ErrTargetCollision)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("\n  harbor-repo.vmware.com/pwall/redis:1.0.0 <=" +
+				"\n    index.docker.io/bitnami/redis@" + digest + " (" + digest + ")" +
+				"\n    quay.io/x/redis@" + otherDigest + " (" + otherDigest + ")"))
+			Expect(fakeRegistry.CheckCallCount()).To(BeZero())
+
+			By("pushing them by digest only", func() {
+				_, _, err := cm.computeChanges(changes, &RewriteRules{Registry: "harbor-repo.vmware.com", RepositoryPrefix: "pwall"})
+				Expect(err).ToNot(HaveOccurred())
+			})
+		})
+
+		It("warns about single platforms pushed under the original tag", func() {
+			printer := &testPrinter{out: NewBuffer()}
+			cm = testChartMover(fakeRegistry, printer)
+			cm.chart = test.MakeChart(&test.ChartSeed{Values: testchart.Values})
+			cm.chart.Metadata = &chart.Metadata{Name: "testchart", Version: "1.0.0"}
+			changes[0].Pattern.Platforms = []string{"linux/arm64"}
+
+			newChanges, _, err := cm.computeChanges(changes, &RewriteRules{Registry: "harbor-repo.vmware.com"})
+			Expect(err).ToNot(HaveOccurred())
+			cm.printImageCopies(newChanges)
+			Expect(printer.out).To(Say(`Warning: only the linux/arm64 platform is pushed under the original tag 5.6.7, replacing any multi-platform image there`))
+
+			By("pushing it under the tag of a strategy", func() {
+				printer.out = NewBuffer()
+				newChanges, _, err := cm.computeChanges(changes, &RewriteRules{Registry: "harbor-repo.vmware.com", TagStrategy: TagStrategySuffix, TagSuffix: "-arm64"})
+				Expect(err).ToNot(HaveOccurred())
+				cm.printImageCopies(newChanges)
+				Expect(printer.out).ToNot(Say("Warning"))
+			})
+		})
+
+		It("fails to reference by digest only an image whose hint has a tag placeholder", func() {
+			_, _, err := cm.computeChanges(changes, &RewriteRules{Registry: "harbor-repo.vmware.com", TagStrategy: TagStrategyDigestOnly})
+			Expect(err).To(MatchError(ContainSubstring("can't reference the image by digest only, it has a tag placeholder")))
+		})
+	})
+})
@@ -0,0 +1,56 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"sort"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+)
+
+// templateRewrites returns the rewrites of the images hardcoded in the chart
+// templates, once per template file and image
+func templateRewrites(imageChanges []*internal.ImageChange) []*internal.TemplateRewrite {
+	rewrites := []*internal.TemplateRewrite{}
+	seen := map[internal.TemplateRewrite]bool{}
+	for _, change := range imageChanges {
+		if change.Pattern == nil || change.Pattern.TemplateImage == "" || change.RewrittenReference == nil {
+			continue
+		}
+		rewrite := internal.TemplateRewrite{
+			File:     change.Pattern.TemplateFile,
+			Original: change.Pattern.TemplateImage,
+			Value:    referenceName(change.RewrittenReference),
+		}
+		if seen[rewrite] {
+			continue
+		}
+		seen[rewrite] = true
+		rewrites = append(rewrites, &rewrite)
+	}
+	return rewrites
+}
+
+// printTemplateRewrites shows the images to be rewritten in each template file
+func (cm *ChartMover) printTemplateRewrites() {
+	log := cm.logger
+	rewrites := templateRewrites(cm.imageChanges)
+	sort.SliceStable(rewrites, func(i, j int) bool {
+		return rewrites[i].File < rewrites[j].File
+	})
+	file := ""
+	for _, rewrite := range rewrites {
+		if rewrite.File != file {
+			if file != "" {
+				log.Println()
+			}
+			file = rewrite.File
+			log.Printf("\nChanges to be applied to %s/%s:\n", cm.chart.Name(), file)
+		}
+		log.Printf("  %s: %s\n", rewrite.Original, rewrite.Value)
+	}
+	if file != "" {
+		log.Println()
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+	"helm.sh/helm/v3/pkg/chart"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+)
+
+// ValuesOverrideFilename is the file written when the ValuesOverride path is a directory
+const ValuesOverrideFilename = "relocated-values.yaml"
+
+// ValuesOverride is a Helm values file relocating the chart images, to be
+// passed to helm install -f, leaving the chart untouched. Subchart values are
+// nested under their chart name, as in the parent chart values.yaml
+type ValuesOverride struct {
+	Path string
+}
+
+// valuesOverrideFilename returns the file to write, placing a
+// relocated-values.yaml in path when it is an existing directory
+func valuesOverrideFilename(path string) string {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return filepath.Join(path, ValuesOverrideFilename)
+	}
+	return path
+}
+
+// writeValuesOverride saves the rewrite actions of the chart as a single values file
+func writeValuesOverride(filename string, c *chart.Chart, actions []*internal.RewriteAction) error {
+	values, err := internal.RewritesToValues(c, actions)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("failed to encode values override: %w", err)
+	}
+	if dir := filepath.Dir(filename); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create values override directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(filename, data, defaultPerm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package mover
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/internal"
+	"github.com/vmware-tanzu/asset-relocation-tool-for-kubernetes/test"
+)
+
+var _ = Describe("Values override", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "values-override-test-*")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("writes the rewrites as nested values, keeping the subchart keys", func() {
+		filename := valuesOverrideFilename(dir)
+		Expect(filename).To(Equal(filepath.Join(dir, ValuesOverrideFilename)))
+
+		err := writeValuesOverride(filename, test.MakeChart(&test.ChartSeed{}), []*internal.RewriteAction{
+			{Path: ".image.registry", Value: "harbor-repo.vmware.com"},
+			{Path: ".image.repository", Value: "pwall/wordpress"},
+			{Path: ".mariadb.image.registry", Value: "harbor-repo.vmware.com"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		data, err := os.ReadFile(filename)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal(`image:
+  registry: harbor-repo.vmware.com
+  repository: pwall/wordpress
+mariadb:
+  image:
+    registry: harbor-repo.vmware.com
+`))
+	})
+
+	It("copies the whole lists holding rewritten items, as Helm replaces lists", func() {
+		chart := test.MakeChart(&test.ChartSeed{Values: map[string]interface{}{
+			"sidecars": []interface{}{
+				map[string]interface{}{"name": "proxy", "image": "docker.io/envoyproxy/envoy:v1.22.0"},
+				map[string]interface{}{"name": "logs", "image": "docker.io/fluent/fluent-bit:1.9"},
+			},
+		}})
+		filename := filepath.Join(dir, "values.yaml")
+		err := writeValuesOverride(filename, chart, []*internal.RewriteAction{
+			{Path: ".sidecars[1].image", Value: "harbor-repo.vmware.com/pwall/fluent-bit:1.9"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		data, err := os.ReadFile(filename)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal(`sidecars:
+- image: docker.io/envoyproxy/envoy:v1.22.0
+  name: proxy
+- image: harbor-repo.vmware.com/pwall/fluent-bit:1.9
+  name: logs
+`))
+		Expect(chart.Values["sidecars"].([]interface{})[1]).To(HaveKeyWithValue("image", "docker.io/fluent/fluent-bit:1.9"))
+	})
+
+	It("cannot be combined with other chart targets", func() {
+		err := validateTarget(&Target{
+			Chart: ChartSpec{
+				ValuesOverride:   &ValuesOverride{Path: "relocated-values.yaml"},
+				KustomizeOverlay: &KustomizeOverlay{Path: "overlay"},
+			},
+			Rules: RewriteRules{Registry: "harbor-repo.vmware.com"},
+		})
+		Expect(err).To(MatchError(ContainSubstring("cannot be combined with other chart targets")))
+	})
+})
@@ -103,7 +103,7 @@ var _ = Describe("relok8s chart move input validation", func() {
 		})
 
 		define.Then(`^it says that the rules are missing$`, func() {
-			Expect(test.CommandSession.Err).To(Say("Error: at least one rewrite rule must be given. Please try again with --registry and/or --repo-prefix"))
+			Expect(test.CommandSession.Err).To(Say("Error: at least one rewrite rule must be given. Please try again with --registry, --repo-prefix and/or --rules-file"))
 		})
 
 		define.Then(`^it says that the registry is invalid$`, func() {